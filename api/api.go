@@ -0,0 +1,133 @@
+// Package api holds the messages of the gobertura CoverageService described
+// in coverage.proto and a hand-written client for it. The service only
+// serves unary Connect calls with the JSON codec: gRPC and gRPC-Web framing
+// and the protobuf codec are rejected, so generated clients have to be
+// configured for Connect with JSON.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ServicePath is the path prefix of the CoverageService procedures
+const ServicePath = "/gobertura.v1.CoverageService/"
+
+type SubmitProfileRequest struct {
+	Project string `json:"project,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	Name    string `json:"name"`
+	Profile []byte `json:"profile"`
+}
+
+type SubmitProfileResponse struct {
+	Changed  bool    `json:"changed,omitempty"`
+	LineRate float64 `json:"lineRate,omitempty"`
+}
+
+type GetReportRequest struct {
+	Project string `json:"project,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+}
+
+type GetReportResponse struct {
+	Report    []byte  `json:"report"`
+	LineRate  float64 `json:"lineRate,omitempty"`
+	Timestamp int64   `json:"timestamp,string,omitempty"`
+}
+
+type GetDiffRequest struct {
+	Project    string `json:"project,omitempty"`
+	BaseBranch string `json:"baseBranch"`
+	HeadBranch string `json:"headBranch"`
+}
+
+type GetDiffResponse struct {
+	Patch        string  `json:"patch,omitempty"`
+	BaseLineRate float64 `json:"baseLineRate,omitempty"`
+	HeadLineRate float64 `json:"headLineRate,omitempty"`
+}
+
+// Error is a Connect error, Code being one of the Connect codes such as
+// "not_found" or "unauthenticated"
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Client calls a CoverageService, usually started with `gobertura serve`
+type Client struct {
+	// BaseURL of the server, e.g. http://localhost:8080
+	BaseURL string
+	// Token sent as bearer token when not empty
+	Token string
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+func (c *Client) SubmitProfile(ctx context.Context, req *SubmitProfileRequest) (*SubmitProfileResponse, error) {
+	res := &SubmitProfileResponse{}
+	return res, c.call(ctx, "SubmitProfile", req, res)
+}
+
+func (c *Client) GetReport(ctx context.Context, req *GetReportRequest) (*GetReportResponse, error) {
+	res := &GetReportResponse{}
+	return res, c.call(ctx, "GetReport", req, res)
+}
+
+func (c *Client) GetDiff(ctx context.Context, req *GetDiffRequest) (*GetDiffResponse, error) {
+	res := &GetDiffResponse{}
+	return res, c.call(ctx, "GetDiff", req, res)
+}
+
+// call does a Connect unary request of procedure
+func (c *Client) call(ctx context.Context, procedure string, req interface{}, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+ServicePath+procedure, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Connect-Protocol-Version", "1")
+	if c.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpRes, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+	data, err := ioutil.ReadAll(httpRes.Body)
+	if err != nil {
+		return err
+	}
+	if httpRes.StatusCode != http.StatusOK {
+		e := &Error{}
+		if json.Unmarshal(data, e) != nil || e.Code == "" {
+			return fmt.Errorf("%s: %s", procedure, httpRes.Status)
+		}
+		return e
+	}
+	return json.Unmarshal(data, res)
+}
@@ -0,0 +1,24 @@
+// Command gobertura-vet reports exported functions not covered by tests.
+//
+//	$ go vet -vettool=$(which gobertura-vet) -profile=$PWD/coverprofile.txt ./...
+//
+// It only runs under go vet: the golang.org/x/tools it is built with can't
+// load the packages of current Go versions by itself.
+package main
+
+import (
+	"fmt"
+	"github.com/nim4/gocover-cobertura/uncovered"
+	"golang.org/x/tools/go/analysis/singlechecker"
+	"os"
+	"strings"
+)
+
+func main() {
+	// go vet passes a .cfg file, or -flags and -V=full when probing the tool
+	if n := len(os.Args); n > 1 && !strings.HasPrefix(os.Args[n-1], "-") && !strings.HasSuffix(os.Args[n-1], ".cfg") {
+		fmt.Fprintln(os.Stderr, "gobertura-vet: run as go vet -vettool=$(which gobertura-vet) -profile=PROFILE PACKAGES")
+		os.Exit(2)
+	}
+	singlechecker.Main(uncovered.Analyzer)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// attribution records which tests cover each line, built from profiles
+// each produced by a single test
+type attribution struct {
+	Tests []string `json:"tests"`
+	// Files maps file names to line numbers to the tests covering them
+	Files map[string]map[int][]string `json:"files"`
+}
+
+// attributeCommand converts one profile per test and writes the tests
+// covering every line as a JSON sidecar
+func attributeCommand(args []string) {
+	fs := flag.NewFlagSet("attribute", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura attribute [flags] [TEST=]profile...")
+		fs.PrintDefaults()
+	}
+	var cfg config
+	out := fs.String("out", "attribution.json", "output path")
+	from := fs.String("from", "", "JSON object mapping test names to profile paths, e.g. written by a test harness")
+	cfg.register(fs)
+	fs.Parse(args)
+
+	tests := map[string]string{}
+	if *from != "" {
+		data, err := ioutil.ReadFile(*from)
+		if err != nil {
+			panic(err)
+		}
+		err = json.Unmarshal(data, &tests)
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", *from, err))
+		}
+	}
+	for _, arg := range fs.Args() {
+		name, path := strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg)), arg
+		if i := strings.Index(arg, "="); i >= 0 {
+			name, path = arg[:i], arg[i+1:]
+		}
+		tests[name] = path
+	}
+	if len(tests) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	err := cfg.resolve()
+	if err != nil {
+		panic(err)
+	}
+	a, err := attribute(cfg, tests)
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.MarshalIndent(a, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	err = writeFile(*out, append(data, '\n'), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// attribute converts the profile of every test, tests mapping test names to
+// profile paths
+func attribute(cfg config, tests map[string]string) (*attribution, error) {
+	a := &attribution{Files: map[string]map[int][]string{}}
+	for name := range tests {
+		a.Tests = append(a.Tests, name)
+	}
+	sort.Strings(a.Tests)
+
+	for _, name := range a.Tests {
+		profiles, err := cfg.parseProfiles(tests[name])
+		if err != nil {
+			return nil, err
+		}
+		coverage, err := cfg.coverage(profiles)
+		if err != nil {
+			return nil, err
+		}
+		for file, hits := range fileHits(coverage) {
+			lines := a.Files[file]
+			if lines == nil {
+				lines = map[int][]string{}
+				a.Files[file] = lines
+			}
+			for number, h := range hits {
+				if h > 0 {
+					lines[number] = append(lines[number], name)
+				} else if lines[number] == nil {
+					// Keep uncovered lines, telling them apart from non-code
+					lines[number] = []string{}
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+func readAttribution(path string) (*attribution, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &attribution{}
+	err = json.Unmarshal(data, a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return a, nil
+}
+
+// whichTestsCommand prints the tests covering the given lines
+func whichTestsCommand(args []string) {
+	fs := flag.NewFlagSet("which-tests", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura which-tests [flags] file.go:line...")
+		fs.PrintDefaults()
+	}
+	path := fs.String("attribution", "attribution.json", "path of the attribution written by gobertura attribute")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := readAttribution(*path)
+	if err != nil {
+		panic(err)
+	}
+	for _, arg := range fs.Args() {
+		file, number, err := parseFileLine(arg)
+		if err != nil {
+			panic(err)
+		}
+		tests, ok := a.Files[file][number]
+		switch {
+		case !ok:
+			fmt.Printf("%s\tno statement\n", arg)
+		case len(tests) == 0:
+			fmt.Printf("%s\tuncovered\n", arg)
+		default:
+			fmt.Printf("%s\t%s\n", arg, strings.Join(tests, " "))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultBaseCache is the folder remote base reports of diff are cached in,
+// empty when the user has no cache folder
+func defaultBaseCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gobertura", "base")
+}
+
+// baseReport reads the base report of diff at location, a path or URL whose
+// $VAR and ${VAR} are expanded from the environment, returning it along with
+// the expanded location. Remote reports are kept in cacheDir, when not empty,
+// and reused for ttl; a stale copy is used when fetching fails.
+func baseReport(location string, cacheDir string, ttl time.Duration) (*cobertura.Coverage, string, error) {
+	name := os.Expand(location, os.Getenv)
+	if !isRemote(name) || cacheDir == "" {
+		report, err := readReport(name)
+		return report, name, err
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	cached := filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".xml")
+	info, err := os.Stat(cached)
+	if err == nil && time.Since(info.ModTime()) < ttl {
+		report, err := readCachedReport(name, cached)
+		if err == nil {
+			return report, name, nil
+		}
+	}
+
+	data, err := readReportData(name)
+	if err != nil {
+		if info == nil {
+			return nil, name, err
+		}
+		report, cacheErr := readCachedReport(name, cached)
+		if cacheErr != nil {
+			return nil, name, err
+		}
+		fmt.Fprintf(os.Stderr, "gobertura: %v, using the copy cached %s ago\n", err, time.Since(info.ModTime()).Round(time.Second))
+		return report, name, nil
+	}
+	report, err := decodeReport(name, data)
+	if err != nil {
+		return nil, name, err
+	}
+	err = os.MkdirAll(cacheDir, 0700)
+	if err == nil {
+		err = writeFile(cached, data, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gobertura: caching %s: %v\n", name, err)
+	}
+	return report, name, nil
+}
+
+// readCachedReport decodes the copy of the report at name cached at path
+func readCachedReport(name string, path string) (*cobertura.Coverage, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeReport(name, data)
+}
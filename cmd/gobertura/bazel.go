@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseBazelProfiles parses the coverage.dat data written by `bazel coverage`
+// read from name, either in LCOV or Go profile format, mapping execroot paths
+// back to workspace relative ones
+func (cfg config) parseBazelProfiles(name string, data []byte) ([]*cover.Profile, error) {
+	if bytes.HasPrefix(data, []byte("mode:")) {
+		profiles, err := cfg.parseGoProfiles(name, data)
+		if err != nil {
+			return nil, err
+		}
+		return bazelProfiles(profiles), nil
+	}
+	profiles, err := parseLCOV(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return bazelProfiles(profiles), nil
+}
+
+// bazelProfiles maps the file names of profiles to workspace paths
+func bazelProfiles(profiles []*cover.Profile) []*cover.Profile {
+	// Files listed by several test targets are merged when converting
+	for _, profile := range profiles {
+		profile.FileName = bazelPath(profile.FileName)
+	}
+	return profiles
+}
+
+// parseLCOV returns a profile per SF record of data, every DA line becoming a
+// block of one statement spanning the whole line
+func parseLCOV(data []byte) ([]*cover.Profile, error) {
+	var profiles []*cover.Profile
+	var profile *cover.Profile
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			profile = &cover.Profile{FileName: strings.TrimPrefix(line, "SF:"), Mode: "count"}
+			profiles = append(profiles, profile)
+		case strings.HasPrefix(line, "DA:"):
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if profile == nil || len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: unexpected %q", n, line)
+			}
+			number, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			// Saturate the hits of hot lines rather than failing
+			count, err := strconv.ParseInt(fields[1], 10, strconv.IntSize)
+			if errors.Is(err, strconv.ErrRange) && count > 0 {
+				count, err = math.MaxInt, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			profile.Blocks = append(profile.Blocks, cover.ProfileBlock{
+				StartLine: number,
+				StartCol:  1,
+				EndLine:   number,
+				EndCol:    cobertura.EndOfLine,
+				NumStmt:   1,
+				Count:     int(count),
+			})
+		case line == "end_of_record":
+			profile = nil
+		}
+	}
+	return profiles, scanner.Err()
+}
+
+// bazelPath maps a path under an execroot or an output tree, e.g.
+// /home/u/.cache/bazel/_bazel_u/HASH/execroot/__main__/pkg/file.go or
+// bazel-out/k8-fastbuild/bin/pkg/file.go, to the workspace path pkg/file.go
+func bazelPath(path string) string {
+	if i := strings.Index(path, "/execroot/"); i >= 0 {
+		path = path[i+len("/execroot/"):]
+		// Strip the workspace name
+		if j := strings.Index(path, "/"); j >= 0 {
+			path = path[j+1:]
+		}
+	}
+	if strings.HasPrefix(path, "bazel-out/") {
+		// bazel-out/CONFIG/bin/...
+		parts := strings.SplitN(path, "/", 4)
+		if len(parts) == 4 && parts[2] == "bin" {
+			path = parts[3]
+		}
+	}
+	return path
+}
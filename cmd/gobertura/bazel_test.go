@@ -0,0 +1,176 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"github.com/nim4/gocover-cobertura/cobertura/coberturatest"
+	"golang.org/x/tools/cover"
+	"math"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// lcovBlock is the block parseLCOV makes of the hits of line
+func lcovBlock(line int, count int) cover.ProfileBlock {
+	return coberturatest.Block(line, 1, line, cobertura.EndOfLine, 1, count)
+}
+
+func TestParseLCOV(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		lcov string
+		want []*cover.Profile
+	}{
+		{
+			name: "records",
+			lcov: "SF:pkg/a.go\nDA:3,1\nDA:4,0\nend_of_record\nSF:pkg/b.go\nDA:7,12\nend_of_record\n",
+			want: []*cover.Profile{
+				coberturatest.Profile("pkg/a.go", "count", lcovBlock(3, 1), lcovBlock(4, 0)),
+				coberturatest.Profile("pkg/b.go", "count", lcovBlock(7, 12)),
+			},
+		},
+		{
+			name: "missing end_of_record",
+			lcov: "SF:pkg/a.go\nDA:3,1\nSF:pkg/b.go\nDA:7,2",
+			want: []*cover.Profile{
+				coberturatest.Profile("pkg/a.go", "count", lcovBlock(3, 1)),
+				coberturatest.Profile("pkg/b.go", "count", lcovBlock(7, 2)),
+			},
+		},
+		{
+			name: "duplicate lines are kept for the conversion to sum",
+			lcov: "SF:pkg/a.go\nDA:3,1\nDA:3,2\nend_of_record\n",
+			want: []*cover.Profile{
+				coberturatest.Profile("pkg/a.go", "count", lcovBlock(3, 1), lcovBlock(3, 2)),
+			},
+		},
+		{
+			name: "checksums, saturated hits and other records",
+			lcov: "TN:\r\nSF:pkg/a.go\r\nFN:3,Add\r\nFNDA:1,Add\r\nDA:3,1,Tz3VcBN0ZOLh\r\nDA:4,99999999999999999999\r\nBRDA:4,0,0,1\r\nLF:2\r\nLH:2\r\n  end_of_record  \r\n",
+			want: []*cover.Profile{
+				coberturatest.Profile("pkg/a.go", "count", lcovBlock(3, 1), lcovBlock(4, math.MaxInt)),
+			},
+		},
+		{
+			name: "empty",
+			lcov: "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLCOV([]byte(tt.lcov))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLCOVErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		lcov string
+		want string
+	}{
+		{"DA before SF", "DA:3,1\n", `line 1: unexpected "DA:3,1"`},
+		{"DA after end_of_record", "SF:a.go\nDA:3,1\nend_of_record\nDA:4,1\n", `line 4: unexpected "DA:4,1"`},
+		{"missing count", "SF:a.go\nDA:3\n", `line 2: unexpected "DA:3"`},
+		{"malformed line", "SF:a.go\nDA:x,1\n", `line 2: strconv.Atoi: parsing "x": invalid syntax`},
+		{"malformed count", "SF:a.go\nDA:3,many\n", `line 2: strconv.ParseInt: parsing "many": invalid syntax`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseLCOV([]byte(tt.lcov))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// bazelCoverage is a coverage.dat of `bazel coverage //...` combining two
+// test targets covering calc.go, one of them through its execroot path
+const bazelCoverage = `SF:calc/calc.go
+FN:3,calc.Add
+FNDA:3,calc.Add
+FNF:1
+FNH:1
+BRDA:4,0,0,1
+BRDA:4,0,1,2
+BRF:2
+BRH:2
+DA:3,3
+DA:4,3
+DA:5,1
+DA:7,2
+LH:4
+LF:4
+end_of_record
+SF:/home/u/.cache/bazel/_bazel_u/0123abcd/execroot/__main__/calc/calc.go
+FN:3,calc.Add
+FNDA:1,calc.Add
+FNF:1
+FNH:1
+DA:3,1
+DA:4,1
+DA:5,0
+DA:7,1
+LH:3
+LF:4
+end_of_record
+`
+
+func TestBazelLCOVConversion(t *testing.T) {
+	profiles, err := config{}.parseBazelProfiles("coverage.dat", []byte(bazelCoverage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range profiles {
+		if profile.FileName != "calc/calc.go" {
+			t.Errorf("got file %s, want calc/calc.go", profile.FileName)
+		}
+	}
+	fsys := fstest.MapFS{"calc/calc.go": {Data: []byte(calcSource)}}
+	coverage := coberturatest.Convert(t, fsys, "example.com/m", profiles)
+	hits := map[int]int64{}
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				hits[line.Number] = line.Hits
+			}
+		}
+	}
+	if want := map[int]int64{3: 4, 4: 4, 5: 1, 7: 3}; !reflect.DeepEqual(hits, want) {
+		t.Errorf("got hits %v, want %v", hits, want)
+	}
+	if coverage.LinesValid != 4 || coverage.LinesCovered != 4 {
+		t.Errorf("got %d of %d lines covered, want 4 of 4", coverage.LinesCovered, coverage.LinesValid)
+	}
+}
+
+// calcSource is the source the LCOV records of calc/calc.go describe
+const calcSource = `package calc
+
+func Add(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	return a + b
+}
+`
+
+func TestLCOVConversionMatchesSources(t *testing.T) {
+	profiles, err := parseLCOV([]byte("SF:calc/calc.go\nDA:3,1\nDA:4,1\nDA:5,0\nDA:7,1\nend_of_record\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"calc/calc.go": {Data: []byte(calcSource)}}
+	coverage := coberturatest.Convert(t, fsys, "example.com/m", profiles)
+	if len(coverage.Mismatches) != 0 {
+		t.Errorf("got mismatches %v, want none", coverage.Mismatches)
+	}
+	if warnings := compatibilityWarnings(t.TempDir(), coverage); len(warnings) != 0 {
+		t.Errorf("got warnings %q, want none", warnings)
+	}
+}
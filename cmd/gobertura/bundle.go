@@ -0,0 +1,167 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"html/template"
+	"time"
+)
+
+// bundle collects the files of the -bundle archive: the XML report, the HTML
+// report, the JSON model, the manifest and an index linking them
+type bundle struct {
+	Rate  float64
+	Time  time.Time
+	Files []bundleFile
+}
+
+type bundleFile struct {
+	Name        string
+	Description string
+	Data        []byte
+}
+
+// reportModel is the JSON model of the bundle, the report as read by
+// templates for tools that don't read XML
+type reportModel struct {
+	Version      string
+	Timestamp    int64
+	LineRate     float64
+	BranchRate   float64
+	LinesCovered int64
+	LinesValid   int64
+	Flags        []string
+	Partial      bool
+	Packages     []*cobertura.Package
+	Unresolved   []*cobertura.Unresolved
+	LineKinds    map[string]map[int]string `json:",omitempty"`
+}
+
+// newBundle starts the bundle of coverage with the files needing all its
+// lines, before -detail trims them
+func (cfg config) newBundle(coverage *cobertura.Coverage) (*bundle, error) {
+	b := &bundle{Rate: coverage.LineRate, Time: time.UnixMilli(coverage.Timestamp)}
+	var html bytes.Buffer
+	err := writeHTML(&html, coverage, cfg.Src)
+	if err != nil {
+		return nil, err
+	}
+	b.add("coverage.html", "HTML report", html.Bytes())
+
+	model, err := json.MarshalIndent(reportModel{
+		Version:      coverage.Version,
+		Timestamp:    coverage.Timestamp,
+		LineRate:     coverage.LineRate,
+		BranchRate:   coverage.BranchRate,
+		LinesCovered: coverage.LinesCovered,
+		LinesValid:   coverage.LinesValid,
+		Flags:        coverage.Flags,
+		Partial:      coverage.Partial,
+		Packages:     coverage.Packages,
+		Unresolved:   coverage.Unresolved,
+		LineKinds:    coverage.LineKinds,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	b.add("coverage.json", "JSON model", append(model, '\n'))
+	return b, nil
+}
+
+func (b *bundle) add(name string, description string, data []byte) {
+	b.Files = append(b.Files, bundleFile{Name: name, Description: description, Data: data})
+}
+
+// archive returns the files of the bundle as a gzipped tarball, index.html
+// first
+func (b *bundle) archive() ([]byte, error) {
+	var index bytes.Buffer
+	err := bundleIndex.Execute(&index, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := append([]bundleFile{{Name: "index.html", Data: index.Bytes()}}, b.Files...)
+	for _, f := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name:    f.Name,
+			Mode:    0644,
+			Size:    int64(len(f.Data)),
+			ModTime: b.Time,
+			Format:  tar.FormatPAX,
+		})
+		if err == nil {
+			_, err = tw.Write(f.Data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tw.Close()
+	if err == nil {
+		err = gz.Close()
+	}
+	return buf.Bytes(), err
+}
+
+var bundleIndex = template.Must(template.New("index").Funcs(template.FuncMap{
+	"percent": formatPercent,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage {{percent .Rate}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td { padding: 0.2em 1em 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>Coverage {{percent .Rate}}</h1>
+<p>{{.Time.UTC.Format "2006-01-02 15:04:05 UTC"}}</p>
+<table>
+{{- range .Files}}
+<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td>{{.Description}}</td><td>{{len .Data}} bytes</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// writeBundle completes b with the XML report, report being the output when
+// it is one, and the manifest m, and writes it to -bundle
+func (cfg config) writeBundle(b *bundle, coverage *cobertura.Coverage, report []byte, m *manifest) error {
+	if cfg.Format != "xml" {
+		err := coverage.TrimDetail(cfg.Detail)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = writeXML(&buf, coverage)
+		if err != nil {
+			return err
+		}
+		report = buf.Bytes()
+	}
+	manifest, err := m.encode()
+	if err != nil {
+		return err
+	}
+	b.Files = append([]bundleFile{{Name: "coverage.xml", Description: "Cobertura report", Data: report}}, b.Files...)
+	b.add("manifest.json", "manifest of the run", manifest)
+
+	data, err := b.archive()
+	if err != nil {
+		return err
+	}
+	if isRemote(cfg.Bundle) {
+		return upload(cfg.Bundle, data)
+	}
+	return writeFile(cfg.Bundle, data, 0644)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// series is one line of a trend chart, a package missing from a snapshot
+// simply has no point at that time
+type series struct {
+	Name   string
+	Points []point
+}
+
+type point struct {
+	Time int64
+	Rate float64
+}
+
+var chartColors = []color.RGBA{
+	{31, 119, 180, 255},
+	{255, 127, 14, 255},
+	{44, 160, 44, 255},
+	{214, 39, 40, 255},
+	{148, 103, 189, 255},
+	{140, 86, 75, 255},
+	{227, 119, 194, 255},
+	{127, 127, 127, 255},
+}
+
+func historyChart(args []string) {
+	fs := flag.NewFlagSet("history chart", flag.ExitOnError)
+	location, project, branch := storeFlags(fs)
+	out := fs.String("o", "trend.svg", "output path, PNG when ending in .png, SVG otherwise")
+	var packages stringList
+	fs.Var(&packages, "package", "package to chart besides the total(can be repeated, all if not set)")
+	totalOnly := fs.Bool("total-only", false, "only chart the total, as a sparkline")
+	width := fs.Int("width", 600, "chart width in pixels")
+	height := fs.Int("height", 200, "chart height in pixels")
+	fs.Parse(args)
+
+	store, err := openStore(*location, *project, *branch)
+	if err != nil {
+		panic(err)
+	}
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		panic(err)
+	}
+	if len(snapshots) == 0 {
+		panic(errors.New("history store is empty"))
+	}
+	lines := chartSeries(snapshots, packages, *totalOnly)
+
+	var buf bytes.Buffer
+	if strings.HasSuffix(*out, ".png") {
+		err = writePNGChart(&buf, lines, *width, *height)
+	} else {
+		err = writeSVGChart(&buf, lines, *width, *height, !*totalOnly)
+	}
+	if err != nil {
+		panic(err)
+	}
+	err = writeFile(*out, buf.Bytes(), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// chartSeries returns the total followed by the selected packages
+func chartSeries(snapshots []snapshot, packages []string, totalOnly bool) []series {
+	total := series{Name: "total"}
+	byPackage := map[string]*series{}
+	for _, s := range snapshots {
+		total.Points = append(total.Points, point{s.Timestamp, s.LineRate})
+		if totalOnly {
+			continue
+		}
+		for name, rate := range s.Packages {
+			if len(packages) > 0 && !contains(packages, name) {
+				continue
+			}
+			if byPackage[name] == nil {
+				byPackage[name] = &series{Name: name}
+			}
+			byPackage[name].Points = append(byPackage[name].Points, point{s.Timestamp, rate})
+		}
+	}
+
+	var names []string
+	for name := range byPackage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []series{total}
+	for _, name := range names {
+		lines = append(lines, *byPackage[name])
+	}
+	return lines
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// chartScale maps points to pixel coordinates within the given box
+func chartScale(lines []series, left, top, width, height int) func(point) (float64, float64) {
+	minTime, maxTime := lines[0].Points[0].Time, lines[0].Points[0].Time
+	for _, line := range lines {
+		for _, p := range line.Points {
+			if p.Time < minTime {
+				minTime = p.Time
+			}
+			if p.Time > maxTime {
+				maxTime = p.Time
+			}
+		}
+	}
+	return func(p point) (float64, float64) {
+		x := float64(left) + float64(width)/2
+		if maxTime > minTime {
+			x = float64(left) + float64(p.Time-minTime)/float64(maxTime-minTime)*float64(width)
+		}
+		y := float64(top) + (1-p.Rate)*float64(height)
+		return x, y
+	}
+}
+
+func writeSVGChart(w io.Writer, lines []series, width, height int, legend bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+
+	left, top, right, bottom := 2, 2, 2, 2
+	if legend {
+		left, top, right, bottom = 40, 10, 150, 20
+		for _, rate := range []float64{0, 0.5, 1} {
+			y := float64(top) + (1-float64(rate))*float64(height-top-bottom)
+			fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n", left, y, width-right, y)
+			fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="10" font-family="sans-serif" text-anchor="end">%.0f%%</text>`+"\n", left-4, y+3, rate*100)
+		}
+	}
+	scale := chartScale(lines, left, top, width-left-right, height-top-bottom)
+
+	for i, line := range lines {
+		c := chartColors[i%len(chartColors)]
+		strokeWidth := 1.5
+		if i == 0 {
+			c, strokeWidth = color.RGBA{0, 0, 0, 255}, 2.5
+		}
+		var points []string
+		for _, p := range line.Points {
+			x, y := scale(p)
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="rgb(%d,%d,%d)" stroke-width="%.1f" points="%s"><title>%s</title></polyline>`+"\n",
+			c.R, c.G, c.B, strokeWidth, strings.Join(points, " "), xmlEscape(line.Name))
+		if legend {
+			y := top + 12*i + 8
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="3" fill="rgb(%d,%d,%d)"/>`+"\n", width-right+10, y-3, c.R, c.G, c.B)
+			last := line.Points[len(line.Points)-1]
+			fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10" font-family="sans-serif">%s %.1f%%</text>`+"\n", width-right+24, y, xmlEscape(line.Name), last.Rate*100)
+		}
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writePNGChart(w io.Writer, lines []series, width, height int) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	scale := chartScale(lines, 4, 4, width-8, height-8)
+	for i := len(lines) - 1; i >= 0; i-- {
+		c := chartColors[i%len(chartColors)]
+		if i == 0 {
+			c = color.RGBA{0, 0, 0, 255}
+		}
+		for j := 1; j < len(lines[i].Points); j++ {
+			x0, y0 := scale(lines[i].Points[j-1])
+			x1, y1 := scale(lines[i].Points[j])
+			drawLine(img, x0, y0, x1, y1, c)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// drawLine plots a straight line by sampling it every half pixel
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.RGBA) {
+	dx, dy := x1-x0, y1-y0
+	steps := int(2 * math.Max(math.Abs(dx), math.Abs(dy)))
+	for s := 0; s <= steps; s++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(s) / float64(steps)
+		}
+		img.SetRGBA(int(x0+dx*t+0.5), int(y0+dy*t+0.5), c)
+	}
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
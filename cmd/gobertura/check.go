@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkCommand fails when the line rate of a report is below a threshold, or
+// the line rate of a package below the target its doc.go declares with
+// //gobertura:target, or when a policy rule fails
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura check [flags] report.xml")
+		fs.PrintDefaults()
+	}
+	min := fs.Float64("min", 0, "minimum line rate(0-1)")
+	category := fs.String("category", "", "only check classes of this category, e.g. production(needs a report converted with -classify)")
+	withoutDeprecated := fs.Bool("exclude-deprecated", false, "leave deprecated functions out of the total checked by -min(needs a report converted with -deprecated)")
+	withoutMain := fs.Bool("exclude-main", false, "leave the files of package main out of the total checked by -min(needs a report converted with -mark-main)")
+	src := fs.String("src", ".", "module whose doc.go files declare package targets with //gobertura:target")
+	targets := fs.Bool("targets", true, "check the package targets declared in -src")
+	rulesPath := fs.String("rules", "", "path of a file of policy rules, one per line, e.g. \"package internal/payments: lines >= 90 && branches >= 75\"")
+	var ruleTexts stringList
+	fs.Var(&ruleTexts, "rule", "policy rule, e.g. \"diff: lines >= 80\" or \"total: no-decrease(0.5)\"(can be repeated)")
+	changedSince := fs.String("changed-since", "", "revision the lines checked by diff rules changed since")
+	base := fs.String("base", "", "path or URL of the report no-decrease rules compare with, $VAR being expanded from the environment")
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var rules []*rule
+	if *rulesPath != "" {
+		var err error
+		rules, err = readRules(*rulesPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, text := range ruleTexts {
+		r, err := parseRule(text)
+		if err != nil {
+			panic(err)
+		}
+		rules = append(rules, r)
+	}
+
+	coverage, err := readReport(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+
+	name, rate := "total", coverage.LineRate
+	if *category != "" {
+		name, rate = *category, 0
+		found := false
+		for _, c := range coverage.CategoryTotals() {
+			if c.Name == *category {
+				rate, found = c.LineRate, true
+			}
+		}
+		if !found {
+			panic(fmt.Errorf("no class of category %q, was the report converted with -classify?", *category))
+		}
+	}
+	if *withoutDeprecated || *withoutMain {
+		if *category != "" {
+			panic(fmt.Errorf("-exclude-deprecated and -exclude-main can't be used with -category"))
+		}
+		var without []string
+		if *withoutDeprecated {
+			if coverage.Deprecated == nil {
+				panic(fmt.Errorf("no deprecated totals, was the report converted with -deprecated?"))
+			}
+			deprecated, _ := coverage.DeprecatedTotals()
+			fmt.Printf("deprecated: %s (%d of %d lines)\n", formatPercent(deprecated.LineRate), deprecated.LinesCovered, deprecated.LinesValid)
+			without = append(without, "deprecated")
+		}
+		if *withoutMain {
+			if coverage.Entrypoints == nil {
+				panic(fmt.Errorf("no package main totals, was the report converted with -mark-main?"))
+			}
+			entrypoints := coverage.MainTotals()
+			fmt.Printf("package main: %s (%d of %d lines)\n", formatPercent(entrypoints.LineRate), entrypoints.LinesCovered, entrypoints.LinesValid)
+			without = append(without, "package main")
+		}
+		rest := coverage.TotalsWithout(func(class *cobertura.Class, method *cobertura.Method) bool {
+			if method == nil {
+				return *withoutMain && class.Main
+			}
+			return *withoutDeprecated && method.Deprecated
+		})
+		name, rate = "total without "+strings.Join(without, " and "), rest.LineRate
+	}
+
+	fmt.Printf("%s: %s (min %s)\n", name, formatPercent(rate), formatPercent(*min))
+	failed := float64(rate) < *min
+
+	if *targets {
+		explicit := false
+		fs.Visit(func(f *flag.Flag) {
+			explicit = explicit || f.Name == "src"
+		})
+		required, err := packageTargets(*src)
+		// Reports are commonly checked outside of the module they cover
+		if err != nil && (explicit || !errors.Is(err, errNoModule)) {
+			panic(err)
+		}
+		for _, pkg := range coverage.Packages {
+			target, ok := required[pkg.Name]
+			if !ok {
+				continue
+			}
+			fmt.Printf("%s: %s (target %s)\n", pkg.Name, formatPercent(pkg.LineRate), formatPercent(target))
+			if pkg.LineRate < target {
+				failed = true
+			}
+		}
+	}
+	if len(rules) > 0 {
+		var baseCov *cobertura.Coverage
+		if *base != "" {
+			baseCov, _, err = baseReport(*base, defaultBaseCache(), time.Hour)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "gobertura: no base report: %v, no-decrease rules pass\n", err)
+				baseCov = nil
+			}
+		}
+		var changed map[string]map[int]int64
+		if *changedSince != "" {
+			lines, err := changedLines(*changedSince)
+			if err != nil {
+				panic(err)
+			}
+			changed = onlyLines(fileHits(coverage), lines)
+		}
+		var added []addedFunction
+		if *changedSince != "" && usesFunctions(rules) {
+			added, err = addedFunctions(*changedSince)
+			if err != nil {
+				panic(err)
+			}
+		}
+		results, err := evalRules(rules, coverage, baseCov, changed, added)
+		if err != nil {
+			panic(err)
+		}
+		for _, r := range results {
+			fmt.Println(r)
+			failed = failed || !r.passed
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// collector merges the profiles dropped into a directory into a running
+// aggregate, re-emitting the report periodically
+type collector struct {
+	cfg     config
+	dir     string
+	pattern string
+	settle  time.Duration
+	remove  bool
+	out     string
+	profile string
+
+	// merged records the modification time of every file merged so far
+	merged    map[string]time.Time
+	aggregate []*cover.Profile
+	changed   bool
+}
+
+// collectCommand watches a drop directory of profiles, e.g. of e2e test farms
+// where many processes write profiles over hours
+func collectCommand(args []string) {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura collect [flags]")
+		fs.PrintDefaults()
+	}
+	c := &collector{merged: map[string]time.Time{}}
+	fs.StringVar(&c.dir, "dir", "", "drop directory of the profiles to merge")
+	fs.StringVar(&c.pattern, "pattern", "*.out", "file name pattern of profiles in -dir")
+	fs.DurationVar(&c.settle, "settle", 2*time.Second, "time a profile must be left unmodified before it's merged, so files being written are skipped")
+	fs.BoolVar(&c.remove, "remove", false, "delete profiles once merged")
+	fs.StringVar(&c.out, "out", "coverage.xml", "output path of the report")
+	fs.StringVar(&c.profile, "profile-out", "", "path the aggregated profile is also written to")
+	interval := fs.Duration("interval", 10*time.Second, "delay between scans of -dir")
+	emit := fs.Duration("emit", time.Minute, "delay between writes of the report, when new profiles were merged")
+	once := fs.Bool("once", false, "merge the profiles present, write the report and exit")
+	c.cfg.register(fs)
+	xmlFlags(fs)
+	fs.Parse(args)
+	if c.dir == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	err := c.cfg.resolve()
+	if err != nil {
+		panic(err)
+	}
+
+	if *once {
+		c.settle = 0
+		c.scan()
+		err = c.emit()
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	lastEmit := time.Now()
+	for {
+		c.scan()
+		if time.Since(lastEmit) >= *emit {
+			err = c.emit()
+			if err != nil {
+				log.Printf("gobertura: %v", err)
+			}
+			lastEmit = time.Now()
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// scan merges the settled profiles of the directory not merged yet
+func (c *collector) scan() {
+	paths, err := filepath.Glob(filepath.Join(c.dir, c.pattern))
+	if err != nil {
+		log.Printf("gobertura: %v", err)
+		return
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < c.settle {
+			continue
+		}
+		if modTime, ok := c.merged[path]; ok {
+			// Merging again would count the hits of the first version twice
+			if !modTime.Equal(info.ModTime()) {
+				log.Printf("gobertura: %s changed after it was merged, ignored", path)
+				c.merged[path] = info.ModTime()
+			}
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			var profiles []*cover.Profile
+			profiles, err = c.cfg.parseProfileData(path, data)
+			if err == nil {
+				c.aggregate = cobertura.MergeProfiles(append(c.aggregate, profiles...))
+				c.changed = true
+			}
+		}
+		if err != nil {
+			// Retried at the next scan, e.g. when the file was truncated
+			log.Printf("gobertura: %s: %v", path, err)
+			continue
+		}
+		c.merged[path] = info.ModTime()
+		if c.remove {
+			err = os.Remove(path)
+			if err != nil {
+				log.Printf("gobertura: %v", err)
+			}
+			delete(c.merged, path)
+		}
+	}
+}
+
+// emit writes the report of the aggregate, if it changed
+func (c *collector) emit() error {
+	if !c.changed {
+		return nil
+	}
+	coverage, err := c.cfg.coverage(c.aggregate)
+	if err != nil {
+		return err
+	}
+	coverage.RoundRates(c.cfg.Precision)
+	var buf bytes.Buffer
+	err = writeXML(&buf, coverage)
+	if err != nil {
+		return err
+	}
+	err = writeFile(c.out, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	if c.profile != "" {
+		buf.Reset()
+		err = writeProfiles(&buf, c.aggregate)
+		if err == nil {
+			err = writeFile(c.profile, buf.Bytes(), 0600)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c.changed = false
+	log.Printf("gobertura: wrote %s, %d file(s) covered at %.1f%%", c.out, len(c.aggregate), coverage.LineRate*100)
+	return nil
+}
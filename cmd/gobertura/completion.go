@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// completionScripts are the scripts printed by completion, calling back
+// gobertura __complete with the words of the command line. Without
+// candidates, the shells complete file names.
+var completionScripts = map[string]string{
+	"bash": `_gobertura() {
+	local IFS=$'\n'
+	COMPREPLY=($(gobertura __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _gobertura gobertura
+`,
+	"zsh": `#compdef gobertura
+_gobertura() {
+	local -a candidates
+	candidates=("${(@f)$(gobertura __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _gobertura gobertura
+`,
+	"fish": `function __gobertura_complete
+	set -l candidates (gobertura __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+	if test (count $candidates) -gt 0
+		printf '%s\n' $candidates
+	else
+		__fish_complete_path (commandline -ct)
+	end
+end
+complete -c gobertura -f -a '(__gobertura_complete)'
+`,
+}
+
+// completionCommand prints the completion script of a shell
+func completionCommand(args []string) {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura completion bash|zsh|fish")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || completionScripts[fs.Arg(0)] == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fmt.Print(completionScripts[fs.Arg(0)])
+}
+
+// subcommands are the words completed after the commands taking one
+var subcommands = map[string][]string{
+	"completion": {"bash", "fish", "zsh"},
+	"history":    {"add", "chart"},
+	"slo":        {"check", "report"},
+}
+
+// flagValues returns the values completed after a flag, nil for file names
+func flagValues(name string) []string {
+	switch name {
+	case "format":
+		return []string{"xml", "html", "template"}
+	case "detail":
+		return []string{cobertura.DetailPackage, cobertura.DetailClass, cobertura.DetailMethod, cobertura.DetailLine}
+	case "run-type":
+		return []string{cobertura.RunUnit, cobertura.RunFuzz, cobertura.RunBench}
+	case "preset":
+		return strings.Split(presetNames(), ", ")
+	case "xml-encoding":
+		return []string{"UTF-8", "ISO-8859-1", "US-ASCII"}
+	case "dtd":
+		return []string{"04", "03", "none"}
+	case "pkg", "package", "include":
+		packages, _ := modulePackages(".")
+		return packages
+	}
+	return nil
+}
+
+// complete prints the candidates for the last of words, the arguments typed
+// after gobertura. Flags are found by running the command with -h.
+func complete(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, previous := words[len(words)-1], words[:len(words)-1]
+	var command []string
+	if len(previous) > 0 {
+		if _, ok := commands[previous[0]]; ok {
+			command = previous[:1]
+		}
+	}
+	if len(command) == 1 && len(previous) > 1 && contains(subcommands[command[0]], previous[1]) {
+		command = previous[:2]
+	}
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(current, "-") && strings.Contains(current, "="):
+		i := strings.Index(current, "=")
+		for _, value := range flagValues(strings.TrimLeft(current[:i], "-")) {
+			candidates = append(candidates, current[:i+1]+value)
+		}
+	case len(previous) > 0 && strings.HasPrefix(previous[len(previous)-1], "-") && !strings.Contains(previous[len(previous)-1], "="):
+		name := strings.TrimLeft(previous[len(previous)-1], "-")
+		if takesValue, ok := commandFlags(command)[name]; ok && takesValue {
+			candidates = flagValues(name)
+			break
+		}
+		fallthrough
+	default:
+		if strings.HasPrefix(current, "-") {
+			for name := range commandFlags(command) {
+				candidates = append(candidates, "-"+name)
+			}
+		} else if len(previous) == 0 {
+			for name := range commands {
+				candidates = append(candidates, name)
+			}
+		} else if len(previous) == 1 && len(command) == 1 {
+			candidates = subcommands[command[0]]
+		}
+	}
+
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Println(candidate)
+		}
+	}
+}
+
+// usageFlag matches the flags listed by flag.PrintDefaults, along with the
+// type of those taking a value
+var usageFlag = regexp.MustCompile(`^  -(\S+)(?: (\S+))?`)
+
+// commandFlags returns the flags of command, the words selecting it and
+// empty for the conversion, mapped to whether they take a value
+func commandFlags(command []string) map[string]bool {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	var usage bytes.Buffer
+	cmd := exec.Command(executable, append(append([]string{}, command...), "-h")...)
+	cmd.Stderr = &usage
+	cmd.Run()
+
+	flags := map[string]bool{}
+	scanner := bufio.NewScanner(&usage)
+	for scanner.Scan() {
+		if m := usageFlag.FindStringSubmatch(scanner.Text()); m != nil {
+			flags[m[1]] = m[2] != ""
+		}
+	}
+	return flags
+}
+
+// modulePackages lists the import paths of the packages of the module
+// holding dir
+func modulePackages(dir string) ([]string, error) {
+	module, _, dirs, err := packageDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var packages []string
+	for _, d := range dirs {
+		packages = append(packages, importPath(module, d))
+	}
+	return packages, nil
+}
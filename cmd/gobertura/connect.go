@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/nim4/gocover-cobertura/api"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"net/http"
+	"strings"
+)
+
+// connectHandler serves the CoverageService of api/coverage.proto using
+// Connect unary calls with the JSON codec, the only ones supported: streams,
+// the gRPC and gRPC-Web protocols and the protobuf codec aren't
+func (s *server) connectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			connectError(w, http.StatusMethodNotAllowed, "unimplemented", "unary calls use POST")
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+		var res interface{}
+		var err *api.Error
+		switch strings.TrimPrefix(r.URL.Path, api.ServicePath) {
+		case "SubmitProfile":
+			req := &api.SubmitProfileRequest{}
+			if err = decodeConnect(r, req); err == nil {
+				res, err = s.submitProfile(r, req)
+			}
+		case "GetReport":
+			req := &api.GetReportRequest{}
+			if err = decodeConnect(r, req); err == nil {
+				res, err = s.getReport(r, req)
+			}
+		case "GetDiff":
+			req := &api.GetDiffRequest{}
+			if err = decodeConnect(r, req); err == nil {
+				res, err = s.getDiff(r, req)
+			}
+		default:
+			err = &api.Error{Code: "unimplemented", Message: r.URL.Path}
+		}
+		if err != nil {
+			connectError(w, connectStatus[err.Code], err.Code, err.Message)
+			return
+		}
+		writeJSON(w, res)
+	})
+}
+
+// connectStatus maps the Connect error codes used by the service to HTTP
+// statuses
+var connectStatus = map[string]int{
+	"invalid_argument":    http.StatusBadRequest,
+	"resource_exhausted":  http.StatusTooManyRequests,
+	"unauthenticated":     http.StatusUnauthorized,
+	"permission_denied":   http.StatusForbidden,
+	"not_found":           http.StatusNotFound,
+	"internal":            http.StatusInternalServerError,
+	"unimplemented":       http.StatusNotImplemented,
+	"failed_precondition": http.StatusBadRequest,
+}
+
+func connectError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&api.Error{Code: code, Message: message})
+}
+
+func decodeConnect(r *http.Request, req interface{}) *api.Error {
+	err := json.NewDecoder(r.Body).Decode(req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &api.Error{Code: "resource_exhausted", Message: err.Error()}
+	}
+	if err != nil {
+		return &api.Error{Code: "invalid_argument", Message: err.Error()}
+	}
+	return nil
+}
+
+// connectKey returns the namespace of project and branch, defaulting to those
+// of polled sources, if r is allowed to access it
+func (s *server) connectKey(r *http.Request, project string, branch string) ([2]string, *api.Error) {
+	if project == "" {
+		project = s.project
+	}
+	if branch == "" {
+		branch = s.branch
+	}
+	key := [2]string{project, branch}
+	if err := checkNamespace(key); err != nil {
+		return key, &api.Error{Code: "invalid_argument", Message: err.Error()}
+	}
+	switch s.access(r, project) {
+	case http.StatusUnauthorized:
+		return [2]string{}, &api.Error{Code: "unauthenticated", Message: "unknown token"}
+	case http.StatusForbidden:
+		return [2]string{}, &api.Error{Code: "permission_denied", Message: "token doesn't grant access to " + project}
+	}
+	return key, nil
+}
+
+// merged returns the merged report of key, nil if there is none yet
+func (s *server) merged(key [2]string) *cobertura.Coverage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ns := s.namespaces[key]; ns != nil {
+		return ns.merged
+	}
+	return nil
+}
+
+func (s *server) submitProfile(r *http.Request, req *api.SubmitProfileRequest) (*api.SubmitProfileResponse, *api.Error) {
+	key, e := s.connectKey(r, req.Project, req.Branch)
+	if e != nil {
+		return nil, e
+	}
+	if req.Name == "" {
+		return nil, &api.Error{Code: "invalid_argument", Message: "missing name"}
+	}
+	changed, err := s.update(key, "upload:"+req.Name, req.Profile)
+	if err == errTooManyNamespaces {
+		return nil, &api.Error{Code: "resource_exhausted", Message: err.Error()}
+	}
+	if errors.Is(err, errForeignProfile) {
+		return nil, &api.Error{Code: "failed_precondition", Message: err.Error()}
+	}
+	if err != nil {
+		return nil, &api.Error{Code: "invalid_argument", Message: err.Error()}
+	}
+	if changed {
+		err = s.publish(key)
+		if err != nil {
+			return nil, &api.Error{Code: "internal", Message: err.Error()}
+		}
+	}
+	res := &api.SubmitProfileResponse{Changed: changed}
+	if merged := s.merged(key); merged != nil {
+		res.LineRate = merged.LineRate
+	}
+	return res, nil
+}
+
+func (s *server) getReport(r *http.Request, req *api.GetReportRequest) (*api.GetReportResponse, *api.Error) {
+	key, e := s.connectKey(r, req.Project, req.Branch)
+	if e != nil {
+		return nil, e
+	}
+	merged := s.merged(key)
+	if merged == nil {
+		return nil, &api.Error{Code: "not_found", Message: "no report yet"}
+	}
+	var buf bytes.Buffer
+	err := writeXML(&buf, merged)
+	if err != nil {
+		return nil, &api.Error{Code: "internal", Message: err.Error()}
+	}
+	return &api.GetReportResponse{Report: buf.Bytes(), LineRate: merged.LineRate, Timestamp: merged.Timestamp}, nil
+}
+
+func (s *server) getDiff(r *http.Request, req *api.GetDiffRequest) (*api.GetDiffResponse, *api.Error) {
+	baseKey, e := s.connectKey(r, req.Project, req.BaseBranch)
+	if e != nil {
+		return nil, e
+	}
+	headKey, e := s.connectKey(r, req.Project, req.HeadBranch)
+	if e != nil {
+		return nil, e
+	}
+	base, head := s.merged(baseKey), s.merged(headKey)
+	if base == nil || head == nil {
+		return nil, &api.Error{Code: "not_found", Message: "no report yet for " + baseKey[1] + " or " + headKey[1]}
+	}
+	if !sameFlags(base, head) {
+		return nil, &api.Error{Code: "failed_precondition", Message: "reports belong to different partitions"}
+	}
+
+	var patch bytes.Buffer
+	err := writeCoveragePatch(&patch, baseKey[1], fileHits(base), headKey[1], fileHits(head), s.config(headKey[0]).Src)
+	if err != nil {
+		return nil, &api.Error{Code: "internal", Message: err.Error()}
+	}
+	return &api.GetDiffResponse{Patch: patch.String(), BaseLineRate: base.LineRate, HeadLineRate: head.LineRate}, nil
+}
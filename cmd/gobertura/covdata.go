@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// flushTimeout bounds the wait for the counters written by a process after
+// -flush-pid signaled it
+const flushTimeout = 10 * time.Second
+
+// covMetaMagic starts the meta-data files of runtime/coverage
+var covMetaMagic = []byte{0x00, 0x63, 0x76, 0x6d}
+
+// parseCovdata converts the coverage of a binary built with -cover, fetched
+// from -covdata-url or read from -gocoverdir, into profiles
+func (cfg config) parseCovdata() ([]*cover.Profile, error) {
+	dir := cfg.CoverDir
+	if cfg.CovdataURL != "" {
+		tmp, err := ioutil.TempDir("", "gobertura-covdata-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		err = fetchCovdata(cfg.CovdataURL, tmp)
+		if err != nil {
+			return nil, err
+		}
+		dir = tmp
+	} else if cfg.FlushPID != 0 {
+		err := flushCounters(cfg.FlushPID, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := ioutil.TempFile("", "gobertura-*.out")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	_, err = goCommand.RunGo("", "tool", "covdata", "textfmt", "-i="+dir, "-o="+f.Name())
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return cfg.parseProfileData(dir, data)
+}
+
+// fetchCovdata writes the meta-data and counters served at url, see the
+// covdebug package, into dir as a GOCOVERDIR
+func fetchCovdata(url string, dir string) error {
+	parts := map[string][]byte{}
+	for _, part := range []string{"meta", "counters"} {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		req, err := remoteRequest(http.MethodGet, url+sep+"part="+part, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := send(req)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("fetching %s %s: %s: %s", url, part, resp.Status, strings.TrimSpace(string(data)))
+		}
+		parts[part] = data
+	}
+
+	// The go tool pairs counters with meta-data by the hash in their names
+	meta := parts["meta"]
+	if len(meta) < 40 || !bytes.Equal(meta[:4], covMetaMagic) {
+		return fmt.Errorf("%s: not coverage meta-data", url)
+	}
+	hash := hex.EncodeToString(meta[24:40])
+	err := ioutil.WriteFile(filepath.Join(dir, "covmeta."+hash), meta, 0600)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("covcounters.%s.%d.%d", hash, os.Getpid(), time.Now().UnixNano())
+	return ioutil.WriteFile(filepath.Join(dir, name), parts["counters"], 0600)
+}
+
+// flushCounters signals the process pid to write its counters to dir, see
+// covdebug.FlushOnSignal, and waits for them
+func flushCounters(pid int, dir string) error {
+	start := time.Now()
+	err := signalFlush(pid)
+	if err != nil {
+		return err
+	}
+	for time.Since(start) < flushTimeout {
+		files, err := filepath.Glob(filepath.Join(dir, "covcounters.*"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err == nil && !info.ModTime().Before(start) {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("process %d wrote no counters to %s within %s", pid, dir, flushTimeout)
+}
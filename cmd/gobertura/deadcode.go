@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// deadCode returns the functions of coverage that are neither covered nor
+// referenced by any file of the module at src, tests included. References are
+// found by name, so a function is only reported when no identifier of the
+// module has its name. Exported methods, which may implement interfaces of
+// other modules, and exported functions of packages other modules can import
+// are left out.
+func deadCode(src string, coverage *cobertura.Coverage) ([]*cobertura.DeadFunction, error) {
+	uses, packages, err := moduleReferences(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []*cobertura.DeadFunction
+	for _, pkg := range coverage.Packages {
+		importable := packages[pkg.Name] != "main" && !isInternal(pkg.Name)
+		for _, class := range pkg.Classes {
+			for _, method := range class.Methods {
+				if len(method.Lines) == 0 || method.Lines.NumLinesWithHits() > 0 || uses[method.Name] > 0 {
+					continue
+				}
+				function := class.Name == "-" || method.Function
+				if function && (method.Name == "main" || method.Name == "init" || method.Name == cobertura.InitializerMethod || isExported(method.Name) && importable) {
+					continue
+				}
+				if !function && isExported(method.Name) {
+					continue
+				}
+				dead = append(dead, &cobertura.DeadFunction{Filename: class.Filename, Class: class.Name, Name: method.Name, Line: method.FirstLine})
+			}
+		}
+	}
+	sort.SliceStable(dead, func(i, j int) bool {
+		if dead[i].Filename != dead[j].Filename {
+			return dead[i].Filename < dead[j].Filename
+		}
+		return dead[i].Line < dead[j].Line
+	})
+	return dead, nil
+}
+
+// isInternal reports whether the package at path can only be imported from
+// within the module
+func isInternal(path string) bool {
+	path = filepath.ToSlash(path)
+	return path == "internal" || strings.HasPrefix(path, "internal/") || strings.Contains(path, "/internal/") || strings.HasSuffix(path, "/internal")
+}
+
+// moduleReferences counts the identifiers of the Go files of the module at
+// src, not counting function names in their declaration or in their own
+// body, and maps package directories to package names. Vendored code,
+// testdata and nested modules are skipped.
+func moduleReferences(src string) (map[string]int, map[string]string, error) {
+	uses := map[string]int{}
+	packages := map[string]string{}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != src && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); path != src && err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		dir, err := filepath.Rel(src, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(file.Name.Name, "_test") {
+			packages[dir] = file.Name.Name
+		}
+
+		skip := map[*ast.Ident]bool{}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			skip[fn.Name] = true
+			if fn.Body == nil {
+				continue
+			}
+			// Recursive calls don't keep a function alive
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && id.Name == fn.Name.Name {
+					skip[id] = true
+				}
+				return true
+			})
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && !skip[id] {
+				uses[id.Name]++
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return uses, packages, nil
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diffCommand renders the lines whose covered status changed between two
+// reports like a unified diff: "-" lines lost coverage, "+" lines gained it
+func diffCommand(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura diff [flags] old.xml new.xml")
+		fmt.Fprintln(fs.Output(), "       gobertura diff -changed-since REV [flags] new.xml")
+		fmt.Fprintln(fs.Output(), "       gobertura diff -base URL [flags] new.xml")
+		fs.PrintDefaults()
+	}
+	src := fs.String("src", "", "go source folder used to show line contents(will use current working directory if not set)")
+	out := fs.String("out", "-", "output path, - for stdout")
+	methodDrop := fs.Float64("method-drop", 0, "list methods whose line rate dropped by more than this(0-1), or that lost all coverage; 0 disables")
+	fail := fs.Bool("fail", false, "exit with status 1 when method regressions are listed")
+	ignoreFlags := fs.Bool("ignore-flags", false, "compare reports even if they are labeled with different flags")
+	changedSince := fs.String("changed-since", "", "only consider the lines changed in the working copy since this revision, summarizing their coverage")
+	renamedSince := fs.String("renames-since", "", "revision of the old report: files renamed in the working copy since then are compared with their old path")
+	base := fs.String("base", "", "path or URL of the base report when only new.xml is given, $VAR being expanded from the environment, e.g. https://ci.example.com/main/coverage.xml")
+	baseCache := fs.String("base-cache", defaultBaseCache(), "folder remote base reports are cached in, empty disables caching")
+	baseTTL := fs.Duration("base-ttl", time.Hour, "time a cached base report is reused before being fetched again")
+	signFlags(fs, false, true)
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 && (*changedSince == "" && *base == "" || fs.NArg() != 1) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	newCov, err := readReport(fs.Arg(fs.NArg() - 1))
+	if err != nil {
+		panic(err)
+	}
+	newFiles := fileHits(newCov)
+	var changed map[string]map[int]bool
+	if *changedSince != "" {
+		changed, err = changedLines(*changedSince)
+		if err != nil {
+			panic(err)
+		}
+		newFiles = onlyLines(newFiles, changed)
+	}
+	var oldCov *cobertura.Coverage
+	oldName := fs.Arg(0)
+	if fs.NArg() == 1 && *base != "" {
+		oldCov, oldName, err = baseReport(*base, *baseCache, *baseTTL)
+		if err != nil {
+			// Pipelines of new branches have no base to compare with yet
+			fmt.Fprintf(os.Stderr, "gobertura: no base report: %v, checking the coverage of all lines\n", err)
+			oldCov = nil
+		}
+	}
+	if fs.NArg() == 2 {
+		oldCov, err = readReport(fs.Arg(0))
+		if err != nil {
+			panic(err)
+		}
+	}
+	if oldCov != nil {
+		if !*ignoreFlags && !sameFlags(oldCov, newCov) {
+			panic(fmt.Errorf("reports belong to different partitions: %v and %v", oldCov.Flags, newCov.Flags))
+		}
+		if *renamedSince != "" {
+			renames, err := renamedFiles(*renamedSince)
+			if err != nil {
+				panic(err)
+			}
+			renameClasses(oldCov, renames)
+		}
+	}
+
+	var buf bytes.Buffer
+	if oldCov != nil {
+		oldFiles := fileHits(oldCov)
+		if changed != nil {
+			oldFiles = onlyLines(oldFiles, changed)
+		}
+		err = writeCoveragePatch(&buf, oldName, oldFiles, fs.Arg(fs.NArg()-1), newFiles, *src)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if changed != nil {
+		err = writeCoverageSummary(&buf, "Changed lines", newFiles)
+	} else if oldCov == nil {
+		err = writeCoverageSummary(&buf, "All lines", newFiles)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	var regressions []methodRegression
+	if *methodDrop > 0 && oldCov != nil {
+		regressions = methodRegressions(oldCov, newCov, *methodDrop)
+		err = writeMethodRegressions(&buf, regressions)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = writeFile(*out, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if *fail && len(regressions) > 0 {
+		os.Exit(1)
+	}
+}
+
+type methodRegression struct {
+	file    string
+	name    string
+	oldRate float64
+	newRate float64
+}
+
+// methodRegressions lists the methods present in both reports whose line rate
+// dropped by more than drop, or which went from covered to fully uncovered
+func methodRegressions(oldCov *cobertura.Coverage, newCov *cobertura.Coverage, drop float64) []methodRegression {
+	oldMethods := reportMethods(oldCov)
+	newMethods := reportMethods(newCov)
+
+	var regressions []methodRegression
+	for key, method := range newMethods {
+		old, ok := oldMethods[key]
+		if !ok {
+			continue
+		}
+		oldRate, newRate := old.Lines.HitRate(), method.Lines.HitRate()
+		if oldRate-newRate > drop || (oldRate > 0 && newRate == 0) {
+			name := key.name
+			// Tell apart the methods of the same name, such as init functions
+			_, repeated := newMethods[methodKey{key.file, key.name, key.signature, 1}]
+			if repeated && method.FirstLine > 0 {
+				name = fmt.Sprintf("%s (line %d)", name, method.FirstLine)
+			}
+			regressions = append(regressions, methodRegression{key.file, name, oldRate, newRate})
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].file != regressions[j].file {
+			return regressions[i].file < regressions[j].file
+		}
+		return regressions[i].name < regressions[j].name
+	})
+	return regressions
+}
+
+// methodKey identifies a method across reports, n counting the methods of the
+// file of the same name and signature before it
+type methodKey struct {
+	file      string
+	name      string
+	signature string
+	n         int
+}
+
+// reportMethods maps the methods of coverage by key, their name being
+// class.method
+func reportMethods(coverage *cobertura.Coverage) map[methodKey]*cobertura.Method {
+	methods := map[methodKey]*cobertura.Method{}
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			for _, method := range class.Methods {
+				key := methodKey{file: class.Filename, name: method.Name, signature: method.Signature}
+				if class.Name != "-" {
+					key.name = class.Name + "." + method.Name
+				}
+				for methods[key] != nil {
+					key.n++
+				}
+				methods[key] = method
+			}
+		}
+	}
+	return methods
+}
+
+func writeMethodRegressions(w io.Writer, regressions []methodRegression) error {
+	if len(regressions) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\nMethod regressions:\n")
+	if err != nil {
+		return err
+	}
+	for _, r := range regressions {
+		_, err = fmt.Fprintf(w, "\t%s\t%s\t%s → %s\n", r.file, r.name, formatPercent(r.oldRate), formatPercent(r.newRate))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedLines returns the lines changed since rev in the working copy of the
+// current directory, by path relative to it
+func changedLines(rev string) (map[string]map[int]bool, error) {
+	v, relative, err := workingCopy()
+	if err != nil {
+		return nil, err
+	}
+	changed, err := v.ChangedLines(rev)
+	if err != nil {
+		return nil, err
+	}
+	lines := map[string]map[int]bool{}
+	for name, l := range changed {
+		if rel, ok := relative(name); ok {
+			lines[rel] = l
+		}
+	}
+	return lines, nil
+}
+
+// renamedFiles returns the new path of the files renamed since rev in the
+// working copy of the current directory by their old path, relative to it
+func renamedFiles(rev string) (map[string]string, error) {
+	v, relative, err := workingCopy()
+	if err != nil {
+		return nil, err
+	}
+	renames, err := v.Renames(rev)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for from, to := range renames {
+		relFrom, okFrom := relative(from)
+		relTo, okTo := relative(to)
+		if okFrom && okTo {
+			files[relFrom] = relTo
+		}
+	}
+	return files, nil
+}
+
+// workingCopy returns the vcs of the current directory and a function making
+// paths relative to its root relative to the current directory instead,
+// reporting false for paths outside of it
+func workingCopy() (vcs, func(string) (string, bool), error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := detectVCS(wd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The working directory may be below the root, e.g. for modules of a monorepo
+	wd, err = filepath.EvalSymlinks(wd)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := filepath.EvalSymlinks(v.Root())
+	if err != nil {
+		return nil, nil, err
+	}
+	relative := func(name string) (string, bool) {
+		rel, err := filepath.Rel(wd, filepath.Join(root, name))
+		return rel, err == nil && !strings.HasPrefix(rel, "..")
+	}
+	return v, relative, nil
+}
+
+// renameClasses moves the classes of coverage in the files renamed to their
+// new path, so that they're compared with the classes found there
+func renameClasses(coverage *cobertura.Coverage, renames map[string]string) {
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			if to, ok := renames[filepath.FromSlash(class.Filename)]; ok {
+				class.Filename = filepath.ToSlash(to)
+			}
+		}
+	}
+}
+
+// onlyLines returns the hits of files restricted to the lines of keep
+func onlyLines(files map[string]map[int]int64, keep map[string]map[int]bool) map[string]map[int]int64 {
+	kept := map[string]map[int]int64{}
+	for name, hits := range files {
+		lines := keep[name]
+		if lines == nil {
+			continue
+		}
+		kept[name] = map[int]int64{}
+		for number, h := range hits {
+			if lines[number] {
+				kept[name][number] = h
+			}
+		}
+	}
+	return kept
+}
+
+// writeCoverageSummary summarizes the coverage of the lines of files, such as
+// the changed ones, listing the uncovered ones as ranges
+func writeCoverageSummary(w io.Writer, title string, files map[string]map[int]int64) error {
+	var names []string
+	var valid, covered int
+	for name, hits := range files {
+		names = append(names, name)
+		for _, h := range hits {
+			valid++
+			if h > 0 {
+				covered++
+			}
+		}
+	}
+	sort.Strings(names)
+
+	rate := 1.0
+	if valid > 0 {
+		rate = float64(covered) / float64(valid)
+	}
+	_, err := fmt.Fprintf(w, "\n%s: %d of %d covered (%s)\n", title, covered, valid, formatPercent(rate))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		for _, r := range cobertura.UncoveredLineRanges(name, files[name]) {
+			if r.StartLine == r.EndLine {
+				_, err = fmt.Fprintf(w, "\t%s:%d\n", name, r.StartLine)
+			} else {
+				_, err = fmt.Fprintf(w, "\t%s:%d-%d\n", name, r.StartLine, r.EndLine)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type lineChange struct {
+	number  int
+	oldHits int64
+	newHits int64
+}
+
+func writeCoveragePatch(w io.Writer, oldName string, oldFiles map[string]map[int]int64, newName string, newFiles map[string]map[int]int64, src string) error {
+	var names []string
+	for name := range newFiles {
+		if oldFiles[name] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var changes []lineChange
+		for number, newHits := range newFiles[name] {
+			oldHits, ok := oldFiles[name][number]
+			if ok && (oldHits > 0) != (newHits > 0) {
+				changes = append(changes, lineChange{number, oldHits, newHits})
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		sort.Slice(changes, func(i, j int) bool { return changes[i].number < changes[j].number })
+
+		source := sourceLines(name, src)
+		_, err := fmt.Fprintf(w, "--- %s\t%s\n+++ %s\t%s\n", name, oldName, name, newName)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(changes); {
+			end := start + 1
+			for end < len(changes) && changes[end].number == changes[end-1].number+1 {
+				end++
+			}
+			first, count := changes[start].number, end-start
+			_, err = fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", first, count, first, count)
+			if err != nil {
+				return err
+			}
+			for _, c := range changes[start:end] {
+				sign := "+"
+				if c.newHits == 0 {
+					sign = "-"
+				}
+				text := ""
+				if c.number <= len(source) {
+					text = source[c.number-1]
+				}
+				_, err = fmt.Fprintf(w, "%s%-6d%-16s%s\n", sign, c.number, fmt.Sprintf("%d→%d hits", c.oldHits, c.newHits), text)
+				if err != nil {
+					return err
+				}
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// sourceLines returns the lines of name, looked up relative to the working
+// directory then to src, or nil if it can't be read
+func sourceLines(name string, src string) []string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		data, err = ioutil.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			return nil
+		}
+	}
+	return strings.Split(string(data), "\n")
+}
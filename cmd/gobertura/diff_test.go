@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"reflect"
+	"testing"
+)
+
+func TestMethodRegressions(t *testing.T) {
+	report := func(initHits [2]int64, serveHits int64) *cobertura.Coverage {
+		return &cobertura.Coverage{Packages: []*cobertura.Package{{Classes: []*cobertura.Class{
+			{Name: "-", Filename: "api/server.go", Methods: []*cobertura.Method{
+				{Name: "init", Signature: "()", FirstLine: 3, Lines: cobertura.Lines{{Number: 4, Hits: initHits[0]}}},
+				{Name: "init", Signature: "()", FirstLine: 8, Lines: cobertura.Lines{{Number: 9, Hits: initHits[1]}}},
+			}},
+			{Name: "Server", Filename: "api/server.go", Methods: []*cobertura.Method{
+				{Name: "Serve", Signature: "()", FirstLine: 12, Lines: cobertura.Lines{{Number: 13, Hits: serveHits}, {Number: 14, Hits: 1}}},
+			}},
+		}}}}
+	}
+
+	for _, tt := range []struct {
+		name string
+		old  *cobertura.Coverage
+		new  *cobertura.Coverage
+		want []methodRegression
+	}{
+		{"unchanged", report([2]int64{1, 0}, 1), report([2]int64{1, 0}, 1), nil},
+		{"second init", report([2]int64{1, 1}, 1), report([2]int64{1, 0}, 1), []methodRegression{
+			{"api/server.go", "init (line 8)", 1, 0},
+		}},
+		{"first init and method", report([2]int64{1, 0}, 1), report([2]int64{0, 1}, 0), []methodRegression{
+			{"api/server.go", "Server.Serve", 1, 0.5},
+			{"api/server.go", "init (line 3)", 1, 0},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := methodRegressions(tt.old, tt.new, 0.01)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
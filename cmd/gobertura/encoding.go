@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// xmlConfig controls how Cobertura reports are serialized, for consumers
+// picky about the XML declaration or line endings
+type xmlConfig struct {
+	Encoding  string
+	Header    bool
+	CRLF      bool
+	Namespace string
+	DTD       string
+}
+
+var xmlOutput = xmlConfig{Encoding: "UTF-8", Header: true, DTD: "04"}
+
+// xmlFlags defines the flags of xmlOutput on fs
+func xmlFlags(fs *flag.FlagSet) {
+	fs.StringVar(&xmlOutput.Encoding, "xml-encoding", xmlOutput.Encoding, "encoding of XML reports: UTF-8, ISO-8859-1 or US-ASCII, other characters are written as character references")
+	fs.BoolVar(&xmlOutput.Header, "xml-header", xmlOutput.Header, "start XML reports with the XML declaration")
+	fs.BoolVar(&xmlOutput.CRLF, "crlf", xmlOutput.CRLF, "end the lines of XML reports with CRLF")
+	fs.StringVar(&xmlOutput.Namespace, "xml-namespace", "", "default namespace declared on the coverage element")
+	fs.StringVar(&xmlOutput.DTD, "dtd", xmlOutput.DTD, "version of the Cobertura DTD in the DOCTYPE of XML reports: 04, 03 or none")
+}
+
+// doctype returns the DOCTYPE declaration of the dtd version
+func doctype(dtd string) (string, error) {
+	switch dtd {
+	case "04", "03":
+		return fmt.Sprintf("<!DOCTYPE coverage SYSTEM \"http://cobertura.sourceforge.net/xml/coverage-%s.dtd\">\n", dtd), nil
+	case "none":
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported DTD version %q", dtd)
+}
+
+// charsetLimit returns the canonical name of encoding and the first rune it
+// can't represent
+func charsetLimit(encoding string) (string, rune, error) {
+	switch strings.ToUpper(encoding) {
+	case "UTF-8", "UTF8":
+		return "UTF-8", -1, nil
+	case "ISO-8859-1", "LATIN1", "LATIN-1":
+		return "ISO-8859-1", 0x100, nil
+	case "US-ASCII", "ASCII":
+		return "US-ASCII", 0x80, nil
+	}
+	return "", 0, fmt.Errorf("unsupported XML encoding %q", encoding)
+}
+
+// recode converts the UTF-8 document data to the charset limited by limit,
+// writing other runes as character references. Names are ASCII, so only
+// text and attribute values are affected.
+func recode(data []byte, limit rune) []byte {
+	if limit < 0 {
+		return data
+	}
+	var buf bytes.Buffer
+	for _, r := range string(data) {
+		switch {
+		case r < limit:
+			buf.WriteByte(byte(r))
+		default:
+			fmt.Fprintf(&buf, "&#%d;", r)
+		}
+	}
+	return buf.Bytes()
+}
+
+// charsetReader decodes the reports in the encodings written with
+// -xml-encoding, see xml.Decoder.CharsetReader
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	encoding, limit, err := charsetLimit(label)
+	if err != nil || encoding == "UTF-8" {
+		return input, err
+	}
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, b := range data {
+		if rune(b) >= limit {
+			return nil, fmt.Errorf("invalid %s byte %#x", encoding, b)
+		}
+		buf.WriteRune(rune(b))
+	}
+	return &buf, nil
+}
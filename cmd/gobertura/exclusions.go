@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exclusion is a range of lines of a file the team agreed not to count, such
+// as a legacy region, left out of the report before rates are computed
+type exclusion struct {
+	File  string `json:"file"`
+	First int    `json:"first"`
+	Last  int    `json:"last"`
+	// Lines counts the lines of the report left out by the exclusion
+	Lines int `json:"excludedLines"`
+}
+
+// readExclusions reads the exclusions of the file at path, one file per line
+// named by its path in the module, blank lines and lines starting with #
+// being ignored:
+//
+//	internal/legacy/parser.go: 120-480 excluded
+//	internal/legacy/lexer.go: 15, 40-62 excluded
+func readExclusions(path string) ([]*exclusion, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var exclusions []*exclusion
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseExclusion(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		exclusions = append(exclusions, e...)
+	}
+	return exclusions, scanner.Err()
+}
+
+// parseExclusion parses "FILE: RANGES excluded", RANGES being a comma
+// separated list of lines and FIRST-LAST ranges
+func parseExclusion(text string) ([]*exclusion, error) {
+	file, ranges, ok := strings.Cut(text, ":")
+	file = strings.TrimSpace(file)
+	if !ok || file == "" {
+		return nil, fmt.Errorf("exclusion %q: missing \"file:\"", text)
+	}
+	ranges = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(ranges), "excluded"))
+	if ranges == "" {
+		return nil, fmt.Errorf("exclusion %q: missing lines", text)
+	}
+
+	var exclusions []*exclusion
+	for _, r := range strings.Split(ranges, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(r), "-")
+		if !isRange {
+			last = first
+		}
+		e := &exclusion{File: file}
+		var err error
+		e.First, err = strconv.Atoi(strings.TrimSpace(first))
+		if err == nil {
+			e.Last, err = strconv.Atoi(strings.TrimSpace(last))
+		}
+		if err != nil || e.First < 1 || e.Last < e.First {
+			return nil, fmt.Errorf("exclusion %q: invalid lines %q", text, strings.TrimSpace(r))
+		}
+		exclusions = append(exclusions, e)
+	}
+	return exclusions, nil
+}
+
+// exclusionFilter returns the line filter dropping the lines of exclusions,
+// counting them from zero
+func exclusionFilter(exclusions []*exclusion) func(file string, line int, text string) bool {
+	byFile := map[string][]*exclusion{}
+	for _, e := range exclusions {
+		e.Lines = 0
+		byFile[e.File] = append(byFile[e.File], e)
+	}
+	return func(file string, line int, text string) bool {
+		for _, e := range byFile[filepath.ToSlash(file)] {
+			if line >= e.First && line <= e.Last {
+				e.Lines++
+				return false
+			}
+		}
+		return true
+	}
+}
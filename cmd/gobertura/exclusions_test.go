@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseExclusion(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want []*exclusion
+	}{
+		{"internal/legacy/parser.go: 120-480 excluded", []*exclusion{{File: "internal/legacy/parser.go", First: 120, Last: 480}}},
+		{"internal/legacy/lexer.go: 15, 40-62 excluded", []*exclusion{
+			{File: "internal/legacy/lexer.go", First: 15, Last: 15},
+			{File: "internal/legacy/lexer.go", First: 40, Last: 62},
+		}},
+		{"a.go: 7", []*exclusion{{File: "a.go", First: 7, Last: 7}}},
+		{" a.go :3 - 4 ,9-9excluded", []*exclusion{{File: "a.go", First: 3, Last: 4}, {File: "a.go", First: 9, Last: 9}}},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseExclusion(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExclusionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"a.go 12-20 excluded", `exclusion "a.go 12-20 excluded": missing "file:"`},
+		{": 12-20 excluded", `exclusion ": 12-20 excluded": missing "file:"`},
+		{"a.go:", `exclusion "a.go:": missing lines`},
+		{"a.go: excluded", `exclusion "a.go: excluded": missing lines`},
+		{"a.go: 20-12 excluded", `exclusion "a.go: 20-12 excluded": invalid lines "20-12"`},
+		{"a.go: 0 excluded", `exclusion "a.go: 0 excluded": invalid lines "0"`},
+		{"a.go: 12- excluded", `exclusion "a.go: 12- excluded": invalid lines "12-"`},
+		{"a.go: 1,,3 excluded", `exclusion "a.go: 1,,3 excluded": invalid lines ""`},
+		{"a.go: all excluded", `exclusion "a.go: all excluded": invalid lines "all"`},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := parseExclusion(tt.text)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadExclusions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusions.txt")
+	err := ioutil.WriteFile(path, []byte("# legacy\n\ninternal/legacy/parser.go: 120-480 excluded\n  # indented comment\na.go: 5\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readExclusions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*exclusion{{File: "internal/legacy/parser.go", First: 120, Last: 480}, {File: "a.go", First: 5, Last: 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	err = ioutil.WriteFile(path, []byte("a.go: 5\n\nb.go 6\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readExclusions(path)
+	if want := path + `:3: exclusion "b.go 6": missing "file:"`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestExclusionFilter(t *testing.T) {
+	exclusions := []*exclusion{
+		{File: "internal/legacy/lexer.go", First: 15, Last: 15},
+		{File: "internal/legacy/lexer.go", First: 40, Last: 62},
+		{File: "a.go", First: 3, Last: 4, Lines: 9},
+	}
+	keep := exclusionFilter(exclusions)
+	for _, tt := range []struct {
+		file string
+		line int
+		want bool
+	}{
+		{"internal/legacy/lexer.go", 14, true},
+		{"internal/legacy/lexer.go", 15, false},
+		{"internal/legacy/lexer.go", 16, true},
+		{"internal/legacy/lexer.go", 40, false},
+		{"internal/legacy/lexer.go", 50, false},
+		{"internal/legacy/lexer.go", 62, false},
+		{"internal/legacy/lexer.go", 63, true},
+		{filepath.FromSlash("internal/legacy/lexer.go"), 41, false},
+		{"legacy/lexer.go", 15, true},
+		{"a.go", 4, false},
+		{"b.go", 4, true},
+	} {
+		if got := keep(tt.file, tt.line, ""); got != tt.want {
+			t.Errorf("%s:%d: got %v, want %v", tt.file, tt.line, got, tt.want)
+		}
+	}
+
+	var counts []int
+	for _, e := range exclusions {
+		counts = append(counts, e.Lines)
+	}
+	if want := []int{1, 4, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("got excluded lines %v, want %v", counts, want)
+	}
+}
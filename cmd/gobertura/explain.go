@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// explainCommand prints the coverage of lines of a report, or of a profile,
+// along with the method recording them and, for profiles, the blocks they
+// were computed from
+func explainCommand(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura explain [flags] file.go:line...")
+		fs.PrintDefaults()
+	}
+	var cfg config
+	report := fs.String("report", "coverage.xml", "path or URL of the report")
+	in := fs.String("in", "", "path or URL of a profile to convert instead of reading -report, also listing its blocks")
+	cfg.register(fs)
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var coverage *cobertura.Coverage
+	var profiles []*cover.Profile
+	var err error
+	if *in != "" {
+		err = cfg.resolve()
+		if err != nil {
+			panic(err)
+		}
+		profiles, err = cfg.parseProfiles(*in)
+		if err != nil {
+			panic(err)
+		}
+		coverage, err = cfg.coverage(profiles)
+	} else {
+		coverage, err = readReport(*report)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	for _, arg := range fs.Args() {
+		file, number, err := parseFileLine(arg)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(arg)
+		explainLine(coverage, file, number)
+		for _, profile := range profiles {
+			if filepath.Clean(coverage.TrimPackagePath(profile.FileName)) != file {
+				continue
+			}
+			for _, b := range profile.Blocks {
+				if b.StartLine <= number && number <= b.EndLine {
+					fmt.Printf("\tblock %d.%d,%d.%d: %d statement(s), count %d (%s mode)\n", b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count, profile.Mode)
+				}
+			}
+		}
+	}
+}
+
+// explainLine prints the hits of line number of file and the methods of
+// coverage recording it
+func explainLine(coverage *cobertura.Coverage, file string, number int) {
+	found := false
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			if filepath.Clean(class.Filename) != file {
+				continue
+			}
+			for _, method := range class.Methods {
+				for _, line := range method.Lines {
+					if line.Number != number {
+						continue
+					}
+					found = true
+					state := "uncovered"
+					if line.Hits > 0 {
+						state = "covered"
+					}
+					fmt.Printf("\t%s, %d hit(s)\n", state, line.Hits)
+					fmt.Printf("\tpackage %s, class %s, method %s%s (line rate %s)\n", pkg.Name, class.Name, method.Name, method.Signature, formatPercent(method.LineRate))
+				}
+			}
+		}
+	}
+	if !found {
+		fmt.Println("\tno statement")
+	}
+}
+
+// parseFileLine splits a file.go:line argument
+func parseFileLine(arg string) (string, int, error) {
+	colon := strings.LastIndex(arg, ":")
+	if colon < 0 {
+		return "", 0, fmt.Errorf("expected file.go:line, got %q", arg)
+	}
+	number, err := strconv.Atoi(arg[colon+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("expected file.go:line, got %q", arg)
+	}
+	return filepath.Clean(arg[:colon]), number, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// filterProfileCommand keeps the blocks of a profile whose file matches the
+// include patterns and none of the exclude ones, working on the profile text
+// so the output can be fed to any tool
+func filterProfileCommand(args []string) {
+	fs := flag.NewFlagSet("filter-profile", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura filter-profile [flags]")
+		fs.PrintDefaults()
+	}
+	in := fs.String("in", "coverprofile.txt", "path or URL (http(s)://, s3://, gs://) of coverage profile")
+	out := fs.String("o", "-", "output path, - for stdout")
+	var includes, excludes stringList
+	fs.Var(&includes, "include", "keep files matching this pattern, a regexp or a package pattern such as internal/...(can be repeated)")
+	fs.Var(&excludes, "exclude", "drop files matching this pattern(can be repeated)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	includeRes, err := compilePatterns(includes)
+	if err != nil {
+		panic(err)
+	}
+	excludeRes, err := compilePatterns(excludes)
+	if err != nil {
+		panic(err)
+	}
+
+	path := *in
+	if isRemote(path) {
+		tmp, err := download(path)
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tmp)
+		path = tmp
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	mode := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "mode: ") {
+			// Only keep the first of concatenated profiles
+			if !mode {
+				buf.WriteString(line + "\n")
+				mode = true
+			}
+			continue
+		}
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			continue
+		}
+		file := line[:colon]
+		if len(includeRes) > 0 && !matchAny(includeRes, file) || matchAny(excludeRes, file) {
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = writeFile(*out, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// compilePatterns compiles regexps, translating package patterns containing
+// "..." so that internal/... matches any file below an internal directory
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "...") {
+			parts := strings.Split(pattern, "...")
+			for i := range parts {
+				parts[i] = regexp.QuoteMeta(parts[i])
+			}
+			pattern = `(^|/)` + strings.Join(parts, ".*")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
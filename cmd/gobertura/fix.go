@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixCommand repairs the problems reported by lint-report that can be fixed
+// from the report itself and rewrites it
+func fixCommand(args []string) {
+	fs := flag.NewFlagSet("fix", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura fix [flags] report.xml")
+		fs.PrintDefaults()
+	}
+	src := fs.String("src", "", "source root absolute filenames are made relative to, also added as <source>(the report's sources are used if not set)")
+	out := fs.String("o", "", "output path or URL (http(s)://, s3://, gs://), the report is rewritten if not set")
+	precision := fs.Int("precision", 4, "decimals rates are rounded to(-1 keeps them unrounded)")
+	xmlFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = fs.Arg(0)
+	}
+
+	report, err := readReport(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	fixed := fixReport(report, *src)
+	fixed.RoundRates(*precision)
+
+	var buf bytes.Buffer
+	err = writeXML(&buf, fixed)
+	if err != nil {
+		panic(err)
+	}
+	if isRemote(*out) {
+		err = upload(*out, buf.Bytes())
+	} else {
+		err = writeFile(*out, buf.Bytes(), 0600)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// fixReport returns report with absolute filenames made relative to src or
+// to its sources, invalid lines dropped, duplicate classes and lines merged
+// and rates and totals recomputed from line data
+func fixReport(report *cobertura.Coverage, src string) *cobertura.Coverage {
+	var roots []string
+	if src != "" {
+		roots = append(roots, src)
+	}
+	var sources []*cobertura.Source
+	for _, source := range report.Sources {
+		if path := strings.TrimSpace(source.Path); path != "" {
+			roots = append(roots, path)
+			sources = append(sources, &cobertura.Source{Path: path})
+		}
+	}
+	if src != "" && !hasSource(sources, src) {
+		sources = append(sources, &cobertura.Source{Path: src})
+	}
+	report.Sources = sources
+
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			class.Filename = relativeFilename(class.Filename, roots)
+			class.Lines = validLines(class.Lines)
+			for _, method := range class.Methods {
+				method.Lines = validLines(method.Lines)
+			}
+		}
+	}
+	// Merging a single report combines classes of the same name and file,
+	// sums the hits of repeated lines and recomputes everything
+	return cobertura.Merge(report)
+}
+
+// relativeFilename returns filename relative to the first root containing
+// it, filename if it is relative or no root contains it
+func relativeFilename(filename string, roots []string) string {
+	if !filepath.IsAbs(filename) && !strings.HasPrefix(filename, "/") {
+		return filename
+	}
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, filename)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filename
+}
+
+// validLines returns lines without the ones lacking a valid number, negative
+// hits being counted as none
+func validLines(lines cobertura.Lines) cobertura.Lines {
+	kept := cobertura.Lines{}
+	for _, line := range lines {
+		if line.Number < 1 {
+			continue
+		}
+		if line.Hits < 0 {
+			line.Hits = 0
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// hasSource reports whether sources list path
+func hasSource(sources []*cobertura.Source, path string) bool {
+	for _, source := range sources {
+		if source.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"time"
+)
+
+// fixtureShape describes the synthetic report generated by fixtures
+type fixtureShape struct {
+	packages int
+	files    int
+	methods  int
+	lines    int
+	rate     float64
+	spread   float64
+}
+
+// fixturesCommand writes a synthetic Go shaped report, for load testing the
+// tools consuming reports
+func fixturesCommand(args []string) {
+	fs := flag.NewFlagSet("fixtures", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura fixtures [flags]")
+		fs.PrintDefaults()
+	}
+	var shape fixtureShape
+	fs.IntVar(&shape.packages, "packages", 10, "number of packages")
+	fs.IntVar(&shape.files, "files", 5, "number of files per package")
+	fs.IntVar(&shape.methods, "methods", 10, "number of methods per file")
+	fs.IntVar(&shape.lines, "lines", 8, "number of lines per method")
+	fs.Float64Var(&shape.rate, "rate", 0.75, "average line rate(0-1)")
+	fs.Float64Var(&shape.spread, "spread", 0.2, "maximum deviation of the line rate of each package from -rate")
+	seed := fs.Int64("seed", 1, "random seed, the same seed and shape produce the same report")
+	out := fs.String("out", "-", "output path, - for stdout")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	coverage := generateFixture(shape, rand.New(rand.NewSource(*seed)))
+	var buf bytes.Buffer
+	err := writeXML(&buf, coverage)
+	if err != nil {
+		panic(err)
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = writeFile(*out, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func generateFixture(shape fixtureShape, r *rand.Rand) *cobertura.Coverage {
+	coverage := &cobertura.Coverage{
+		Sources:   []*cobertura.Source{{Path: "/src/example.com/fixture"}},
+		Packages:  []*cobertura.Package{},
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	for p := 0; p < shape.packages; p++ {
+		pkg := &cobertura.Package{Name: fmt.Sprintf("internal/pkg%03d", p), Classes: []*cobertura.Class{}}
+		rate := math.Min(1, math.Max(0, shape.rate+(r.Float64()*2-1)*shape.spread))
+		// Whole methods are either covered or not, and a few lines of covered
+		// methods are missed, like error branches
+		lineRate := math.Max(0.9, rate)
+		methodRate := rate / lineRate
+
+		for f := 0; f < shape.files; f++ {
+			filename := path.Join(pkg.Name, fmt.Sprintf("file%03d.go", f))
+			// Functions first, then a method per type, like gobertura classes
+			classes := map[string]*cobertura.Class{}
+			number := 1
+			for m := 0; m < shape.methods; m++ {
+				className, methodName := "-", fmt.Sprintf("Func%03d", m)
+				if m%2 == 1 {
+					className, methodName = fmt.Sprintf("Type%03d", m%7), fmt.Sprintf("Method%03d", m)
+				}
+				class := classes[className]
+				if class == nil {
+					class = &cobertura.Class{Name: className, Filename: filename, Methods: []*cobertura.Method{}, Lines: cobertura.Lines{}}
+					classes[className] = class
+					pkg.Classes = append(pkg.Classes, class)
+				}
+
+				method := &cobertura.Method{Name: methodName, Lines: cobertura.Lines{}}
+				covered := r.Float64() < methodRate
+				number += 2
+				for l := 0; l < shape.lines; l++ {
+					var hits int64
+					if covered && r.Float64() < lineRate {
+						hits = 1 + r.Int63n(100)
+					}
+					line := &cobertura.Line{Number: number, Hits: hits}
+					method.Lines = append(method.Lines, line)
+					class.Lines = append(class.Lines, line)
+					number++
+				}
+				class.Methods = append(class.Methods, method)
+			}
+		}
+		coverage.Packages = append(coverage.Packages, pkg)
+	}
+	coverage.Recompute()
+	return coverage
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// flakyReport lists the lines covered by some of repeated identical test
+// runs only, whose timing-dependent coverage makes gates unstable
+type flakyReport struct {
+	Runs []string `json:"runs"`
+	// Rates are the line rates of the runs, in the order of Runs
+	Rates []float64 `json:"rates"`
+	// Lines is the number of lines reported by any run
+	Lines int         `json:"lines"`
+	Flaky []flakyLine `json:"flaky"`
+}
+
+// flakyLine is a line along with the runs covering it
+type flakyLine struct {
+	Filename string   `json:"filename"`
+	Line     int      `json:"line"`
+	Method   string   `json:"method,omitempty"`
+	Runs     []string `json:"runs"`
+}
+
+// flakyCommand converts the profiles of repeated runs of the same tests and
+// reports the lines whose coverage varies between them
+func flakyCommand(args []string) {
+	fs := flag.NewFlagSet("flaky", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura flaky [flags] run1.out run2.out...")
+		fs.PrintDefaults()
+	}
+	var cfg config
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	fail := fs.Bool("fail", false, "exit with status 1 when a line is flaky")
+	cfg.register(fs)
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	err := cfg.resolve()
+	if err != nil {
+		panic(err)
+	}
+	r, err := flaky(cfg, fs.Args())
+	if err != nil {
+		panic(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(r)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		low, high := r.Rates[0], r.Rates[0]
+		for _, rate := range r.Rates {
+			if rate < low {
+				low = rate
+			}
+			if rate > high {
+				high = rate
+			}
+		}
+		fmt.Printf("%d of %d lines flaky across %d runs, line rate %s to %s\n", len(r.Flaky), r.Lines, len(r.Runs), formatPercent(low), formatPercent(high))
+		for _, l := range r.Flaky {
+			fmt.Printf("%s:%d\tcovered in %d/%d runs", l.Filename, l.Line, len(l.Runs), len(r.Runs))
+			if l.Method != "" {
+				fmt.Printf("\t%s", l.Method)
+			}
+			fmt.Println()
+		}
+	}
+	if *fail && len(r.Flaky) > 0 {
+		os.Exit(1)
+	}
+}
+
+// flaky converts the profiles at paths, one per run named by its path, and
+// lists the lines covered by some runs but not all. A line a run doesn't
+// report, e.g. as a test binary failed to build, counts as uncovered.
+func flaky(cfg config, paths []string) (*flakyReport, error) {
+	type line struct {
+		file   string
+		number int
+	}
+	r := &flakyReport{}
+	coveredBy := map[line][]string{}
+	methods := map[line]string{}
+	for _, path := range paths {
+		r.Runs = append(r.Runs, path)
+		profiles, err := cfg.parseProfiles(path)
+		if err != nil {
+			return nil, err
+		}
+		coverage, err := cfg.coverage(profiles)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		r.Rates = append(r.Rates, coverage.LineRate)
+		for _, pkg := range coverage.Packages {
+			for _, class := range pkg.Classes {
+				for _, method := range class.Methods {
+					name := method.Name
+					if class.Name != "-" {
+						name = class.Name + "." + method.Name
+					}
+					for _, l := range method.Lines {
+						methods[line{class.Filename, l.Number}] = name
+					}
+				}
+			}
+		}
+		for file, hits := range fileHits(coverage) {
+			for number, h := range hits {
+				key := line{file, number}
+				if _, ok := coveredBy[key]; !ok {
+					coveredBy[key] = nil
+				}
+				if h > 0 {
+					coveredBy[key] = append(coveredBy[key], path)
+				}
+			}
+		}
+	}
+
+	r.Lines = len(coveredBy)
+	for l, runs := range coveredBy {
+		if len(runs) == 0 || len(runs) == len(paths) {
+			continue
+		}
+		r.Flaky = append(r.Flaky, flakyLine{
+			Filename: l.file,
+			Line:     l.number,
+			Method:   methods[l],
+			Runs:     runs,
+		})
+	}
+	sort.Slice(r.Flaky, func(i, j int) bool {
+		a, b := r.Flaky[i], r.Flaky[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+	return r, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package main
+
+import (
+	"fmt"
+)
+
+// signalFlush fails, SIGUSR1 being unavailable on this platform
+func signalFlush(pid int) error {
+	return fmt.Errorf("-flush-pid isn't supported on this platform, use -covdata-url")
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package main
+
+import (
+	"syscall"
+)
+
+// signalFlush sends SIGUSR1 to pid, asking it to write its coverage counters
+func signalFlush(pid int) error {
+	return syscall.Kill(pid, syscall.SIGUSR1)
+}
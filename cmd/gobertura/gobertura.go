@@ -1,95 +1,723 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
 	"github.com/nim4/gocover-cobertura/cobertura"
 	"golang.org/x/tools/cover"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
-	"strings"
 	"time"
 )
 
+// config holds the conversion settings collected from the command line
+type config struct {
+	Input       string     `json:"input"`
+	Output      string     `json:"output"`
+	Src         string     `json:"src"`
+	Pkg         stringList `json:"pkg"`
+	Format      string     `json:"format"`
+	Template    string     `json:"template,omitempty"`
+	Manifest    string     `json:"manifest,omitempty"`
+	SkipMissing bool       `json:"skipMissing"`
+	Flags       stringList `json:"flags"`
+	MinHits     int64      `json:"minHits"`
+	WeightStmts bool       `json:"weightStatements"`
+	Classify    bool       `json:"classify"`
+	Bazel       bool       `json:"bazel"`
+	Platform    string     `json:"platform,omitempty"`
+	Hermetic    bool       `json:"hermetic"`
+	Lock        bool       `json:"lock"`
+	MergeOutput bool       `json:"mergeOutput"`
+	Lenient     bool       `json:"lenient"`
+	ListAssets  bool       `json:"listAssets"`
+	SkipMocks   bool       `json:"excludeMocks"`
+	Trivial     bool       `json:"excludeTrivial"`
+	ByType      bool       `json:"groupByType"`
+	UniqueClass bool       `json:"uniqueClasses"`
+	LineKinds   bool       `json:"lineKinds"`
+	DeadCode    bool       `json:"deadCode"`
+	Verify      bool       `json:"verify"`
+	VerifyWarn  bool       `json:"verifyWarn"`
+	VerifyEps   float64    `json:"verifyEpsilon"`
+	Precision   int        `json:"precision"`
+	Metadata    bool       `json:"metadata"`
+	ClampHits   int        `json:"clampHits,omitempty"`
+	BucketHits  bool       `json:"bucketHits"`
+	TestJSON    bool       `json:"testJSON"`
+	CoverProf   stringList `json:"coverProfile"`
+	RunType     string     `json:"runType,omitempty"`
+	Detail      string     `json:"detail"`
+	Overlay     string     `json:"overlay,omitempty"`
+	Exclusions  string     `json:"exclusions,omitempty"`
+	Compatible  bool       `json:"assumeCompatible"`
+	CovdataURL  string     `json:"covdataURL,omitempty"`
+	CoverDir    string     `json:"gocoverdir,omitempty"`
+	FlushPID    int        `json:"flushPID,omitempty"`
+	ModuleSum   string     `json:"moduleSummary,omitempty"`
+	Attribution string     `json:"attribution,omitempty"`
+	Incremental string     `json:"incremental,omitempty"`
+	Upload      stringList `json:"upload"`
+	Plugins     stringList `json:"uploadPlugins"`
+	Plan        bool       `json:"plan"`
+	Stats       string     `json:"stats,omitempty"`
+	Preset      string     `json:"preset,omitempty"`
+	Bundle      string     `json:"bundle,omitempty"`
+	Redact      bool       `json:"redact"`
+	StableIDs   bool       `json:"stableIDs"`
+	Deprecated  bool       `json:"deprecated"`
+	MarkMain    bool       `json:"markMain"`
+
+	// Deadline is counted from started
+	Deadline time.Duration `json:"deadline,omitempty"`
+
+	// exclusions are read from Exclusions by resolve
+	exclusions []*exclusion
+	// readSrc reads sources through -src even when the current directory
+	// holds other ones, like -hermetic does
+	readSrc bool
+}
+
+// started is when gobertura started
+var started = time.Now()
+
+// commands are the subcommands selected by the first argument, without one
+// the profile given by the flags is converted
+var commands = map[string]func(args []string){
+	"attribute":      attributeCommand,
+	"check":          checkCommand,
+	"collect":        collectCommand,
+	"completion":     completionCommand,
+	"fix":            fixCommand,
+	"fixtures":       fixturesCommand,
+	"flaky":          flakyCommand,
+	"diff":           diffCommand,
+	"explain":        explainCommand,
+	"filter-profile": filterProfileCommand,
+	"matrix":         matrixCommand,
+	"merge":          mergeCommand,
+	"prioritize":     prioritizeCommand,
+	"query":          queryCommand,
+	"self-update":    selfUpdateCommand,
+	"history":        historyCommand,
+	"impacted":       impactedCommand,
+	"lint-report":    lintReportCommand,
+	"serve":          serveCommand,
+	"slo":            sloCommand,
+	"uncovered-api":  uncoveredAPICommand,
+	"version":        versionCommand,
+	"which-tests":    whichTestsCommand,
+}
+
 func main() {
-	var (
-		flagInput  string
-		flagOutput string
-		flagSrc    string
-		flagPkg    string
-	)
-	flag.StringVar(&flagInput, "in", "coverprofile.txt", "path of coverage profile")
-	flag.StringVar(&flagOutput, "out", "coverage.xml", "output path")
-	flag.StringVar(&flagSrc, "src", "", "go source folder(will use current working directory if not set)")
-	flag.StringVar(&flagPkg, "pkg", "", "package import path(will use `go.mod` if not set)")
+	if len(os.Args) > 1 {
+		// Hidden, called by the completion scripts
+		if os.Args[1] == "__complete" {
+			complete(os.Args[2:])
+			return
+		}
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	var cfg config
+	version := flag.Bool("version", false, "print the version and exit")
+	asJSON := flag.Bool("json", false, "with -version, print the module version, VCS revision, Go version and supported formats as JSON")
+	flag.StringVar(&cfg.Input, "in", "coverprofile.txt", "path or URL (http(s)://, s3://, gs://) of coverage profile")
+	flag.BoolVar(&cfg.TestJSON, "test-json", false, "read -in as a go test -json stream, converting the -coverprofile files it references and recording the test results")
+	flag.Var(&cfg.CoverProf, "coverprofile", "with -test-json, profile written by the go test run, as its output doesn't name it(can be repeated)")
+	flag.StringVar(&cfg.CovdataURL, "covdata-url", "", "URL of the coverage snapshot of a running binary built with -cover, served by covdebug.Handler, converted instead of -in")
+	flag.StringVar(&cfg.CoverDir, "gocoverdir", "", "GOCOVERDIR of binaries built with -cover, converted instead of -in")
+	flag.IntVar(&cfg.FlushPID, "flush-pid", 0, "with -gocoverdir, send SIGUSR1 to this process and wait for it to write its counters first")
+	flag.StringVar(&cfg.Output, "out", "coverage.xml", "output path or URL (http(s)://, s3://, gs://)")
+	flag.StringVar(&cfg.Format, "format", "xml", "output format: xml, html or template")
+	flag.StringVar(&cfg.Template, "template", "", "text/template file used by -format template(html/template if its name contains .html)")
+	flag.StringVar(&cfg.Detail, "detail", "line", "deepest element of -format xml reports: package, class, method or line, totals are kept")
+	flag.BoolVar(&cfg.Plan, "plan", false, "dry run printing the files and packages the conversion would include, or why they are excluded, without parsing sources or writing output")
+	flag.BoolVar(&cfg.Lock, "lock", false, "hold a lock on -out.lock while writing, for outputs shared by concurrent runs")
+	flag.BoolVar(&cfg.MergeOutput, "merge-output", false, "merge the report with the one already at -out instead of replacing it")
+	flag.BoolVar(&cfg.Verify, "verify-against-go-tool", false, "compare the total and function rates with go tool cover -func, failing if they diverge")
+	flag.BoolVar(&cfg.VerifyWarn, "verify-warn", false, "only warn when -verify-against-go-tool finds divergences")
+	flag.Float64Var(&cfg.VerifyEps, "verify-epsilon", 0.001, "rate difference(0-1) tolerated by -verify-against-go-tool")
+	flag.BoolVar(&cfg.Metadata, "metadata", false, "record the cover mode, gobertura and Go versions and the flags used in the report")
+	flag.BoolVar(&cfg.DeadCode, "dead-code", false, "list the functions neither covered nor referenced in the module as <dead-function> elements")
+	flag.StringVar(&cfg.Attribution, "attribution", "", "attribution written by gobertura attribute, naming the tests and subtests covering every method in the report")
+	flag.StringVar(&cfg.Incremental, "incremental", "", "path or URL of a report converted earlier with -incremental, e.g. the day before, whose classes are reused for the files that didn't change")
+	flag.StringVar(&cfg.ModuleSum, "module-summary", "", "path of a JSON summary of the coverage of every module, e.g. of dependencies included with -coverpkg=all")
+	flag.StringVar(&cfg.Preset, "preset", "", "defaults suiting a CI system: gitlab, jenkins, azure or sonar, see the README")
+	flag.Var(&cfg.Upload, "upload", "publish the report with this uploader: github, gitlab, coveralls or one of -upload-plugin(can be repeated)")
+	flag.Var(&cfg.Plugins, "upload-plugin", "Go plugin registering more uploaders, built with -buildmode=plugin against the same gobertura(can be repeated)")
+	flag.BoolVar(&cfg.StableIDs, "stable-ids", false, "sort packages, classes and methods and number the methods of a class sharing a name, e.g. init#2, so reports of two builds diff cleanly")
+	flag.BoolVar(&cfg.Redact, "redact", false, "replace the paths and identifiers of the report with hashes keyed by $GOBERTURA_REDACT_KEY, for sharing it outside of the organization")
+	flag.StringVar(&cfg.Bundle, "bundle", "", "path or URL of a .tar.gz archive of the XML and HTML reports, the JSON model and the manifest, with an index")
+	flag.DurationVar(&cfg.Deadline, "deadline", 0, "stop parsing files this long after starting, reporting the remaining ones as unresolved in a partial report")
+	flag.StringVar(&cfg.Stats, "stats", "", "path of a JSON file with the sizes, timings, slowest files and memory high-water mark of the run, for build analytics")
+	flag.StringVar(&cfg.Manifest, "manifest", "", "path of an optional JSON manifest describing the run, e.g. gobertura-manifest.json")
+	cfg.register(flag.CommandLine)
+	xmlFlags(flag.CommandLine)
+	numberFlags(flag.CommandLine)
+	signFlags(flag.CommandLine, true, false)
+	flag.DurationVar(&network.Timeout, "timeout", network.Timeout, "timeout of each network request")
+	flag.IntVar(&network.Retries, "retries", network.Retries, "number of retries for failed network requests")
+	flag.DurationVar(&network.Backoff, "backoff", network.Backoff, "initial delay between retries, doubled after each attempt")
+	flag.StringVar(&network.Proxy, "proxy", "", "proxy URL for network requests(will use HTTP(S)_PROXY if not set)")
+	flag.BoolVar(&network.DryRun, "dry-run", false, "print uploads to stdout instead of sending them")
 	flag.Parse()
+	if *version {
+		printVersion(*asJSON)
+		return
+	}
+	err := cfg.applyPreset(flag.CommandLine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gobertura: %v\n", err)
+		os.Exit(2)
+	}
+
+	convert(cfg)
+}
+
+// register defines the flags controlling how profiles are converted on fs
+func (cfg *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Src, "src", "", "go source folder(will use current working directory if not set)")
+	fs.Var(&cfg.Pkg, "pkg", "package import path stripped from file names, the longest matching one if repeated(will use go.mod if not set)")
+	fs.BoolVar(&cfg.Lenient, "lenient", false, "skip malformed profile lines with a warning instead of failing")
+	fs.BoolVar(&cfg.SkipMissing, "skip-missing", false, "skip files which can't be found or parsed, listing them in the report")
+	fs.Int64Var(&cfg.MinHits, "min-hits", 0, "in count and atomic mode, lines executed fewer times are counted as uncovered")
+	fs.IntVar(&cfg.ClampHits, "clamp-hits", 0, "clamp block counts above this value, shrinking huge atomic profiles(0 keeps them)")
+	fs.BoolVar(&cfg.BucketHits, "bucket-hits", false, "round block counts down to a power of two, shrinking huge atomic profiles")
+	fs.BoolVar(&cfg.WeightStmts, "weight-statements", false, "weight rates by the statements of each line, like go test -cover")
+	fs.BoolVar(&cfg.Classify, "classify", false, "tag classes as production, test-helper or generated and report totals by category")
+	fs.StringVar(&cfg.Exclusions, "exclusions", "", "file of line ranges left out of the report, e.g. \"internal/legacy/parser.go: 120-480 excluded\"")
+	fs.StringVar(&cfg.Overlay, "overlay", "", "JSON file mapping logical file paths to the files holding their content, as for go build -overlay")
+	fs.BoolVar(&cfg.Compatible, "assume-compatible", false, "don't warn when the profile looks generated by another Go version than the sources")
+	fs.BoolVar(&cfg.Hermetic, "hermetic", false, "never run the go command or access the network and only read sources below -src, failing on features needing more")
+	fs.BoolVar(&cfg.Bazel, "bazel", false, "read the coverage.dat of bazel coverage, with workspace relative paths and no go.mod")
+	fs.StringVar(&cfg.Platform, "platform", "", "GOOS/GOARCH the profile was recorded on, kept per line by merge -platforms")
+	fs.BoolVar(&cfg.SkipMocks, "exclude-mocks", false, "leave mockgen and moq mocks out of the report, listing the methods they exercise instead")
+	fs.BoolVar(&cfg.Trivial, "exclude-trivial", false, "leave functions without branches of up to 2 lines, such as getters and setters, out of the report")
+	fs.BoolVar(&cfg.Deprecated, "deprecated", false, "mark functions documented as \"Deprecated:\" and report their coverage separately")
+	fs.BoolVar(&cfg.MarkMain, "mark-main", false, "mark the files declaring package main, e.g. below cmd/, and report their coverage separately")
+	fs.BoolVar(&cfg.ByType, "group-by-type", false, "report functions constructing or operating on a type of their file, e.g. NewFoo, in its class")
+	fs.BoolVar(&cfg.UniqueClass, "unique-classes", false, "rename classes named like a class of another file of their package after their file, e.g. \"Store (query.go)\"")
+	fs.BoolVar(&cfg.LineKinds, "line-kinds", false, "classify the lines outside of profile blocks as blank, comment or declaration, for -format html and template")
+	fs.BoolVar(&cfg.ListAssets, "list-assets", false, "list the non-Go files of covered packages, e.g. templates, as classes without lines")
+	fs.IntVar(&cfg.Precision, "precision", 4, "decimals rates are rounded to in reports(-1 keeps them unrounded)")
+	fs.Var(&cfg.Flags, "flag", "label recorded in the report, e.g. unit or integration(can be repeated)")
+	fs.StringVar(&cfg.RunType, "run-type", "", "kind of go test run of the profile: unit, fuzz or bench, recorded in the report and added to its flags")
+}
+
+// goCommand runs the go command for go list and go tool
+var goCommand cobertura.GoRunner = cobertura.GoCommand{}
 
-	convert(flagSrc, flagPkg, flagInput, flagOutput)
+// resolvers cache the module path of every module root by -hermetic
+var resolvers = [2]*cobertura.CachingResolver{
+	cobertura.NewCachingResolver(cobertura.GoResolver{Runner: goCommand}),
+	cobertura.NewCachingResolver(cobertura.GoResolver{Hermetic: true}),
 }
 
-func convert(src string, pgk string, in string, out string) {
-	if pgk == "" {
-		data, err := ioutil.ReadFile("go.mod")
+// resolve fills the package prefix and the source folder when not set
+func (cfg *config) resolve() error {
+	if cfg.Hermetic {
+		err := cfg.hermetic()
 		if err != nil {
-			panic(err)
+			return err
 		}
-
-		for _, line := range strings.Split(string(data), "\n") {
-			if strings.HasPrefix(line, "module ") {
-				pgk = strings.TrimSpace(strings.TrimPrefix(line, "module ")) + "/"
-			}
+	}
+	if len(cfg.Pkg) == 0 && !cfg.Bazel {
+		r := resolvers[0]
+		if cfg.Hermetic {
+			r = resolvers[1]
+		}
+		path, err := r.ModulePath(".")
+		if err != nil {
+			return err
 		}
+		cfg.Pkg = stringList{path + "/"}
 	}
 
-	if src == "" {
+	if cfg.Src == "" {
 		var err error
-		src, err = os.Getwd()
+		cfg.Src, err = os.Getwd()
 		if err != nil {
-			panic(err)
+			return err
+		}
+	}
+	if cfg.Redact {
+		err := cfg.checkRedact()
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Exclusions != "" {
+		var err error
+		cfg.exclusions, err = readExclusions(cfg.Exclusions)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The run type doubles as a flag, so that merge -flag tells runs apart
+	switch cfg.RunType {
+	case "":
+		return nil
+	case cobertura.RunUnit, cobertura.RunFuzz, cobertura.RunBench:
+	default:
+		return fmt.Errorf("unknown -run-type %q", cfg.RunType)
+	}
+	for _, flag := range cfg.Flags {
+		if flag == cfg.RunType {
+			return nil
 		}
 	}
+	cfg.Flags = append(cfg.Flags, cfg.RunType)
+	return nil
+}
+
+// hermetic fails when a feature enabled by cfg would run the go command,
+// access the network or read files outside of the source folder, and
+// disables the network for the rest of the run
+func (cfg config) hermetic() error {
+	network.Offline = true
+	switch {
+	case cfg.Verify:
+		return fmt.Errorf("-verify-against-go-tool runs the go command, which -hermetic forbids")
+	case isRemote(cfg.Input), isRemote(cfg.Output), len(cfg.Upload) > 0:
+		return fmt.Errorf("remote -in and -out and -upload need the network, which -hermetic forbids")
+	case cfg.CovdataURL != "", cfg.CoverDir != "":
+		return fmt.Errorf("-covdata-url and -gocoverdir run go tool covdata, which -hermetic forbids")
+	case cfg.Overlay != "":
+		return fmt.Errorf("-overlay reads files outside of -src, which -hermetic forbids")
+	case cfg.DeadCode:
+		return fmt.Errorf("-dead-code walks the source tree outside of the conversion, which -hermetic forbids")
+	case cfg.Format == "html", cfg.Bundle != "":
+		return fmt.Errorf("-format html and -bundle read sources outside of the conversion, which -hermetic forbids")
+	}
+	return nil
+}
+
+// packagePath is the first -pkg, stripped from file names with packagePaths
+func (cfg config) packagePath() string {
+	if len(cfg.Pkg) == 0 {
+		return ""
+	}
+	return cfg.Pkg[0]
+}
+
+// packagePaths are the -pkg flags after the first one
+func (cfg config) packagePaths() []string {
+	if len(cfg.Pkg) < 2 {
+		return nil
+	}
+	return cfg.Pkg[1:]
+}
 
-	profiles, err := cover.ParseProfiles(in)
+// sourceFS is the file system sources are read from, only set with
+// -hermetic so that no file outside of -src is read, or with readSrc
+func (cfg config) sourceFS() fs.FS {
+	if !cfg.Hermetic && !cfg.readSrc {
+		return nil
+	}
+	return os.DirFS(cfg.Src)
+}
+
+// coverage converts profiles according to cfg
+func (cfg config) coverage(profiles []*cover.Profile) (*cobertura.Coverage, error) {
+	coverage, err := cfg.newCoverage()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	err = coverage.ParseProfiles(profiles)
+	if err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
+
+// deadline returns when -deadline passes, the zero time without one
+func (cfg config) deadline() time.Time {
+	if cfg.Deadline <= 0 {
+		return time.Time{}
+	}
+	return started.Add(cfg.Deadline)
+}
+
+// checkRedact fails when -redact has no key, which would let common names
+// be recovered from their hash, or is used with outputs showing the sources
+// or the configuration, which it can't redact
+func (cfg config) checkRedact() error {
+	if os.Getenv("GOBERTURA_REDACT_KEY") == "" {
+		return fmt.Errorf("-redact needs a secret key in GOBERTURA_REDACT_KEY")
+	}
+	for _, output := range []struct {
+		set  bool
+		flag string
+	}{
+		{cfg.Format == "html", "-format html"},
+		{cfg.Bundle != "", "-bundle"},
+		{cfg.Manifest != "", "-manifest"},
+		{cfg.ModuleSum != "", "-module-summary"},
+	} {
+		if output.set {
+			return fmt.Errorf("-redact can't be used with %s, which shows the sources or the configuration", output.flag)
+		}
 	}
+	return nil
+}
+
+// newCoverage returns the coverage set up by cfg, before profiles are parsed
+func (cfg config) newCoverage() (*cobertura.Coverage, error) {
+	coverage := &cobertura.Coverage{
+		PackagePath: cfg.packagePath(),
+		SkipMissing: cfg.SkipMissing,
+		Flags:       cfg.Flags,
+		MinHits:     cfg.MinHits,
 
-	coverage := cobertura.Coverage{
-		PackagePath: pgk,
+		PackagePaths:     cfg.packagePaths(),
+		WeightStatements: cfg.WeightStmts,
+		Classify:         cfg.Classify,
+		Platform:         cfg.Platform,
+		RunType:          cfg.RunType,
+		ListAssets:       cfg.ListAssets,
+		ExcludeMocks:     cfg.SkipMocks,
+		ExcludeTrivial:   cfg.Trivial,
+		DetectDeprecated: cfg.Deprecated,
+		DetectMain:       cfg.MarkMain,
+		GroupByType:      cfg.ByType,
+		UniqueClasses:    cfg.UniqueClass,
+		Deadline:         cfg.deadline(),
+		ClassifyLines:    cfg.LineKinds,
+		FS:               cfg.sourceFS(),
 		Sources: []*cobertura.Source{
 			{
-				Path: src,
+				Path: cfg.Src,
 			},
 		},
 		Packages:  nil,
 		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
 	}
-	err = coverage.ParseProfiles(profiles)
+	if len(cfg.exclusions) > 0 {
+		coverage.LineFilter = exclusionFilter(cfg.exclusions)
+	}
+	if cfg.Incremental != "" {
+		// The first report of a series has nothing to reuse
+		coverage.HashSources = true
+		previous, err := readReport(cfg.Incremental)
+		if err == nil {
+			coverage.Previous = previous
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if cfg.Overlay != "" {
+		var err error
+		coverage.Overlay, err = cobertura.ReadOverlay(cfg.Overlay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return coverage, nil
+}
+
+func convert(cfg config) {
+	m := newManifest(cfg)
+
+	err := cfg.resolve()
 	if err != nil {
 		panic(err)
 	}
 
-	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY, 0600)
+	var profiles []*cover.Profile
+	var tests []*cobertura.TestPackage
+	switch {
+	case cfg.TestJSON:
+		profiles, tests, err = cfg.parseTestJSON(cfg.Input)
+	case cfg.CovdataURL != "" || cfg.CoverDir != "":
+		profiles, err = cfg.parseCovdata()
+	default:
+		profiles, err = cfg.parseProfiles(cfg.Input)
+	}
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
-	write(f, xml.Header)
-	write(f, "<!DOCTYPE coverage SYSTEM \"http://cobertura.sourceforge.net/xml/coverage-04.dtd\">\n")
+	m.step("read")
+	if cfg.Plan {
+		err = cfg.printPlan(profiles)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
 
-	encoder := xml.NewEncoder(f)
+	coverage, err := cfg.coverage(profiles)
+	if err != nil {
+		panic(err)
+	}
+	coverage.TestPackages = tests
+	if cfg.Attribution != "" {
+		a, err := readAttribution(cfg.Attribution)
+		if err != nil {
+			panic(err)
+		}
+		coverage.AddTests(a.Files)
+	}
+	printTestPackages(tests)
+	m.step("convert")
+	// Partial reports can't match go tool cover, nor is there time left
+	if cfg.Verify && !coverage.Partial {
+		divergences, err := verifyAgainstGoTool(cfg, profiles, cfg.VerifyEps)
+		if err != nil {
+			panic(err)
+		}
+		for _, d := range divergences {
+			fmt.Fprintf(os.Stderr, "gobertura: verify: %s\n", d)
+		}
+		if len(divergences) > 0 && !cfg.VerifyWarn {
+			os.Exit(1)
+		}
+		m.step("verify")
+	}
+	if !cfg.Compatible {
+		for _, warning := range compatibilityWarnings(cfg.Src, coverage) {
+			fmt.Fprintf(os.Stderr, "gobertura: %s\n", warning)
+		}
+	}
+	for _, e := range cfg.exclusions {
+		if e.Lines == 0 {
+			fmt.Fprintf(os.Stderr, "gobertura: exclusion %s: %d-%d left out no line\n", e.File, e.First, e.Last)
+		}
+	}
+	for _, u := range coverage.Unresolved {
+		fmt.Fprintf(os.Stderr, "gobertura: skipped %s: %s\n", u.Path, u.Reason)
+	}
+	if len(coverage.Unresolved) > 0 {
+		fmt.Fprintf(os.Stderr, "gobertura: %d unresolved file(s)\n", len(coverage.Unresolved))
+	}
+	if coverage.Previous != nil {
+		fmt.Fprintf(os.Stderr, "gobertura: reused the classes of %d of %d file(s) from %s\n", len(coverage.Reused), len(profiles), cfg.Incremental)
+	}
+	if coverage.Partial {
+		fmt.Fprintf(os.Stderr, "gobertura: -deadline %v exceeded, the report is partial\n", cfg.Deadline)
+	}
+	if cfg.DeadCode {
+		coverage.DeadCode, err = deadCode(cfg.Src, coverage)
+		if err != nil {
+			panic(err)
+		}
+		for _, f := range coverage.DeadCode {
+			fmt.Fprintf(os.Stderr, "gobertura: %s:%d: %s is neither covered nor referenced\n", f.Filename, f.Line, f.Name)
+		}
+	}
+	if len(coverage.Trivial) > 0 {
+		fmt.Fprintf(os.Stderr, "gobertura: excluded %d trivial function(s)\n", len(coverage.Trivial))
+	}
+	if d := coverage.Deprecated; d != nil && d.LinesValid > 0 {
+		fmt.Fprintf(os.Stderr, "gobertura: deprecated functions: %s (%d of %d lines)\n", formatPercent(d.LineRate), d.LinesCovered, d.LinesValid)
+	}
+	if e := coverage.Entrypoints; e != nil && e.LinesValid > 0 {
+		fmt.Fprintf(os.Stderr, "gobertura: package main: %s (%d of %d lines)\n", formatPercent(e.LineRate), e.LinesCovered, e.LinesValid)
+	}
+	for _, mock := range coverage.Mocks {
+		exercised := 0
+		for _, method := range mock.Methods {
+			if method.Exercised {
+				exercised++
+			}
+		}
+		note := ""
+		if mock.Dead() {
+			note = ", dead"
+		}
+		fmt.Fprintf(os.Stderr, "gobertura: mock %s of %s: %d/%d methods exercised%s\n", mock.Type, mock.Interface, exercised, len(mock.Methods), note)
+	}
+	for _, c := range coverage.Categories {
+		fmt.Fprintf(os.Stderr, "gobertura: %s: %s (%d/%d lines)\n", c.Name, formatPercent(c.LineRate), c.LinesCovered, c.LinesValid)
+	}
+
+	// Grouped before -redact hashes the files
+	warnings := cfg.warningSummary(coverage)
+	// After -dead-code, which tells init functions by name
+	if cfg.StableIDs {
+		coverage.StabilizeIDs()
+	}
+
+	if cfg.Lock && !isRemote(cfg.Output) {
+		unlock, err := lockFile(cfg.Output + ".lock")
+		if err != nil {
+			panic(err)
+		}
+		defer unlock()
+	}
+	if cfg.MergeOutput {
+		if cfg.Format != "xml" {
+			panic(fmt.Errorf("-merge-output needs -format xml"))
+		}
+		// Merging recomputes the totals from lines, which trimmed reports lack
+		if cfg.Detail != cobertura.DetailLine {
+			panic(fmt.Errorf("-merge-output needs -detail line"))
+		}
+		existing, err := readReport(cfg.Output)
+		if err == nil {
+			coverage = cobertura.Merge(existing, coverage)
+			// Merged packages follow the order of the reports
+			if cfg.StableIDs {
+				coverage.StabilizeIDs()
+			}
+		} else if !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+	coverage.RoundRates(cfg.Precision)
+	if cfg.Metadata {
+		coverage.Metadata = metadata(flag.CommandLine, profiles)
+	}
+	if cfg.Redact {
+		coverage.Redact([]byte(os.Getenv("GOBERTURA_REDACT_KEY")))
+	}
+
+	// The HTML report and JSON model of the bundle need the lines -detail trims
+	var b *bundle
+	if cfg.Bundle != "" {
+		b, err = cfg.newBundle(coverage)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	switch cfg.Format {
+	case "xml":
+		err = coverage.TrimDetail(cfg.Detail)
+		if err == nil {
+			err = writeXML(&buf, coverage)
+		}
+	case "html":
+		err = writeHTML(&buf, coverage, cfg.Src)
+	case "template":
+		err = writeTemplate(&buf, coverage, cfg.Template)
+	default:
+		err = fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if isRemote(cfg.Output) {
+		err = upload(cfg.Output, buf.Bytes())
+	} else {
+		err = writeFile(cfg.Output, buf.Bytes(), 0600)
+	}
+	if err == nil {
+		err = writeSignature(cfg.Output, buf.Bytes())
+	}
+	if err != nil {
+		panic(err)
+	}
+	m.step("write")
+
+	err = cfg.writePresetOutputs(coverage)
+	if err != nil {
+		panic(err)
+	}
+	if len(cfg.Upload) > 0 {
+		err = cfg.uploadReport(coverage, buf.Bytes())
+		if err != nil {
+			panic(err)
+		}
+		m.step("upload")
+	}
+
+	if cfg.ModuleSum != "" {
+		summary, err := cfg.moduleSummary(profiles)
+		if err != nil {
+			panic(err)
+		}
+		data, err := json.MarshalIndent(summary, "", "\t")
+		if err != nil {
+			panic(err)
+		}
+		err = writeFile(cfg.ModuleSum, append(data, '\n'), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if cfg.Stats != "" {
+		err = writeStats(cfg.Stats, m, coverage)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if cfg.Manifest != "" || b != nil {
+		m.Config = cfg.safe()
+		m.record(profiles, coverage)
+	}
+	if cfg.Manifest != "" {
+		err = m.write(cfg.Manifest)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if b != nil {
+		err = cfg.writeBundle(b, coverage, buf.Bytes(), m)
+		if err != nil {
+			panic(err)
+		}
+	}
+	printWarningSummary(warnings)
+}
+
+// writeXML writes coverage as a Cobertura report serialized as set by
+// xmlOutput
+func writeXML(w io.Writer, coverage *cobertura.Coverage) error {
+	encoding, limit, err := charsetLimit(xmlOutput.Encoding)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if xmlOutput.Header {
+		write(&buf, fmt.Sprintf("<?xml version=\"1.0\" encoding=\"%s\"?>\n", encoding))
+	}
+	declaration, err := doctype(xmlOutput.DTD)
+	if err != nil {
+		return err
+	}
+	write(&buf, declaration)
+
+	if xmlOutput.Namespace != "" {
+		c := *coverage
+		c.Extra = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: xmlOutput.Namespace}}
+		for _, attr := range coverage.Extra {
+			if attr.Name.Space != "" || attr.Name.Local != "xmlns" {
+				c.Extra = append(c.Extra, attr)
+			}
+		}
+		coverage = &c
+	}
+	encoder := xml.NewEncoder(&buf)
 	encoder.Indent("", "\t")
 	err = encoder.Encode(coverage)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	write(&buf, "\n")
 
-	write(f, "\n")
+	data := recode(buf.Bytes(), limit)
+	if xmlOutput.CRLF {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	_, err = w.Write(data)
+	return err
 }
 
-func write(f *os.File, str string) {
-	_, err := fmt.Fprintf(f, str)
+func write(w io.Writer, str string) {
+	_, err := fmt.Fprintf(w, str)
 	if err != nil {
 		panic(err)
 	}
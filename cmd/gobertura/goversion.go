@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goDirectives returns the go and toolchain directives of the go.mod in src,
+// empty if missing
+func goDirectives(src string) (goVersion string, toolchain string) {
+	data, err := ioutil.ReadFile(filepath.Join(src, "go.mod"))
+	if err != nil {
+		return "", ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			goVersion = fields[1]
+		case "toolchain":
+			toolchain = fields[1]
+		}
+	}
+	return goVersion, toolchain
+}
+
+// compatibilityWarnings returns the signs that the profile converted into
+// coverage was generated by a Go version other than the one of the sources
+// in src, or that gobertura is too old to parse them
+func compatibilityWarnings(src string, coverage *cobertura.Coverage) []string {
+	goVersion, toolchain := goDirectives(src)
+	expected := "the sources"
+	if goVersion != "" {
+		expected = "go.mod's go " + goVersion
+	}
+	if toolchain != "" {
+		expected += " (toolchain " + toolchain + ")"
+	}
+
+	var warnings []string
+	var files []string
+	for file := range coverage.Mismatches {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		warnings = append(warnings, fmt.Sprintf("%s: %d block(s) fall outside of the source", file, coverage.Mismatches[file]))
+	}
+	if len(files) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the profile was likely generated from other sources or by a Go version other than %s, -assume-compatible silences this", expected))
+	}
+
+	required := goVersion
+	if toolchain != "" {
+		required = strings.TrimPrefix(toolchain, "go")
+	}
+	if required != "" && olderGo(runtime.Version(), required) {
+		warnings = append(warnings, fmt.Sprintf("built with %s, older than %s, newer syntax may not parse", runtime.Version(), expected))
+	}
+	return warnings
+}
+
+// olderGo reports whether the Go release version, e.g. go1.21.3, is older
+// than the go.mod version required, e.g. 1.22. Unknown versions aren't.
+func olderGo(version string, required string) bool {
+	a, okA := goRelease(strings.TrimPrefix(version, "go"))
+	b, okB := goRelease(required)
+	if !okA || !okB {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// goRelease parses the numbers of a Go version like 1.21.3 or 1.22rc1, the
+// pre-release counting as the release
+func goRelease(v string) ([3]int, bool) {
+	var numbers [3]int
+	if i := strings.IndexAny(v, "rb -"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return numbers, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return numbers, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"sort"
+)
+
+// snapshot is the summary of one report kept in the history store
+type snapshot struct {
+	Timestamp int64              `json:"timestamp"`
+	LineRate  float64            `json:"lineRate"`
+	Flags     []string           `json:"flags,omitempty"`
+	Packages  map[string]float64 `json:"packages"`
+}
+
+func newSnapshot(coverage *cobertura.Coverage) snapshot {
+	s := snapshot{
+		Timestamp: coverage.Timestamp,
+		LineRate:  coverage.LineRate,
+		Flags:     coverage.Flags,
+		Packages:  map[string]float64{},
+	}
+	for _, pkg := range coverage.Packages {
+		s.Packages[pkg.Name] = pkg.LineRate
+	}
+	return s
+}
+
+// historyCommand records reports over time and charts the trend
+func historyCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: gobertura history add|chart [flags]")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	switch args[0] {
+	case "add":
+		historyAdd(args[1:])
+	case "chart":
+		historyChart(args[1:])
+	default:
+		usage()
+	}
+}
+
+// storeFlags defines the flags selecting a history store on fs
+func storeFlags(fs *flag.FlagSet) (location *string, project *string, branch *string) {
+	location = fs.String("store", "gobertura-history.jsonl", "path, s3:// or gs:// URL, or sqlite:// or postgres:// database of the history store")
+	project = fs.String("project", "default", "project of the history in a database store")
+	branch = fs.String("branch", "main", "branch of the history in a database store")
+	return location, project, branch
+}
+
+// appendSnapshot adds s to the JSON lines history file at path
+func appendSnapshot(path string, s snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSnapshots returns the snapshots of the history file at path, oldest first
+func readSnapshots(path string) ([]snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshots []snapshot
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var s snapshot
+		err = json.Unmarshal(scanner.Bytes(), &s)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Timestamp < snapshots[j].Timestamp })
+	return snapshots, nil
+}
+
+func historyAdd(args []string) {
+	fs := flag.NewFlagSet("history add", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura history add [flags] report.xml")
+		fs.PrintDefaults()
+	}
+	location, project, branch := storeFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	coverage, err := readReport(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	store, err := openStore(*location, *project, *branch)
+	if err != nil {
+		panic(err)
+	}
+	err = store.Add(newSnapshot(coverage))
+	if err != nil {
+		panic(err)
+	}
+}
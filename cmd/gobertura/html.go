@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+type htmlPackage struct {
+	Name  string
+	Rate  float64
+	Files []*htmlFile
+}
+
+type htmlFile struct {
+	ID        string
+	Name      string
+	Rate      float64
+	Functions []htmlFunction
+	Lines     []htmlLine
+}
+
+type htmlFunction struct {
+	// Anchor is the id of the line of the function, empty if none is its own
+	Anchor string
+	Name   string
+	Rate   float64
+}
+
+type htmlLine struct {
+	Number int
+	Text   string
+	// Class is "cov", "uncov" or empty for lines without coverage data
+	Class string
+	// Kind is the cobertura.LineKinds kind of lines outside of profile blocks
+	Kind   string
+	Hits   int64
+	Anchor string
+}
+
+// writeHTML renders every file of coverage with its lines highlighted, like
+// `go tool cover -html`, plus a sidebar to navigate packages and functions.
+// Sources are looked up relative to the working directory, then to src.
+func writeHTML(w io.Writer, coverage *cobertura.Coverage, src string) error {
+	var packages []*htmlPackage
+	for _, pkg := range coverage.Packages {
+		hp := &htmlPackage{Name: pkg.Name, Rate: pkg.LineRate}
+		files := map[string]*htmlFile{}
+		hits := map[string]map[int]int64{}
+		anchors := map[string]map[int]string{}
+		for _, class := range pkg.Classes {
+			file := files[class.Filename]
+			if file == nil {
+				file = &htmlFile{ID: anchorName(class.Filename), Name: class.Filename}
+				files[class.Filename] = file
+				hits[class.Filename] = map[int]int64{}
+				anchors[class.Filename] = map[int]string{}
+				hp.Files = append(hp.Files, file)
+			}
+			for _, method := range class.Methods {
+				name := method.Name
+				if class.Name != "-" {
+					name = class.Name + "." + method.Name
+				}
+				fn := htmlFunction{Name: name, Rate: method.LineRate}
+				// Anchor every function on its declaration, or else the first
+				// line it covers; functions without a free line aren't linked
+				line := method.FirstLine
+				if line == 0 && len(method.Lines) > 0 {
+					line = method.Lines[0].Number
+				}
+				if line > 0 && anchors[class.Filename][line] == "" {
+					fn.Anchor = file.ID + "-" + anchorName(name)
+					anchors[class.Filename][line] = fn.Anchor
+				}
+				file.Functions = append(file.Functions, fn)
+			}
+			for _, line := range class.Lines {
+				hits[class.Filename][line.Number] = line.Hits
+			}
+		}
+
+		for _, file := range hp.Files {
+			data, err := ioutil.ReadFile(file.Name)
+			if err != nil {
+				data, err = ioutil.ReadFile(filepath.Join(src, file.Name))
+				if err != nil {
+					return err
+				}
+			}
+			file.Lines = htmlLines(data, hits[file.Name], anchors[file.Name])
+			for i := range file.Lines {
+				file.Lines[i].Kind = coverage.LineKinds[file.Name][file.Lines[i].Number]
+			}
+
+			var covered int
+			for _, h := range hits[file.Name] {
+				if h > 0 {
+					covered++
+				}
+			}
+			if len(hits[file.Name]) > 0 {
+				file.Rate = float64(covered) / float64(len(hits[file.Name]))
+			}
+		}
+		packages = append(packages, hp)
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Rate     float64
+		Packages []*htmlPackage
+	}{coverage.LineRate, packages})
+}
+
+func htmlLines(data []byte, hits map[int]int64, anchors map[int]string) []htmlLine {
+	text := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	lines := make([]htmlLine, len(text))
+	for i, t := range text {
+		lines[i] = htmlLine{Number: i + 1, Text: t, Anchor: anchors[i+1]}
+		if h, ok := hits[i+1]; ok {
+			lines[i].Hits = h
+			lines[i].Class = "uncov"
+			if h > 0 {
+				lines[i].Class = "cov"
+			}
+		}
+	}
+	return lines
+}
+
+// anchorName turns name into something usable as an HTML id
+func anchorName(name string) string {
+	return strings.NewReplacer("/", "-", ".", "-", " ", "-").Replace(name)
+}
+
+var htmlTemplate = template.Must(template.New("html").Funcs(template.FuncMap{
+	"percent": formatPercent,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage {{percent .Rate}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; display: flex; }
+nav { width: 22em; height: 100vh; overflow-y: auto; position: sticky; top: 0; background: #f5f5f5; padding: 0.5em; box-sizing: border-box; font-size: 0.9em; }
+nav ul { list-style: none; padding-left: 1em; margin: 0.2em 0; }
+nav a { text-decoration: none; color: #333; }
+nav .rate { float: right; color: #666; }
+main { flex: 1; overflow-x: auto; }
+section { border-bottom: 1px solid #ddd; }
+h2 { font-size: 1em; background: #eee; margin: 0; padding: 0.5em; position: sticky; top: 0; }
+pre { margin: 0; font-size: 0.85em; }
+pre span { display: block; padding-left: 0.5em; }
+pre span i { display: inline-block; width: 4em; color: #999; font-style: normal; user-select: none; }
+.cov { background: #dfd; color: #060; }
+.uncov { background: #fdd; color: #900; }
+pre span:not(.cov):not(.uncov) { color: #888; }
+.comment { font-style: italic; }
+</style>
+</head>
+<body>
+<nav>
+<strong>Total</strong><span class="rate">{{percent .Rate}}</span>
+<ul>
+{{- range .Packages}}
+<li><strong>{{.Name}}</strong><span class="rate">{{percent .Rate}}</span>
+<ul>
+{{- range .Files}}
+<li><a href="#{{.ID}}">{{.Name}}</a><span class="rate">{{percent .Rate}}</span>
+<ul>
+{{- range .Functions}}
+<li>{{if .Anchor}}<a href="#{{.Anchor}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}<span class="rate">{{percent .Rate}}</span></li>
+{{- end}}
+</ul>
+</li>
+{{- end}}
+</ul>
+</li>
+{{- end}}
+</ul>
+</nav>
+<main>
+{{- range .Packages}}
+{{- range .Files}}
+<section id="{{.ID}}">
+<h2>{{.Name}} ({{percent .Rate}})</h2>
+<pre>
+{{- range .Lines}}
+<span{{with .Anchor}} id="{{.}}"{{end}}{{with .Class}} class="{{.}}"{{end}}{{if .Class}} title="{{.Hits}} hits"{{end}}{{with .Kind}} class="{{.}}" title="{{.}}"{{end}}><i>{{.Number}}</i>{{.Text}}</span>
+{{- end}}
+</pre>
+</section>
+{{- end}}
+{{- end}}
+</main>
+</body>
+</html>
+`))
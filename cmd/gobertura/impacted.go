@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// impactedCommand prints the tests covering lines changed since a base
+// revision, according to an attribution written by gobertura attribute
+func impactedCommand(args []string) {
+	fs := flag.NewFlagSet("impacted", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura impacted [flags]")
+		fs.PrintDefaults()
+	}
+	base := fs.String("base", "origin/main", "revision changes are computed from")
+	path := fs.String("attribution", "attribution.json", "path of the attribution written by gobertura attribute")
+	allIfUnknown := fs.Bool("all-if-unknown", false, "print every test when a changed Go file has no attribution, e.g. a new file")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := readAttribution(*path)
+	if err != nil {
+		panic(err)
+	}
+	changed, err := changedLines(*base)
+	if err != nil {
+		panic(err)
+	}
+
+	tests, unknown := impactedTests(a, changed)
+	for _, name := range unknown {
+		fmt.Fprintf(os.Stderr, "gobertura: %s has no attribution\n", name)
+	}
+	if len(unknown) > 0 && *allIfUnknown {
+		tests = a.Tests
+	}
+	for _, test := range tests {
+		fmt.Println(test)
+	}
+}
+
+// impactedTests returns the sorted tests covering changed lines, and the
+// changed Go files, other than tests, missing from the attribution
+func impactedTests(a *attribution, changed map[string]map[int]bool) (tests []string, unknown []string) {
+	impacted := map[string]bool{}
+	for name, lines := range changed {
+		attributed, ok := a.Files[name]
+		if !ok {
+			if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+		for number := range lines {
+			for _, test := range attributed[number] {
+				impacted[test] = true
+			}
+		}
+	}
+	for test := range impacted {
+		tests = append(tests, test)
+	}
+	sort.Strings(tests)
+	sort.Strings(unknown)
+	return tests, unknown
+}
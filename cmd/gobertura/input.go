@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"os"
+)
+
+// parseProfiles parses the coverage profile at path, which can either be a
+// local file or a remote object (see isRemote)
+func (cfg config) parseProfiles(path string) ([]*cover.Profile, error) {
+	name := path
+	if isRemote(path) {
+		tmp, err := download(path)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp)
+		path = tmp
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.parseProfileData(name, data)
+}
+
+// parseProfileData parses the profile data read from name, compacting it
+// when -clamp-hits or -bucket-hits is set
+func (cfg config) parseProfileData(name string, data []byte) ([]*cover.Profile, error) {
+	var profiles []*cover.Profile
+	var err error
+	if cfg.Bazel {
+		profiles, err = cfg.parseBazelProfiles(name, data)
+	} else {
+		profiles, err = cfg.parseGoProfiles(name, data)
+	}
+	if err != nil || cfg.ClampHits == 0 && !cfg.BucketHits {
+		return profiles, err
+	}
+
+	// Compacted counts must not fall below -min-hits, which would uncover lines
+	if cfg.MinHits > 1 && cfg.BucketHits {
+		return nil, fmt.Errorf("-bucket-hits can't be used with -min-hits")
+	}
+	if cfg.ClampHits > 0 && int64(cfg.ClampHits) < cfg.MinHits {
+		return nil, fmt.Errorf("-clamp-hits can't be below -min-hits")
+	}
+	cobertura.CompactProfiles(profiles, cfg.ClampHits, cfg.BucketHits)
+	return profiles, nil
+}
+
+// parseGoProfiles parses the go test -coverprofile data read from name. When
+// lenient, malformed lines are skipped with a warning.
+func (cfg config) parseGoProfiles(name string, data []byte) ([]*cover.Profile, error) {
+	if !cfg.Lenient {
+		profiles, err := cobertura.ParseProfile(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return profiles, nil
+	}
+
+	profiles, warnings, err := cobertura.ParseProfileLenient(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "gobertura: %s: skipped %v\n", name, warning)
+	}
+	return profiles, nil
+}
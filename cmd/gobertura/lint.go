@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lintProblem is an issue found in a report, with how to fix it
+type lintProblem struct {
+	Where   string
+	Problem string
+	Fix     string
+}
+
+// lintReportCommand checks Cobertura reports of any tool for the problems
+// commonly making CI plugins reject them
+func lintReportCommand(args []string) {
+	fs := flag.NewFlagSet("lint-report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura lint-report [flags] report.xml...")
+		fs.PrintDefaults()
+	}
+	epsilon := fs.Float64("epsilon", 0.005, "rate difference tolerated between a rate and the one of its line data")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		data, err := readReportData(path)
+		if err != nil {
+			panic(err)
+		}
+		problems, err := lintReport(data, *epsilon)
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", path, err))
+		}
+		for _, p := range problems {
+			fmt.Printf("%s: %s: %s\n\tfix: %s\n", path, p.Where, p.Problem, p.Fix)
+		}
+		failed = failed || len(problems) > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lintReport checks the report encoded in data. Rates are compared with the
+// ones recomputed from line data by Recompute on a second copy.
+func lintReport(data []byte, epsilon float64) ([]lintProblem, error) {
+	var report, expected cobertura.Coverage
+	err := cobertura.UnmarshalRaw(data, &report)
+	if err != nil {
+		return nil, err
+	}
+	err = cobertura.UnmarshalRaw(data, &expected)
+	if err != nil {
+		return nil, err
+	}
+	expected.Recompute()
+
+	var problems []lintProblem
+	add := func(where string, problem string, fix string) {
+		problems = append(problems, lintProblem{where, problem, fix})
+	}
+	checkRate := func(where string, name string, rate float64, want float64) {
+		switch {
+		case math.IsNaN(rate) || math.IsInf(rate, 0):
+			add(where, fmt.Sprintf("%s is %v", name, rate), "write 0 for elements without lines, gobertura fix recomputes rates")
+		case rate < 0 || rate > 1:
+			add(where, fmt.Sprintf("%s %v is out of 0-1", name, rate), "write rates as fractions, not percentages")
+		case math.Abs(rate-want) > epsilon:
+			add(where, fmt.Sprintf("%s %v doesn't match its line data (%.4f)", name, rate, want), "recompute the rates from the lines, e.g. with gobertura fix")
+		}
+	}
+
+	if len(report.Sources) == 0 {
+		add("coverage", "no <source>", "list the directories filenames are relative to in <sources>, e.g. with gobertura fix -src DIR")
+	}
+	for _, source := range report.Sources {
+		if strings.TrimSpace(source.Path) == "" {
+			add("coverage", "empty <source>", "remove it or set it to the source root")
+		}
+	}
+	checkRate("coverage", "line-rate", report.LineRate, expected.LineRate)
+	checkRate("coverage", "branch-rate", report.BranchRate, expected.BranchRate)
+	if report.LinesValid != expected.LinesValid || report.LinesCovered != expected.LinesCovered {
+		add("coverage", fmt.Sprintf("lines-covered/lines-valid %d/%d don't match the lines (%d/%d)", report.LinesCovered, report.LinesValid, expected.LinesCovered, expected.LinesValid),
+			"recompute the totals from the lines, e.g. with gobertura fix")
+	}
+
+	for i, pkg := range report.Packages {
+		wantPkg := expected.Packages[i]
+		where := fmt.Sprintf("package %q", pkg.Name)
+		checkRate(where, "line-rate", pkg.LineRate, wantPkg.LineRate)
+		checkRate(where, "branch-rate", pkg.BranchRate, wantPkg.BranchRate)
+
+		classes := map[[2]string]bool{}
+		for j, class := range pkg.Classes {
+			wantClass := wantPkg.Classes[j]
+			where := fmt.Sprintf("class %q", class.Filename)
+			switch {
+			case class.Filename == "":
+				add(fmt.Sprintf("class %q", class.Name), "no filename", "set the path of the file relative to a <source>")
+			case filepath.IsAbs(class.Filename) || strings.HasPrefix(class.Filename, "/") || len(class.Filename) > 2 && class.Filename[1] == ':':
+				add(where, "absolute filename", "make it relative to a <source>, many viewers only resolve relative paths; gobertura fix -src DIR does")
+			}
+			key := [2]string{class.Name, class.Filename}
+			if classes[key] {
+				add(where, fmt.Sprintf("class %q listed twice", class.Name), "merge the lines of the duplicate classes, e.g. with gobertura fix")
+			}
+			classes[key] = true
+			checkRate(where, "line-rate", class.LineRate, wantClass.LineRate)
+			checkRate(where, "branch-rate", class.BranchRate, wantClass.BranchRate)
+
+			numbers := map[int]bool{}
+			for _, line := range class.Lines {
+				if line.Number < 1 {
+					add(where, fmt.Sprintf("line number %d", line.Number), "drop lines without a valid number, e.g. with gobertura fix")
+				} else if numbers[line.Number] {
+					add(where, fmt.Sprintf("line %d listed twice", line.Number), "sum the hits of the duplicate lines, e.g. with gobertura fix")
+				}
+				if line.Hits < 0 {
+					add(where, fmt.Sprintf("line %d has %d hits", line.Number, line.Hits), "write 0 hits for uncovered lines")
+				}
+				numbers[line.Number] = true
+			}
+			for k, method := range class.Methods {
+				where := fmt.Sprintf("method %q of class %q", method.Name, class.Filename)
+				checkRate(where, "line-rate", method.LineRate, wantClass.Methods[k].LineRate)
+			}
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,31 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockFile blocks until it creates path exclusively, returning the function
+// removing it. Without flock a crashed run leaves the lock behind, so waiting
+// gives up after a minute.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(time.Minute)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is still locked, remove it if no other run is writing", path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"time"
+)
+
+// manifest is a machine-readable description of a conversion run. Config
+// holds the resolved settings, Flags the flags set on the command line, both
+// without the credentials and tokens of URLs.
+type manifest struct {
+	Inputs     []string                `json:"inputs"`
+	Files      []string                `json:"files"`
+	Unresolved []*cobertura.Unresolved `json:"unresolved"`
+	Exclusions []*exclusion            `json:"exclusions,omitempty"`
+	Timings    []timing                `json:"timings"`
+	Totals     totals                  `json:"totals"`
+	Config     config                  `json:"config"`
+	Flags      map[string]string       `json:"flags"`
+	start      time.Time
+	last       time.Time
+}
+
+type timing struct {
+	Step     string  `json:"step"`
+	Duration float64 `json:"durationMs"`
+}
+
+type totals struct {
+	Packages     int     `json:"packages"`
+	Classes      int     `json:"classes"`
+	Methods      int     `json:"methods"`
+	LinesValid   int64   `json:"linesValid"`
+	LinesCovered int64   `json:"linesCovered"`
+	LineRate     float64 `json:"lineRate"`
+}
+
+func newManifest(cfg config) *manifest {
+	now := time.Now()
+	m := &manifest{
+		Inputs: []string{safeArg(cfg.Input)},
+		Config: cfg.safe(),
+		Flags:  map[string]string{},
+		start:  now,
+		last:   now,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		m.Flags[f.Name] = safeFlag(f)
+	})
+	return m
+}
+
+// safe returns cfg without the userinfo and queries of its URLs
+func (cfg config) safe() config {
+	cfg.Input, cfg.Output, cfg.CovdataURL = safeArg(cfg.Input), safeArg(cfg.Output), safeArg(cfg.CovdataURL)
+	return cfg
+}
+
+// step records the time spent since the previous step
+func (m *manifest) step(name string) {
+	now := time.Now()
+	m.Timings = append(m.Timings, timing{Step: name, Duration: milliseconds(now.Sub(m.last))})
+	m.last = now
+}
+
+// record fills the input files and the report totals
+func (m *manifest) record(profiles []*cover.Profile, cov *cobertura.Coverage) {
+	m.Files = []string{}
+	for _, profile := range profiles {
+		m.Files = append(m.Files, profile.FileName)
+	}
+	m.Unresolved = cov.Unresolved
+	if m.Unresolved == nil {
+		m.Unresolved = []*cobertura.Unresolved{}
+	}
+	m.Exclusions = m.Config.exclusions
+
+	m.Totals = reportTotals(cov)
+}
+
+// reportTotals counts the elements and lines of cov
+func reportTotals(cov *cobertura.Coverage) totals {
+	t := totals{
+		Packages:     len(cov.Packages),
+		LinesValid:   cov.LinesValid,
+		LinesCovered: cov.LinesCovered,
+		LineRate:     cov.LineRate,
+	}
+	for _, pkg := range cov.Packages {
+		t.Classes += len(pkg.Classes)
+		for _, class := range pkg.Classes {
+			t.Methods += len(class.Methods)
+		}
+	}
+	return t
+}
+
+func (m *manifest) write(path string) error {
+	data, err := m.encode()
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data, 0600)
+}
+
+// encode returns the JSON encoding of the manifest, ending the timings with
+// the total duration of the run the first time
+func (m *manifest) encode() ([]byte, error) {
+	if n := len(m.Timings); n == 0 || m.Timings[n-1].Step != "total" {
+		m.Timings = append(m.Timings, timing{Step: "total", Duration: milliseconds(time.Since(m.start))})
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// coverageMatrix tells which suites cover which packages, and which lines
+// are only covered by expensive suites
+type coverageMatrix struct {
+	Suites   []string        `json:"suites"`
+	Cheap    []string        `json:"cheap"`
+	Packages []matrixPackage `json:"packages"`
+	// ExpensiveOnly are the lines covered by no cheap suite
+	ExpensiveOnly []matrixLine `json:"expensiveOnly"`
+}
+
+// matrixPackage holds the rates of a package by suite, in the order of
+// coverageMatrix.Suites, -1 when a suite doesn't report the package
+type matrixPackage struct {
+	Name          string    `json:"name"`
+	Rates         []float64 `json:"rates"`
+	ExpensiveOnly int       `json:"expensiveOnly"`
+}
+
+// matrixLine is a line along with the suites covering it
+type matrixLine struct {
+	Filename string   `json:"filename"`
+	Line     int      `json:"line"`
+	Suites   []string `json:"suites"`
+}
+
+// matrixCommand compares the reports of several test suites, named after
+// their files, to guide rebalancing the test pyramid
+func matrixCommand(args []string) {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura matrix [flags] unit.xml integration.xml...")
+		fs.PrintDefaults()
+	}
+	var cheap stringList
+	fs.Var(&cheap, "cheap", "suite considered cheap, named after its report file(can be repeated, the first report if not set)")
+	asJSON := fs.Bool("json", false, "write the matrix as JSON")
+	lines := fs.Bool("lines", false, "list the lines covered by expensive suites only")
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var suites []string
+	var reports []*cobertura.Coverage
+	for _, path := range fs.Args() {
+		report, err := readReport(path)
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", path, err))
+		}
+		suites = append(suites, suiteName(path))
+		reports = append(reports, report)
+	}
+	if len(cheap) == 0 {
+		cheap = stringList{suites[0]}
+	}
+	m, err := matrix(suites, reports, cheap)
+	if err != nil {
+		panic(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(m)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	fmt.Printf("package\t%s\texpensive-only\n", strings.Join(m.Suites, "\t"))
+	for _, pkg := range m.Packages {
+		fmt.Print(pkg.Name)
+		for _, rate := range pkg.Rates {
+			if rate < 0 {
+				fmt.Print("\t-")
+			} else {
+				fmt.Printf("\t%s", formatPercent(rate))
+			}
+		}
+		fmt.Printf("\t%d\n", pkg.ExpensiveOnly)
+	}
+	if *lines {
+		for _, l := range m.ExpensiveOnly {
+			fmt.Printf("%s:%d\t%s\n", l.Filename, l.Line, strings.Join(l.Suites, ", "))
+		}
+	}
+}
+
+// suiteName names the suite of the report at path after its file name
+func suiteName(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// matrix computes the coverage matrix of reports, suites naming them
+func matrix(suites []string, reports []*cobertura.Coverage, cheap []string) (*coverageMatrix, error) {
+	isCheap := map[string]bool{}
+	for _, name := range cheap {
+		isCheap[name] = true
+	}
+	for _, name := range cheap {
+		found := false
+		for _, suite := range suites {
+			found = found || suite == name
+		}
+		if !found {
+			return nil, fmt.Errorf("no report of the cheap suite %q", name)
+		}
+	}
+
+	type line struct {
+		file   string
+		number int
+	}
+	type counts struct{ covered, valid int64 }
+	byPackage := map[string][]counts{}
+	packageOf := map[string]string{}
+	coveredBy := map[line][]string{}
+	for i, report := range reports {
+		for _, pkg := range report.Packages {
+			if byPackage[pkg.Name] == nil {
+				byPackage[pkg.Name] = make([]counts, len(reports))
+			}
+			c := &byPackage[pkg.Name][i]
+			for _, class := range pkg.Classes {
+				packageOf[class.Filename] = pkg.Name
+				for _, l := range class.Lines {
+					c.valid++
+					if l.Hits > 0 {
+						c.covered++
+						key := line{class.Filename, l.Number}
+						coveredBy[key] = append(coveredBy[key], suites[i])
+					}
+				}
+			}
+		}
+	}
+
+	m := &coverageMatrix{Suites: suites, Cheap: cheap, ExpensiveOnly: []matrixLine{}}
+	expensive := map[string]int{}
+	for l, by := range coveredBy {
+		cheaply := false
+		for _, suite := range by {
+			cheaply = cheaply || isCheap[suite]
+		}
+		if !cheaply {
+			m.ExpensiveOnly = append(m.ExpensiveOnly, matrixLine{Filename: l.file, Line: l.number, Suites: by})
+			expensive[packageOf[l.file]]++
+		}
+	}
+	sort.Slice(m.ExpensiveOnly, func(i, j int) bool {
+		a, b := m.ExpensiveOnly[i], m.ExpensiveOnly[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+
+	var names []string
+	for name := range byPackage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := matrixPackage{Name: name, ExpensiveOnly: expensive[name]}
+		for _, c := range byPackage[name] {
+			rate := -1.0
+			if c.valid > 0 {
+				rate = float64(c.covered) / float64(c.valid)
+			}
+			pkg.Rates = append(pkg.Rates, rate)
+		}
+		m.Packages = append(m.Packages, pkg)
+	}
+	return m, nil
+}
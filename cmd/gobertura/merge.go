@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"strings"
+)
+
+// mergeCommand combines Cobertura reports from any tool into a single one.
+// With -flag only reports of the given partitions are merged.
+func mergeCommand(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura merge [flags] report.xml...")
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", "coverage.xml", "output path or URL (http(s)://, s3://, gs://)")
+	var flags stringList
+	fs.Var(&flags, "flag", "only merge reports labeled with this flag(can be repeated)")
+	platforms := fs.Bool("platforms", false, "keep the hits of every line by platform and list lines covered on some platforms only")
+	precision := fs.Int("precision", 4, "decimals rates are rounded to(-1 keeps them unrounded)")
+	xmlFlags(fs)
+	signFlags(fs, true, true)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var reports []*cobertura.Coverage
+	for _, path := range fs.Args() {
+		report, err := readReport(path)
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", path, err))
+		}
+		if !hasFlags(report, flags) {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		panic(fmt.Errorf("no report labeled with %s", flags.String()))
+	}
+	var merged *cobertura.Coverage
+	if *platforms {
+		merged = cobertura.MergePlatforms(reports...)
+		for _, gap := range merged.PlatformGaps() {
+			fmt.Fprintf(os.Stderr, "gobertura: %s:%d covered on %s, not on %s\n", gap.Filename, gap.Line, strings.Join(gap.CoveredOn, ", "), strings.Join(gap.UncoveredOn, ", "))
+		}
+	} else {
+		merged = cobertura.Merge(reports...)
+	}
+	merged.RoundRates(*precision)
+
+	var buf bytes.Buffer
+	err := writeXML(&buf, merged)
+	if err != nil {
+		panic(err)
+	}
+	if isRemote(*out) {
+		err = upload(*out, buf.Bytes())
+	} else {
+		err = writeFile(*out, buf.Bytes(), 0600)
+	}
+	if err == nil {
+		err = writeSignature(*out, buf.Bytes())
+	}
+	if err != nil {
+		panic(err)
+	}
+}
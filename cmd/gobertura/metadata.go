@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// metadata describes the conversion of profiles with the flags set on fs
+func metadata(fs *flag.FlagSet, profiles []*cover.Profile) *cobertura.Metadata {
+	m := &cobertura.Metadata{
+		Tool:      "gobertura",
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		m.Tool += " " + info.Main.Version
+	}
+	if len(profiles) > 0 {
+		m.Mode = profiles[0].Mode
+	}
+	fs.Visit(func(f *flag.Flag) {
+		m.Args = append(m.Args, fmt.Sprintf("-%s=%s", f.Name, safeFlag(f)))
+	})
+	return m
+}
+
+// safeFlag returns the value of f passed through safeArg, item by item for
+// lists
+func safeFlag(f *flag.Flag) string {
+	list, ok := f.Value.(*stringList)
+	if !ok {
+		return safeArg(f.Value.String())
+	}
+	return strings.Join(safeArgs(*list), ",")
+}
+
+// safeArgs passes every value through safeArg
+func safeArgs(values []string) []string {
+	var safe []string
+	for _, v := range values {
+		safe = append(safe, safeArg(v))
+	}
+	return safe
+}
+
+// safeArg returns the flag value without the userinfo, query and fragment of
+// URLs, which commonly carry passwords and presigned tokens
+func safeArg(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	u.User, u.RawQuery, u.Fragment, u.ForceQuery = nil, "", "", false
+	return u.String()
+}
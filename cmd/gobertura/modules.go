@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// moduleCoverage is the coverage of the packages of a module, or of the
+// standard library as std, included with -coverpkg
+type moduleCoverage struct {
+	Module     string  `json:"module"`
+	Version    string  `json:"version,omitempty"`
+	Main       bool    `json:"main,omitempty"`
+	Statements int64   `json:"statements"`
+	Covered    int64   `json:"covered"`
+	Coverage   float64 `json:"coverage"`
+}
+
+// module is a module of the build list
+type module struct {
+	Path    string
+	Version string
+	Main    bool
+}
+
+// moduleSummary returns the statement coverage of profiles by module, main
+// module first, then by path
+func (cfg config) moduleSummary(profiles []*cover.Profile) ([]*moduleCoverage, error) {
+	modules, err := buildList(cfg.Hermetic)
+	if err != nil {
+		return nil, err
+	}
+	byPath := map[string]*moduleCoverage{}
+	for _, profile := range cobertura.MergeProfiles(profiles) {
+		m := owner(modules, profile.FileName)
+		c := byPath[m.Path]
+		if c == nil {
+			c = &moduleCoverage{Module: m.Path, Version: m.Version, Main: m.Main}
+			byPath[m.Path] = c
+		}
+		for _, b := range profile.Blocks {
+			c.Statements += int64(b.NumStmt)
+			if b.Count > 0 {
+				c.Covered += int64(b.NumStmt)
+			}
+		}
+	}
+
+	var summary []*moduleCoverage
+	for _, c := range byPath {
+		if c.Statements > 0 {
+			c.Coverage = float64(c.Covered) / float64(c.Statements)
+		}
+		summary = append(summary, c)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Main != summary[j].Main {
+			return summary[i].Main
+		}
+		return summary[i].Module < summary[j].Module
+	})
+	return summary, nil
+}
+
+// owner returns the module of the longest path prefixing the import path
+// fileName. Other import paths without a dot in their first element, like
+// those of the standard library, belong to std and the remaining files, e.g.
+// absolute paths, to the main module.
+func owner(modules []module, fileName string) module {
+	var best *module
+	for i, m := range modules {
+		if strings.HasPrefix(fileName, m.Path+"/") && (best == nil || len(m.Path) > len(best.Path)) {
+			best = &modules[i]
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	first := strings.SplitN(fileName, "/", 2)[0]
+	if !filepath.IsAbs(fileName) && !strings.Contains(first, ".") {
+		return module{Path: "std"}
+	}
+	for _, m := range modules {
+		if m.Main {
+			return m
+		}
+	}
+	return module{Path: "std"}
+}
+
+// buildList returns the modules of the build, from go list -m all or, when
+// hermetic or without a go command, from the module and require directives
+// of go.mod
+func buildList(hermetic bool) ([]module, error) {
+	if !hermetic {
+		out, err := goCommand.RunGo("", "list", "-m", "-json", "all")
+		if err == nil {
+			var modules []module
+			decoder := json.NewDecoder(bytes.NewReader(out))
+			for decoder.More() {
+				var m module
+				err = decoder.Decode(&m)
+				if err != nil {
+					return nil, err
+				}
+				modules = append(modules, m)
+			}
+			return modules, nil
+		}
+	}
+
+	data, err := ioutil.ReadFile("go.mod")
+	if err != nil {
+		return nil, err
+	}
+	var modules []module
+	inRequire := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) == 2:
+			modules = append(modules, module{Path: fields[0], Version: fields[1]})
+		case fields[0] == "module" && len(fields) == 2:
+			modules = append(modules, module{Path: fields[1], Main: true})
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) == 3:
+			modules = append(modules, module{Path: fields[1], Version: fields[2]})
+		}
+	}
+	return modules, nil
+}
+
+// errNoModule is returned by packageDirs outside of a module
+var errNoModule = errors.New("no go.mod in the directory or its parents")
+
+// packageDirs returns the path and root of the module holding dir and the
+// directories of its packages relative to root, found from the directories
+// holding Go files without loading them. Vendored code, testdata and nested
+// modules are skipped.
+func packageDirs(dir string) (module string, root string, dirs []string, err error) {
+	root, err = filepath.Abs(dir)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			break
+		}
+		if filepath.Dir(root) == root {
+			return "", "", nil, fmt.Errorf("%s: %w", dir, errNoModule)
+		}
+		root = filepath.Dir(root)
+	}
+	module, err = cobertura.GoResolver{Hermetic: true}.ModulePath(root)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); path != root && err == nil {
+			return filepath.SkipDir
+		}
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ".go") && !strings.HasSuffix(file.Name(), "_test.go") {
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, filepath.ToSlash(rel))
+				break
+			}
+		}
+		return nil
+	})
+	return module, root, dirs, err
+}
+
+// importPath returns the import path of the package at dir, relative to the
+// root of module
+func importPath(module string, dir string) string {
+	if dir == "." {
+		return module
+	}
+	return module + "/" + dir
+}
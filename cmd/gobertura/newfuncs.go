@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// addedFunction is a function declared in the working copy but not in the
+// revision it is compared with
+type addedFunction struct {
+	// File is relative to the current directory, like the files of reports
+	File  string
+	Name  string
+	First int
+	Last  int
+}
+
+func (f addedFunction) String() string {
+	return fmt.Sprintf("%s:%d %s", f.File, f.First, f.Name)
+}
+
+// addedFunctions returns the functions and methods added to the Go files of
+// the working copy of the current directory since rev, told apart by
+// comparing the declarations of every changed file with those it had in
+// rev, or under its old name when it was renamed. Functions whose signature
+// or body changed aren't added; files of tests are skipped.
+func addedFunctions(rev string) ([]addedFunction, error) {
+	v, relative, err := workingCopy()
+	if err != nil {
+		return nil, err
+	}
+	changed, err := v.ChangedLines(rev)
+	if err != nil {
+		return nil, err
+	}
+	renames, err := v.Renames(rev)
+	if err != nil {
+		return nil, err
+	}
+	oldNames := map[string]string{}
+	for from, to := range renames {
+		oldNames[to] = from
+	}
+
+	var added []addedFunction
+	for name := range changed {
+		rel, ok := relative(name)
+		if !ok || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(v.Root(), name))
+		if err != nil {
+			return nil, err
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, name, data, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		old := name
+		if from, ok := oldNames[name]; ok {
+			old = from
+		}
+		known := map[string]bool{}
+		data, err = v.FileAt(rev, old)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			// A file that didn't parse in rev had no functions to compare with
+			if oldFile, err := parser.ParseFile(token.NewFileSet(), old, data, 0); err == nil {
+				for _, decl := range oldFile.Decls {
+					if fn, ok := decl.(*ast.FuncDecl); ok {
+						known[funcKey(fn)] = true
+					}
+				}
+			}
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || known[funcKey(fn)] {
+				continue
+			}
+			added = append(added, addedFunction{
+				File:  filepath.ToSlash(rel),
+				Name:  funcKey(fn),
+				First: fset.Position(fn.Pos()).Line,
+				Last:  fset.Position(fn.End()).Line,
+			})
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		a, b := added[i], added[j]
+		return a.File < b.File || a.File == b.File && a.First < b.First
+	})
+	return added, nil
+}
+
+// funcKey names the function fn, prefixed by the type of its receiver for
+// methods, e.g. Store.Get
+func funcKey(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.IndexListExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + fn.Name.Name
+		}
+		return fn.Name.Name
+	}
+}
+
+// uncoveredFunctions returns the functions of added having lines in the
+// report, whose hits are given by file, none of them covered
+func uncoveredFunctions(added []addedFunction, hits map[string]map[int]int64) []addedFunction {
+	var uncovered []addedFunction
+	for _, f := range added {
+		lines, covered := 0, false
+		for line, h := range hits[f.File] {
+			if line >= f.First && line <= f.Last {
+				lines++
+				covered = covered || h > 0
+			}
+		}
+		if lines > 0 && !covered {
+			uncovered = append(uncovered, f)
+		}
+	}
+	return uncovered
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// numberConfig controls how percentages are written in human readable
+// outputs, such as summaries, HTML reports and templates. XML reports and
+// the lines CI systems parse, like the ones of -preset, keep 83.3%.
+type numberConfig struct {
+	// Locale picks the decimal separator, e.g. de_DE; auto reads it from
+	// LC_ALL, LC_NUMERIC or LANG
+	Locale string
+	// Rounding is round or floor, which never shows 80.0% for 79.99%
+	Rounding string
+}
+
+var numbers = numberConfig{Locale: os.Getenv("GOBERTURA_LOCALE"), Rounding: "round"}
+
+// numberFlags defines the flags of numbers on fs
+func numberFlags(fs *flag.FlagSet) {
+	fs.StringVar(&numbers.Locale, "locale", numbers.Locale, "locale of the percentages of human readable outputs, e.g. de_DE, auto for LC_ALL, LC_NUMERIC or LANG(defaults to $GOBERTURA_LOCALE)")
+	fs.Func("rounding", "rounding of the percentages of human readable outputs: round or floor(default round)", func(s string) error {
+		if s != "round" && s != "floor" {
+			return fmt.Errorf("unknown rounding %q", s)
+		}
+		numbers.Rounding = s
+		return nil
+	})
+}
+
+// formatPercent formats rate, 0-1, as a percentage with one decimal
+func formatPercent(rate float64) string {
+	value := rate * 100
+	if numbers.Rounding == "floor" {
+		// Tolerate the error of rates like 0.29, 28.999999999999996%
+		value = math.Floor(value*10+1e-9) / 10
+	}
+	s := strconv.FormatFloat(value, 'f', 1, 64)
+	if numbers.decimalComma() {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s + "%"
+}
+
+// commaLanguages are the languages writing decimals with a comma
+var commaLanguages = map[string]bool{
+	"bg": true, "ca": true, "cs": true, "da": true, "de": true, "el": true,
+	"es": true, "et": true, "eu": true, "fi": true, "fr": true, "gl": true,
+	"hr": true, "hu": true, "id": true, "is": true, "it": true, "lt": true,
+	"lv": true, "nb": true, "nl": true, "nn": true, "no": true, "pl": true,
+	"pt": true, "ro": true, "ru": true, "sk": true, "sl": true, "sr": true,
+	"sv": true, "tr": true, "uk": true, "vi": true,
+}
+
+// decimalComma reports whether the locale writes decimals with a comma
+func (c numberConfig) decimalComma() bool {
+	locale := c.Locale
+	if locale == "auto" {
+		locale = ""
+		for _, env := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+			if v := os.Getenv(env); v != "" {
+				locale = v
+				break
+			}
+		}
+	}
+	// de_DE.UTF-8, de-CH or de_DE@euro
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	lang, region, _ := strings.Cut(strings.ToLower(strings.ReplaceAll(locale, "-", "_")), "_")
+	// Switzerland writes decimals with a point in every language
+	return commaLanguages[lang] && region != "ch"
+}
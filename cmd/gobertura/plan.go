@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/tools/cover"
+	"os"
+)
+
+// printPlan prints the files of profiles the conversion would include or
+// exclude, with the reason, followed by the totals on stderr
+func (cfg config) printPlan(profiles []*cover.Profile) error {
+	coverage, err := cfg.newCoverage()
+	if err != nil {
+		return err
+	}
+	files, err := coverage.Plan(profiles)
+	if err != nil {
+		return err
+	}
+
+	included, excluded := 0, 0
+	packages := map[string]bool{}
+	for _, file := range files {
+		status, reason := "include", file.Reason
+		if file.Included {
+			included++
+			packages[file.Package] = true
+		} else {
+			status = "exclude"
+			excluded++
+			if file.Missing && !cfg.SkipMissing {
+				reason += " (fails without -skip-missing)"
+			}
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", status, file.Name, file.Package, reason)
+	}
+	fmt.Fprintf(os.Stderr, "gobertura: %d file(s) in %d package(s) included, %d excluded\n", included, len(packages), excluded)
+	return nil
+}
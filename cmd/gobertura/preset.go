@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// preset bundles the settings suiting a CI system or report consumer
+type preset struct {
+	// srcEnv is the environment variable holding the checkout, used as -src
+	srcEnv string
+	// dtd is the default of -dtd
+	dtd string
+	// summary prints the totals the way the CI system picks them up
+	summary func(w io.Writer, coverage *cobertura.Coverage)
+	// extra writes an additional output, at -out with the suffix replaced by
+	// extraSuffix
+	extra       func(w io.Writer, coverage *cobertura.Coverage) error
+	extraSuffix string
+}
+
+// presets are the values of -preset
+var presets = map[string]preset{
+	// Matched by the job's coverage keyword: coverage: '/^coverage: \d+\.\d+% of lines/'
+	"gitlab": {
+		srcEnv: "CI_PROJECT_DIR",
+		dtd:    "04",
+		summary: func(w io.Writer, coverage *cobertura.Coverage) {
+			fmt.Fprintf(w, "coverage: %.2f%% of lines\n", coverage.LineRate*100)
+		},
+	},
+	"jenkins": {
+		srcEnv: "WORKSPACE",
+		dtd:    "04",
+		summary: func(w io.Writer, coverage *cobertura.Coverage) {
+			fmt.Fprintf(w, "Coverage: %.2f%% (%d/%d lines)\n", coverage.LineRate*100, coverage.LinesCovered, coverage.LinesValid)
+		},
+	},
+	// Logging commands exposing the totals as pipeline variables
+	"azure": {
+		srcEnv: "BUILD_SOURCESDIRECTORY",
+		dtd:    "04",
+		summary: func(w io.Writer, coverage *cobertura.Coverage) {
+			fmt.Fprintf(w, "##vso[task.setvariable variable=gobertura.lineRate]%g\n", coverage.LineRate)
+			fmt.Fprintf(w, "##vso[task.setvariable variable=gobertura.linesCovered]%d\n", coverage.LinesCovered)
+			fmt.Fprintf(w, "##vso[task.setvariable variable=gobertura.linesValid]%d\n", coverage.LinesValid)
+		},
+	},
+	// SonarQube doesn't read Cobertura reports for Go, but its generic format
+	"sonar": {
+		srcEnv:      "SONAR_PROJECT_BASE_DIR",
+		dtd:         "none",
+		extra:       writeSonar,
+		extraSuffix: ".sonar.xml",
+	},
+}
+
+// presetNames lists the values of -preset
+func presetNames() string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyPreset sets the defaults of cfg.Preset for the flags of fs that
+// weren't given
+func (cfg *config) applyPreset(fs *flag.FlagSet) error {
+	if cfg.Preset == "" {
+		return nil
+	}
+	p, ok := presets[cfg.Preset]
+	if !ok {
+		return fmt.Errorf("unknown -preset %q, expected one of %s", cfg.Preset, presetNames())
+	}
+	// The extra outputs list lines, which trimmed reports lack
+	if p.extra != nil && cfg.Detail != cobertura.DetailLine {
+		return fmt.Errorf("-preset %s needs -detail line", cfg.Preset)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if !set["src"] && p.srcEnv != "" && os.Getenv(p.srcEnv) != "" {
+		cfg.Src = os.Getenv(p.srcEnv)
+	}
+	if !set["dtd"] && p.dtd != "" {
+		xmlOutput.DTD = p.dtd
+	}
+	return nil
+}
+
+// writePresetOutputs writes the extra output of the preset of cfg and prints
+// its summary
+func (cfg config) writePresetOutputs(coverage *cobertura.Coverage) error {
+	p := presets[cfg.Preset]
+	if p.extra != nil {
+		var buf bytes.Buffer
+		err := p.extra(&buf, coverage)
+		if err != nil {
+			return err
+		}
+		out := strings.TrimSuffix(cfg.Output, path.Ext(cfg.Output)) + p.extraSuffix
+		if isRemote(out) {
+			err = upload(out, buf.Bytes())
+		} else {
+			err = writeFile(out, buf.Bytes(), 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if p.summary != nil {
+		p.summary(os.Stdout, coverage)
+	}
+	return nil
+}
+
+// writeSonar writes the lines of coverage in the generic test coverage format
+// of SonarQube
+func writeSonar(w io.Writer, coverage *cobertura.Coverage) error {
+	type line struct {
+		Number  int  `xml:"lineNumber,attr"`
+		Covered bool `xml:"covered,attr"`
+	}
+	type file struct {
+		Path  string `xml:"path,attr"`
+		Lines []line `xml:"lineToCover"`
+	}
+	report := struct {
+		XMLName xml.Name `xml:"coverage"`
+		Version int      `xml:"version,attr"`
+		Files   []file   `xml:"file"`
+	}{Version: 1}
+
+	files := fileHits(coverage)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := file{Path: name}
+		var numbers []int
+		for number := range files[name] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		for _, number := range numbers {
+			f.Lines = append(f.Lines, line{Number: number, Covered: files[name][number] > 0})
+		}
+		report.Files = append(report.Files, f)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	err := encoder.Encode(report)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// priority is the rank of a test in the order reaching full coverage fastest
+type priority struct {
+	Test string `json:"test"`
+	// Lines is the number of lines covered by the test, Unique those covered
+	// by no other test and New those not covered by the tests ranked before
+	Lines      int     `json:"lines"`
+	Unique     int     `json:"unique"`
+	New        int     `json:"new"`
+	Cumulative float64 `json:"cumulative"`
+	Redundant  bool    `json:"redundant"`
+}
+
+// prioritizeCommand ranks the tests of an attribution by the lines they add
+// to the coverage of the tests ranked before them
+func prioritizeCommand(args []string) {
+	fs := flag.NewFlagSet("prioritize", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura prioritize [flags]")
+		fs.PrintDefaults()
+	}
+	path := fs.String("attribution", "attribution.json", "path of the attribution written by gobertura attribute")
+	asJSON := fs.Bool("json", false, "write the ranking as JSON")
+	numberFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := readAttribution(*path)
+	if err != nil {
+		panic(err)
+	}
+	ranking := prioritize(a)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(ranking)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	fmt.Println("rank\ttest\tlines\tunique\tnew\tcumulative")
+	for i, p := range ranking {
+		note := ""
+		if p.Redundant {
+			note = "\tredundant"
+		}
+		fmt.Printf("%d\t%s\t%d\t%d\t%d\t%s%s\n", i+1, p.Test, p.Lines, p.Unique, p.New, formatPercent(p.Cumulative), note)
+	}
+}
+
+// prioritize orders tests greedily, each adding the most lines not covered
+// yet. Tests whose lines are all covered by other tests are redundant.
+func prioritize(a *attribution) []priority {
+	type line struct {
+		file   string
+		number int
+	}
+	covers := map[string][]line{}
+	total := 0
+	counts := map[line]int{}
+	for file, lines := range a.Files {
+		for number, tests := range lines {
+			total++
+			for _, test := range tests {
+				l := line{file, number}
+				covers[test] = append(covers[test], l)
+				counts[l]++
+			}
+		}
+	}
+
+	remaining := map[string]bool{}
+	for _, test := range a.Tests {
+		remaining[test] = true
+	}
+	covered := map[line]bool{}
+	var ranking []priority
+	for len(remaining) > 0 {
+		var names []string
+		for test := range remaining {
+			names = append(names, test)
+		}
+		sort.Strings(names)
+
+		best, bestNew := "", -1
+		for _, test := range names {
+			n := 0
+			for _, l := range covers[test] {
+				if !covered[l] {
+					n++
+				}
+			}
+			if n > bestNew {
+				best, bestNew = test, n
+			}
+		}
+		delete(remaining, best)
+
+		p := priority{Test: best, Lines: len(covers[best]), New: bestNew}
+		for _, l := range covers[best] {
+			covered[l] = true
+			if counts[l] == 1 {
+				p.Unique++
+			}
+		}
+		if total > 0 {
+			p.Cumulative = float64(len(covered)) / float64(total)
+		}
+		p.Redundant = p.Unique == 0
+		ranking = append(ranking, p)
+	}
+	return ranking
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/tools/cover"
+	"io"
+)
+
+// writeProfiles writes profiles in the go test -coverprofile format
+func writeProfiles(w io.Writer, profiles []*cover.Profile) error {
+	mode := "set"
+	if len(profiles) > 0 {
+		mode = profiles[0].Mode
+	}
+	_, err := fmt.Fprintf(w, "mode: %s\n", mode)
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		for _, b := range profile.Blocks {
+			_, err = fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", profile.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
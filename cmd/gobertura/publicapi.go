@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// uncoveredAPICommand lists the exported functions and methods of a report
+// without any coverage, grouped by package
+func uncoveredAPICommand(args []string) {
+	fs := flag.NewFlagSet("uncovered-api", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura uncovered-api [flags] report.xml")
+		fs.PrintDefaults()
+	}
+	src := fs.String("src", "", "go source folder used to find examples(will use current working directory if not set)")
+	examples := fs.Bool("examples", false, "tell whether each identifier has an Example function in the package tests")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	coverage, err := readReport(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	for _, pkg := range coverage.Packages {
+		names := uncoveredAPI(pkg)
+		if len(names) == 0 {
+			continue
+		}
+		var documented map[string]bool
+		if *examples {
+			documented, err = exampleNames(filepath.Join(*src, pkg.Name))
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		fmt.Println(pkg.Name)
+		for _, name := range names {
+			if documented == nil {
+				fmt.Printf("\t%s\n", name)
+			} else if documented[name] {
+				fmt.Printf("\t%s\thas example\n", name)
+			} else {
+				fmt.Printf("\t%s\tno example\n", name)
+			}
+		}
+	}
+}
+
+// uncoveredAPI returns the sorted names, such as F or T.M, of the exported
+// functions and methods of pkg without hits
+func uncoveredAPI(pkg *cobertura.Package) []string {
+	var names []string
+	for _, class := range pkg.Classes {
+		// Generic receivers are recorded with their type parameters, classes
+		// renamed by -unique-classes with their file
+		receiver := class.Name
+		if i := strings.IndexAny(receiver, "[ "); i >= 0 {
+			receiver = receiver[:i]
+		}
+		for _, method := range class.Methods {
+			function := receiver == "-" || method.Function
+			if !function && !isExported(receiver) || !isExported(method.Name) || len(method.Lines) == 0 || method.Lines.NumLinesWithHits() > 0 {
+				continue
+			}
+			name := method.Name
+			if !function {
+				name = receiver + "." + method.Name
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// exampleNames returns the identifiers, such as F or T.M, documented by the
+// Example functions of the test files in dir
+func exampleNames(dir string) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Example") {
+					continue
+				}
+				// ExampleF, ExampleT_M, optionally followed by _suffix
+				parts := strings.Split(strings.TrimPrefix(fn.Name.Name, "Example"), "_")
+				if len(parts) > 0 && parts[0] != "" {
+					names[parts[0]] = true
+					if len(parts) > 1 && isExported(parts[1]) {
+						names[parts[0]+"."+parts[1]] = true
+					}
+				}
+			}
+		}
+	}
+	return names, nil
+}
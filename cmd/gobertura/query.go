@@ -0,0 +1,341 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// queryCommand prints the elements of a report matching a query, e.g.
+//
+//	packages[name~"internal/"].lineRate < 0.5
+//
+// A query is a path of fields or methods without arguments, named in lower
+// camel case, through the coverage model. Lists are expanded and can be
+// filtered by conditions between brackets joined by &&; a trailing
+// comparison keeps the values satisfying it. Operators are those of the
+// filter template function.
+func queryCommand(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura query [flags] query")
+		fs.PrintDefaults()
+	}
+	report := fs.String("report", "coverage.xml", "path or URL of the report")
+	fail := fs.Bool("fail", false, "exit with status 1 when anything matches")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	q, err := parseQuery(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	coverage, err := readReport(*report)
+	if err != nil {
+		panic(err)
+	}
+	matches, err := q.run(reflect.ValueOf(coverage))
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range matches {
+		v := m.value
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			fmt.Println(m.label)
+		} else {
+			fmt.Printf("%s\t%v\n", m.label, v.Interface())
+		}
+	}
+	if *fail && len(matches) > 0 {
+		os.Exit(1)
+	}
+}
+
+// query is a parsed query
+type query struct {
+	steps []queryStep
+	// cond, if set, is the trailing comparison, without field
+	cond *queryCond
+}
+
+// queryStep selects the field of every element, filtered by conds
+type queryStep struct {
+	field string
+	conds []queryCond
+}
+
+// queryCond compares the field of an element, or the element itself when
+// field is empty, with value
+type queryCond struct {
+	field string
+	op    string
+	value reflect.Value
+}
+
+// queryMatch is an element selected by a query, labeled by its path
+type queryMatch struct {
+	label string
+	value reflect.Value
+}
+
+func (q *query) run(root reflect.Value) ([]queryMatch, error) {
+	matches := []queryMatch{{"", root}}
+	for _, step := range q.steps {
+		var next []queryMatch
+		field := exportedName(step.field)
+		for _, m := range matches {
+			v, err := fieldValue(m.value, field)
+			if err != nil {
+				return nil, err
+			}
+			label := step.field
+			if m.label != "" {
+				label = m.label + "." + step.field
+			}
+
+			candidates := []queryMatch{{label, v}}
+			if v.Kind() == reflect.Slice {
+				candidates = nil
+				for i := 0; i < v.Len(); i++ {
+					candidates = append(candidates, queryMatch{fmt.Sprintf("%s[%s]", label, elementName(v.Index(i), i)), v.Index(i)})
+				}
+			}
+			for _, c := range candidates {
+				ok, err := matchConds(c.value, step.conds)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					next = append(next, c)
+				}
+			}
+		}
+		matches = next
+	}
+
+	if q.cond == nil {
+		return matches, nil
+	}
+	var kept []queryMatch
+	for _, m := range matches {
+		ok, err := matchConds(m.value, []queryCond{*q.cond})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
+
+// matchConds reports whether v satisfies every condition of conds
+func matchConds(v reflect.Value, conds []queryCond) (bool, error) {
+	for _, cond := range conds {
+		a := v
+		if cond.field != "" {
+			var err error
+			a, err = fieldValue(v, exportedName(cond.field))
+			if err != nil {
+				return false, err
+			}
+		}
+		ok, err := compare(a, cond.op, cond.value)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// elementName identifies the i-th element of a list in labels: by file
+// name, name or number when it has one
+func elementName(v reflect.Value, i int) string {
+	for _, field := range []string{"Filename", "Name", "Number"} {
+		if f, err := fieldValue(v, field); err == nil {
+			if s := fmt.Sprint(f.Interface()); s != "" && s != "-" {
+				return s
+			}
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+// exportedName returns the Go name of a lower camel case query name
+func exportedName(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// queryOps are the comparison operators, longest first
+var queryOps = []string{"==", "!=", "<=", ">=", "<", ">", "~"}
+
+// parseQuery parses a query, see queryCommand
+func parseQuery(s string) (*query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q := &query{}
+	for {
+		step := queryStep{field: p.ident()}
+		if step.field == "" {
+			return nil, p.errorf("expected a field name")
+		}
+		if p.accept("[") {
+			for {
+				cond, err := p.cond(p.ident())
+				if err != nil {
+					return nil, err
+				}
+				step.conds = append(step.conds, cond)
+				if !p.accept("&&") {
+					break
+				}
+			}
+			if !p.accept("]") {
+				return nil, p.errorf("expected ]")
+			}
+		}
+		q.steps = append(q.steps, step)
+		if !p.accept(".") {
+			break
+		}
+	}
+	if !p.done() {
+		cond, err := p.cond("")
+		if err != nil {
+			return nil, err
+		}
+		q.cond = &cond
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return q, nil
+}
+
+// lexQuery splits a query into identifiers, numbers, quoted strings and
+// punctuation
+func lexQuery(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case unicode.IsDigit(c) || c == '-':
+			j := i + 1
+			for j < len(s) && strings.ContainsRune("0123456789.eE+-", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case c == '"':
+			quoted, err := strconv.QuotedPrefix(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, quoted)
+			i += len(quoted)
+		default:
+			token := ""
+			for _, t := range append([]string{"&&", ".", "[", "]"}, queryOps...) {
+				if strings.HasPrefix(s[i:], t) {
+					token = t
+					break
+				}
+			}
+			if token == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, token)
+			i += len(token)
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) done() bool {
+	return p.pos == len(p.tokens)
+}
+
+func (p *queryParser) accept(token string) bool {
+	if !p.done() && p.tokens[p.pos] == token {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// ident consumes an identifier, returning "" if the next token isn't one
+func (p *queryParser) ident() string {
+	if p.done() {
+		return ""
+	}
+	token := p.tokens[p.pos]
+	if c := rune(token[0]); !unicode.IsLetter(c) && c != '_' {
+		return ""
+	}
+	p.pos++
+	return token
+}
+
+// cond parses the operator and value of a comparison of field
+func (p *queryParser) cond(field string) (queryCond, error) {
+	cond := queryCond{field: field}
+	for _, op := range queryOps {
+		if p.accept(op) {
+			cond.op = op
+			break
+		}
+	}
+	if cond.op == "" {
+		return cond, p.errorf("expected an operator")
+	}
+	if p.done() {
+		return cond, p.errorf("expected a value")
+	}
+	token := p.tokens[p.pos]
+	if strings.HasPrefix(token, `"`) {
+		s, err := strconv.Unquote(token)
+		if err != nil {
+			return cond, err
+		}
+		cond.value = reflect.ValueOf(s)
+	} else {
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return cond, p.errorf("expected a number or a string, got %s", token)
+		}
+		cond.value = reflect.ValueOf(f)
+	}
+	p.pos++
+	return cond, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query: token %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"reflect"
+	"testing"
+)
+
+// queryReport is a report of two packages, one of them internal
+var queryReport = &cobertura.Coverage{
+	LineRate: 0.6,
+	Packages: []*cobertura.Package{
+		{Name: "example.com/m/api", LineRate: 0.9, Classes: []*cobertura.Class{
+			{Name: "Server", Filename: "api/server.go", LineRate: 0.9, Lines: cobertura.Lines{{Number: 3, Hits: 1}, {Number: 4, Hits: 0}}},
+		}},
+		{Name: "example.com/m/internal/db", LineRate: 0.3, Classes: []*cobertura.Class{
+			{Name: "Conn", Filename: "internal/db/conn.go", LineRate: 0.2, Lines: cobertura.Lines{{Number: 7, Hits: 0}}},
+			{Name: "Pool", Filename: "internal/db/pool.go", LineRate: 0.5},
+		}},
+	},
+}
+
+func TestQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{`lineRate`, []string{"lineRate"}},
+		{`lineRate > 0.9`, nil},
+		{`packages`, []string{"packages[example.com/m/api]", "packages[example.com/m/internal/db]"}},
+		{`packages[name~"internal/"].lineRate < 0.5`, []string{"packages[example.com/m/internal/db].lineRate"}},
+		{`packages.classes[lineRate >= 0.2 && lineRate < 0.9].filename`, []string{
+			"packages[example.com/m/internal/db].classes[internal/db/conn.go].filename",
+			"packages[example.com/m/internal/db].classes[internal/db/pool.go].filename",
+		}},
+		{`packages.classes.lines[hits == 0].number`, []string{
+			"packages[example.com/m/api].classes[api/server.go].lines[4].number",
+			"packages[example.com/m/internal/db].classes[internal/db/conn.go].lines[7].number",
+		}},
+		{`packages.classes[name == "Pool"].lines`, nil},
+		{`packages.classes[name != "Conn"].numLines == 0`, []string{
+			"packages[example.com/m/api].classes[api/server.go].numLines",
+			"packages[example.com/m/internal/db].classes[internal/db/pool.go].numLines",
+		}},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matches, err := q.run(reflect.ValueOf(queryReport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range matches {
+				got = append(got, m.label)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{``, "query: token 1: expected a field name"},
+		{`packages[name "x"]`, "query: token 4: expected an operator"},
+		{`packages[name == "x"`, "query: token 6: expected ]"},
+		{`packages[name ==]`, "query: token 5: expected a number or a string, got ]"},
+		{`lineRate <`, "query: token 3: expected a value"},
+		{`lineRate < 1 2`, "query: token 4: unexpected 2"},
+		{`packages[name == "x]`, "unterminated string at offset 17"},
+		{`lineRate # 1`, `unexpected '#' at offset 9`},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parseQuery(tt.query)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tokenEnv is the environment variable holding an optional bearer token sent
+// along with HTTP(S) requests
+const tokenEnv = "GOBERTURA_TOKEN"
+
+// isRemote reports whether path points to an HTTP(S), S3 or GCS resource
+func isRemote(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "gs://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// download fetches path into a temporary file and returns its name
+func download(path string) (string, error) {
+	req, err := remoteRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", path, resp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "gobertura-*.out")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// upload stores data at path
+func upload(path string, data []byte) error {
+	req, err := remoteRequest(http.MethodPut, path, data)
+	if err != nil {
+		return err
+	}
+	resp, err := send(req)
+	if err != nil || resp == nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("uploading %s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// remoteRequest builds an authenticated request for path. GET reads the
+// object, PUT replaces it with body.
+func remoteRequest(method string, path string, body []byte) (*http.Request, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		return s3Request(method, u.Host, strings.TrimPrefix(u.Path, "/"), body)
+	case "gs":
+		return gcsRequest(method, u.Host, strings.TrimPrefix(u.Path, "/"), body)
+	}
+
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv(tokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// gcsRequest builds a request against the Google Cloud Storage JSON API,
+// authenticated with the OAuth access token in GOOGLE_OAUTH_ACCESS_TOKEN
+func gcsRequest(method string, bucket string, object string, body []byte) (*http.Request, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	if method == http.MethodGet {
+		req, err = http.NewRequest(method, fmt.Sprintf(
+			"https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media",
+			url.PathEscape(bucket), url.PathEscape(object)), nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, fmt.Sprintf(
+			"https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+			url.PathEscape(bucket), url.QueryEscape(object)), bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// s3Request builds a request against S3 signed with AWS Signature Version 4.
+// Credentials and region come from the standard AWS_* environment variables,
+// AWS_ENDPOINT_URL can point to an S3 compatible store.
+func s3Request(method string, bucket string, key string, body []byte) (*http.Request, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(endpoint, "/")+"/"+bucket+"/"+awsEscape(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		// Anonymous access to public buckets
+		return req, nil
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("x-amz-security-token", token)
+	}
+
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	sort.Strings(headers)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Host
+		if name != "host" {
+			value = req.Header.Get(name)
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape URI-encodes every path segment of key the way SigV4 expects:
+// only unreserved characters are left as-is
+func awsEscape(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io/ioutil"
+	"os"
+)
+
+// readReport decodes the Cobertura report at path, which can either be a
+// local file or a remote object (see isRemote), checking its signature with
+// -verify-key
+func readReport(path string) (*cobertura.Coverage, error) {
+	data, err := readReportData(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeReport(path, data)
+}
+
+// decodeReport decodes data, the Cobertura report read from path, checking
+// its signature with -verify-key
+func decodeReport(path string, data []byte) (*cobertura.Coverage, error) {
+	err := verifyReport(path, data)
+	if err != nil {
+		return nil, err
+	}
+	coverage := &cobertura.Coverage{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	err = cobertura.RawDecoder(decoder).Decode(coverage)
+	if err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
+
+// readReportData reads the report at path, see readReport
+func readReportData(path string) ([]byte, error) {
+	if isRemote(path) {
+		tmp, err := download(path)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp)
+		path = tmp
+	}
+	return ioutil.ReadFile(path)
+}
+
+// fileHits maps every file of coverage to the hits recorded for its lines
+func fileHits(coverage *cobertura.Coverage) map[string]map[int]int64 {
+	files := map[string]map[int]int64{}
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			hits := files[class.Filename]
+			if hits == nil {
+				hits = map[int]int64{}
+				files[class.Filename] = hits
+			}
+			for _, line := range class.Lines {
+				hits[line.Number] += line.Hits
+			}
+		}
+	}
+	return files
+}
+
+// hasFlags reports whether coverage is labeled with every flag of flags
+func hasFlags(coverage *cobertura.Coverage, flags []string) bool {
+	for _, flag := range flags {
+		if !coverage.HasFlag(flag) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameFlags reports whether both reports are labeled with the same flags
+func sameFlags(a *cobertura.Coverage, b *cobertura.Coverage) bool {
+	return len(a.Flags) == len(b.Flags) && hasFlags(a, b.Flags)
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package main
+
+// peakRSS returns 0, the platform not reporting the maximum resident set size
+func peakRSS() uint64 {
+	return 0
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rule is a check policy: an expression evaluated against the coverage of a
+// scope, one of
+//
+//	total                  the whole report
+//	package PATTERN        every package named PATTERN, or matching it with "..."
+//	diff                   the lines changed since check -changed-since
+//
+// Expressions combine comparisons of the lines and branches rates, in
+// percent, with && and || and parentheses. no-decrease(N) holds when the
+// lines rate dropped by at most N points since the check -base report, and
+// no-new-uncovered-functions, only in diff rules, when every function added
+// since check -changed-since has a covered line:
+//
+//	package internal/payments: lines >= 90 && branches >= 75
+//	diff: lines >= 80 && no-new-uncovered-functions
+//	total: no-decrease(0.5)
+type rule struct {
+	text    string
+	scope   string
+	pattern string
+	expr    ruleExpr
+	// uses are the metrics the expression needs: lines, branches, base or
+	// functions
+	uses map[string]bool
+}
+
+// ruleValues are the metrics of a scope an expression is evaluated against
+type ruleValues struct {
+	Lines    float64
+	Branches float64
+	// Base is the lines rate of the scope in the base report, if HasBase
+	Base    float64
+	HasBase bool
+	// Uncovered are the functions added in the diff without coverage
+	Uncovered []addedFunction
+}
+
+type ruleExpr interface {
+	eval(v ruleValues) bool
+}
+
+type ruleAnd [2]ruleExpr
+
+func (e ruleAnd) eval(v ruleValues) bool {
+	return e[0].eval(v) && e[1].eval(v)
+}
+
+type ruleOr [2]ruleExpr
+
+func (e ruleOr) eval(v ruleValues) bool {
+	return e[0].eval(v) || e[1].eval(v)
+}
+
+type ruleComparison struct {
+	metric string
+	op     string
+	value  float64
+}
+
+func (e ruleComparison) eval(v ruleValues) bool {
+	actual := v.Lines
+	if e.metric == "branches" {
+		actual = v.Branches
+	}
+	switch e.op {
+	case ">=":
+		return actual >= e.value
+	case ">":
+		return actual > e.value
+	case "<=":
+		return actual <= e.value
+	case "<":
+		return actual < e.value
+	case "==":
+		return actual == e.value
+	default:
+		return actual != e.value
+	}
+}
+
+// ruleNoDecrease holds when the lines rate dropped by at most points, or
+// without a base to compare with
+type ruleNoDecrease struct {
+	points float64
+}
+
+func (e ruleNoDecrease) eval(v ruleValues) bool {
+	return !v.HasBase || v.Base-v.Lines <= e.points
+}
+
+// ruleNoNewUncovered holds when no function added in the diff is left
+// uncovered, however high the rate of the changed lines
+type ruleNoNewUncovered struct{}
+
+func (e ruleNoNewUncovered) eval(v ruleValues) bool {
+	return len(v.Uncovered) == 0
+}
+
+// readRules reads the rules of the file at path, one per line, blank lines
+// and lines starting with # being ignored
+func readRules(path string) ([]*rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*rule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// parseRule parses "SCOPE: EXPRESSION", see rule
+func parseRule(text string) (*rule, error) {
+	scope, expr, ok := strings.Cut(text, ":")
+	if !ok {
+		return nil, fmt.Errorf("rule %q: missing \"scope:\"", text)
+	}
+	r := &rule{text: text, uses: map[string]bool{}}
+	fields := strings.Fields(scope)
+	switch {
+	case len(fields) == 1 && (fields[0] == "total" || fields[0] == "diff"):
+		r.scope = fields[0]
+	case len(fields) == 2 && fields[0] == "package":
+		r.scope, r.pattern = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf("rule %q: scope must be total, diff or package PATTERN", text)
+	}
+
+	p := &ruleParser{tokens: ruleToken.FindAllString(expr, -1), rule: r}
+	if strings.Join(p.tokens, "") != strings.Join(strings.Fields(expr), "") {
+		return nil, fmt.Errorf("rule %q: unexpected characters", text)
+	}
+	var err error
+	r.expr, err = p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %v", text, err)
+	}
+	if r.scope == "diff" && (r.uses["branches"] || r.uses["base"]) {
+		return nil, fmt.Errorf("rule %q: diff rules can only check lines and new functions", text)
+	}
+	if r.scope != "diff" && r.uses["functions"] {
+		return nil, fmt.Errorf("rule %q: no-new-uncovered-functions only applies to diff rules", text)
+	}
+	return r, nil
+}
+
+var ruleToken = regexp.MustCompile(`[a-z][a-z-]*|[0-9]+(\.[0-9]+)?|>=|<=|==|!=|&&|\|\||[<>()]`)
+
+// ruleParser parses expressions by recursive descent, && binding tighter
+// than ||
+type ruleParser struct {
+	tokens []string
+	pos    int
+	rule   *rule
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *ruleParser) expect(token string) error {
+	if t := p.next(); t != token {
+		return fmt.Errorf("expected %q, got %q", token, t)
+	}
+	return nil
+}
+
+func (p *ruleParser) or() (ruleExpr, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right ruleExpr
+		right, err = p.and()
+		left = ruleOr{left, right}
+	}
+	return left, err
+}
+
+func (p *ruleParser) and() (ruleExpr, error) {
+	left, err := p.condition()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right ruleExpr
+		right, err = p.condition()
+		left = ruleAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *ruleParser) condition() (ruleExpr, error) {
+	switch t := p.next(); t {
+	case "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case "no-decrease":
+		err := p.expect("(")
+		if err != nil {
+			return nil, err
+		}
+		points, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		p.rule.uses["lines"], p.rule.uses["base"] = true, true
+		return ruleNoDecrease{points}, p.expect(")")
+	case "no-new-uncovered-functions":
+		p.rule.uses["functions"] = true
+		return ruleNoNewUncovered{}, nil
+	case "lines", "branches":
+		op := p.next()
+		switch op {
+		case ">=", ">", "<=", "<", "==", "!=":
+		default:
+			return nil, fmt.Errorf("expected a comparison after %s, got %q", t, op)
+		}
+		value, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		p.rule.uses[t] = true
+		return ruleComparison{t, op, value}, nil
+	default:
+		return nil, fmt.Errorf("expected lines, branches, no-decrease or no-new-uncovered-functions, got %q", t)
+	}
+}
+
+func (p *ruleParser) number() (float64, error) {
+	t := p.next()
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %q", t)
+	}
+	return n, nil
+}
+
+// usesFunctions reports whether a rule of rules checks the functions added
+// in the diff
+func usesFunctions(rules []*rule) bool {
+	for _, r := range rules {
+		if r.uses["functions"] {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleResult is the outcome of a rule for one scope, e.g. one of the
+// packages matching its pattern
+type ruleResult struct {
+	rule   *rule
+	name   string
+	values ruleValues
+	passed bool
+}
+
+func (r ruleResult) String() string {
+	state := "PASS"
+	if !r.passed {
+		state = "FAIL"
+	}
+	var values []string
+	if r.rule.uses["lines"] {
+		values = append(values, "lines "+formatPercent(r.values.Lines/100))
+	}
+	if r.rule.uses["branches"] {
+		values = append(values, "branches "+formatPercent(r.values.Branches/100))
+	}
+	if r.rule.uses["base"] {
+		if r.values.HasBase {
+			values = append(values, "base "+formatPercent(r.values.Base/100))
+		} else {
+			values = append(values, "no base")
+		}
+	}
+	if r.rule.uses["functions"] {
+		var names []string
+		for i, f := range r.values.Uncovered {
+			if i == 3 {
+				names = append(names, fmt.Sprintf("and %d more", len(r.values.Uncovered)-i))
+				break
+			}
+			names = append(names, f.String())
+		}
+		if len(names) == 0 {
+			values = append(values, "no new uncovered function")
+		} else {
+			values = append(values, fmt.Sprintf("%d new uncovered function(s): %s", len(r.values.Uncovered), strings.Join(names, ", ")))
+		}
+	}
+	_, expr, _ := strings.Cut(r.rule.text, ":")
+	return fmt.Sprintf("%s %s:%s (%s)", state, r.name, expr, strings.Join(values, ", "))
+}
+
+// evalRules evaluates rules against coverage, base, the report compared with
+// by no-decrease, being nil when unavailable. changed are the hits of the
+// changed lines and added the functions added since, nil without
+// -changed-since.
+func evalRules(rules []*rule, coverage *cobertura.Coverage, base *cobertura.Coverage, changed map[string]map[int]int64, added []addedFunction) ([]ruleResult, error) {
+	var results []ruleResult
+	for _, r := range rules {
+		// The rates of reports without branches are 0, failing every rule
+		if r.uses["branches"] && coverage.BranchesValid == 0 {
+			return nil, fmt.Errorf("rule %q checks branches, which the report has no data about", r.text)
+		}
+		switch r.scope {
+		case "total":
+			v := ruleValues{Lines: coverage.LineRate * 100, Branches: coverage.BranchRate * 100}
+			if base != nil {
+				v.Base, v.HasBase = base.LineRate*100, true
+			}
+			results = append(results, ruleResult{r, "total", v, r.expr.eval(v)})
+		case "diff":
+			if changed == nil {
+				return nil, fmt.Errorf("rule %q needs -changed-since", r.text)
+			}
+			var valid, covered int
+			for _, hits := range changed {
+				for _, h := range hits {
+					valid++
+					if h > 0 {
+						covered++
+					}
+				}
+			}
+			v := ruleValues{Lines: 100}
+			if valid > 0 {
+				v.Lines = float64(covered) / float64(valid) * 100
+			}
+			if r.uses["functions"] {
+				v.Uncovered = uncoveredFunctions(added, fileHits(coverage))
+			}
+			results = append(results, ruleResult{r, "diff", v, r.expr.eval(v)})
+		case "package":
+			match := func(name string) bool { return name == r.pattern }
+			if strings.Contains(r.pattern, "...") {
+				res, err := compilePatterns([]string{r.pattern})
+				if err != nil {
+					return nil, err
+				}
+				match = func(name string) bool { return matchAny(res, name) }
+			}
+			found := false
+			for _, pkg := range coverage.Packages {
+				if !match(pkg.Name) {
+					continue
+				}
+				found = true
+				v := ruleValues{Lines: pkg.LineRate * 100, Branches: pkg.BranchRate * 100}
+				if base != nil {
+					for _, b := range base.Packages {
+						if b.Name == pkg.Name {
+							v.Base, v.HasBase = b.LineRate*100, true
+						}
+					}
+				}
+				results = append(results, ruleResult{r, "package " + pkg.Name, v, r.expr.eval(v)})
+			}
+			if !found {
+				return nil, fmt.Errorf("rule %q matches no package of the report", r.text)
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, tt := range []struct {
+		text    string
+		scope   string
+		pattern string
+		expr    ruleExpr
+	}{
+		{"total: lines >= 80", "total", "", ruleComparison{"lines", ">=", 80}},
+		{"package internal/payments: lines>=90&&branches>=75.5", "package", "internal/payments", ruleAnd{
+			ruleComparison{"lines", ">=", 90},
+			ruleComparison{"branches", ">=", 75.5},
+		}},
+		{"total: lines > 90 || lines > 80 && branches != 0", "total", "", ruleOr{
+			ruleComparison{"lines", ">", 90},
+			ruleAnd{ruleComparison{"lines", ">", 80}, ruleComparison{"branches", "!=", 0}},
+		}},
+		{"total: (lines > 90 || lines > 80) && no-decrease(0.5)", "total", "", ruleAnd{
+			ruleOr{ruleComparison{"lines", ">", 90}, ruleComparison{"lines", ">", 80}},
+			ruleNoDecrease{0.5},
+		}},
+		{"diff: lines >= 80 && no-new-uncovered-functions", "diff", "", ruleAnd{
+			ruleComparison{"lines", ">=", 80},
+			ruleNoNewUncovered{},
+		}},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			r, err := parseRule(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.scope != tt.scope || r.pattern != tt.pattern || !reflect.DeepEqual(r.expr, tt.expr) {
+				t.Errorf("got %s %q %#v, want %s %q %#v", r.scope, r.pattern, r.expr, tt.scope, tt.pattern, tt.expr)
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"lines >= 80", `rule "lines >= 80": missing "scope:"`},
+		{"module: lines >= 80", `rule "module: lines >= 80": scope must be total, diff or package PATTERN`},
+		{"package: lines >= 80", `rule "package: lines >= 80": scope must be total, diff or package PATTERN`},
+		{"total: lines >= 80%", `rule "total: lines >= 80%": unexpected characters`},
+		{"total: lines 80", `rule "total: lines 80": expected a comparison after lines, got "80"`},
+		{"total: lines >= high", `rule "total: lines >= high": expected a number, got "high"`},
+		{"total: statements >= 80", `rule "total: statements >= 80": expected lines, branches, no-decrease or no-new-uncovered-functions, got "statements"`},
+		{"total: (lines >= 80", `rule "total: (lines >= 80": expected ")", got ""`},
+		{"total: lines >= 80 branches >= 50", `rule "total: lines >= 80 branches >= 50": unexpected "branches"`},
+		{"diff: branches >= 50", `rule "diff: branches >= 50": diff rules can only check lines and new functions`},
+		{"diff: no-decrease(1)", `rule "diff: no-decrease(1)": diff rules can only check lines and new functions`},
+		{"total: no-new-uncovered-functions", `rule "total: no-new-uncovered-functions": no-new-uncovered-functions only applies to diff rules`},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := parseRule(tt.text)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalRules(t *testing.T) {
+	coverage := &cobertura.Coverage{LineRate: 0.8, BranchRate: 0.5, BranchesValid: 10, Packages: []*cobertura.Package{
+		{Name: "example.com/m/api", LineRate: 0.95, BranchRate: 0.9},
+		{Name: "example.com/m/internal/db", LineRate: 0.6, BranchRate: 0.4},
+		{Name: "example.com/m/internal/cache", LineRate: 0.85, BranchRate: 0.7},
+	}}
+	base := &cobertura.Coverage{LineRate: 0.81, Packages: []*cobertura.Package{
+		{Name: "example.com/m/internal/db", LineRate: 0.7},
+	}}
+	changed := map[string]map[int]int64{"api/server.go": {3: 1, 4: 0}, "api/routes.go": {9: 2, 10: 1}}
+
+	for _, tt := range []struct {
+		text string
+		base *cobertura.Coverage
+		want map[string]bool
+	}{
+		{"total: lines >= 80 && branches >= 50", nil, map[string]bool{"total": true}},
+		{"total: lines > 80 || branches > 50", nil, map[string]bool{"total": false}},
+		{"total: no-decrease(0.5)", base, map[string]bool{"total": false}},
+		{"total: no-decrease(1)", base, map[string]bool{"total": true}},
+		{"total: no-decrease(0)", nil, map[string]bool{"total": true}},
+		{"package example.com/m/api: lines >= 90", nil, map[string]bool{"package example.com/m/api": true}},
+		{"package internal/...: lines >= 80", nil, map[string]bool{
+			"package example.com/m/internal/db":    false,
+			"package example.com/m/internal/cache": true,
+		}},
+		{"package internal/...: no-decrease(5)", base, map[string]bool{
+			"package example.com/m/internal/db":    false,
+			"package example.com/m/internal/cache": true,
+		}},
+		{"diff: lines >= 75", nil, map[string]bool{"diff": true}},
+		{"diff: lines > 75", nil, map[string]bool{"diff": false}},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			r, err := parseRule(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := evalRules([]*rule{r}, coverage, tt.base, changed, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, res := range results {
+				got[res.name] = res.passed
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		text    string
+		changed map[string]map[int]int64
+		want    string
+	}{
+		{"diff: lines >= 80", nil, `rule "diff: lines >= 80" needs -changed-since`},
+		{"package web/...: lines >= 80", changed, `rule "package web/...: lines >= 80" matches no package of the report`},
+		{"package example.com/m/web: lines >= 80", changed, `rule "package example.com/m/web: lines >= 80" matches no package of the report`},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			r, err := parseRule(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = evalRules([]*rule{r}, coverage, nil, tt.changed, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	noBranches := &cobertura.Coverage{LineRate: 0.8, Packages: []*cobertura.Package{{Name: "example.com/m/api", LineRate: 0.95}}}
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"total: branches >= 50", `rule "total: branches >= 50" checks branches, which the report has no data about`},
+		{"total: lines >= 90 || branches >= 50", `rule "total: lines >= 90 || branches >= 50" checks branches, which the report has no data about`},
+		{"package api: branches > 0", `rule "package api: branches > 0" checks branches, which the report has no data about`},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			r, err := parseRule(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = evalRules([]*rule{r}, noBranches, nil, nil, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalRulesNewUncoveredFunctions(t *testing.T) {
+	coverage := &cobertura.Coverage{Packages: []*cobertura.Package{{Classes: []*cobertura.Class{
+		{Filename: "api/server.go", Lines: cobertura.Lines{{Number: 3, Hits: 1}, {Number: 8, Hits: 0}, {Number: 9, Hits: 0}}},
+	}}}}
+	added := []addedFunction{
+		{File: "api/server.go", Name: "Serve", First: 2, Last: 4},
+		{File: "api/server.go", Name: "Close", First: 7, Last: 10},
+		{File: "api/server.go", Name: "empty", First: 12, Last: 12},
+	}
+	r, err := parseRule("diff: no-new-uncovered-functions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := evalRules([]*rule{r}, coverage, nil, map[string]map[int]int64{}, added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].passed {
+		t.Fatalf("got %v, want the rule to fail", results)
+	}
+	if got := results[0].values.Uncovered; !reflect.DeepEqual(got, added[1:2]) {
+		t.Errorf("got uncovered %v, want %v", got, added[1:2])
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/api"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// server aggregates the profiles found in directories, at URLs or uploaded
+// to it into one report per project and branch, recording every change in the
+// namespace's history store
+type server struct {
+	cfg     config
+	data    string
+	dirs    []string
+	urls    []string
+	pattern string
+	// project and branch polled sources belong to
+	project string
+	branch  string
+	// tokens maps API tokens to the projects they can access, "*" for all;
+	// without tokens the API is open
+	tokens    map[string][]string
+	retention time.Duration
+	// maxUpload bounds the size in bytes of uploaded profiles and
+	// maxNamespaces the number of projects and branches uploads can create
+	maxUpload     int64
+	maxNamespaces int
+	// projects holds the settings of the projects given their own sources
+	// with -project-src, the others being converted with cfg
+	projects map[string]config
+
+	mu         sync.RWMutex
+	namespaces map[[2]string]*namespace
+	lastPoll   time.Time
+	lastErr    string
+}
+
+// namespace holds the state of one project and branch
+type namespace struct {
+	hashes  map[string][32]byte
+	reports map[string]*cobertura.Coverage
+	updated map[string]time.Time
+	report  []byte
+	merged  *cobertura.Coverage
+}
+
+// serveCommand runs a minimal coverage service: sources are polled on a
+// schedule and results are exposed over HTTP
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	s := &server{namespaces: map[[2]string]*namespace{}}
+	addr := fs.String("addr", ":8080", "address to listen on")
+	interval := fs.Duration("interval", 5*time.Minute, "delay between polls of sources")
+	var dirs, urls stringList
+	fs.Var(&dirs, "dir", "directory polled for profiles(can be repeated)")
+	fs.Var(&urls, "url", "URL (http(s)://, s3://, gs://) of a profile to poll(can be repeated)")
+	fs.StringVar(&s.pattern, "pattern", "*.out", "file name pattern of profiles in directories")
+	fs.StringVar(&s.project, "project", "default", "project polled sources belong to")
+	fs.StringVar(&s.branch, "branch", "main", "branch polled sources belong to")
+	fs.StringVar(&s.data, "data", "gobertura-data", "directory, s3:// or gs:// prefix, or sqlite:// or postgres:// database holding the history of every project and branch")
+	tokens := fs.String("tokens", "", "file of API tokens, one \"token project...\" per line, * for all projects(the API is open if not set)")
+	fs.DurationVar(&s.retention, "retention", 0, "drop history snapshots and sources not updated for this long, 0 keeps everything")
+	fs.Int64Var(&s.maxUpload, "max-upload", 256<<20, "maximum size in bytes of an uploaded profile")
+	fs.IntVar(&s.maxNamespaces, "max-namespaces", 1000, "maximum number of projects and branches kept")
+	var projectSrcs stringList
+	fs.Var(&projectSrcs, "project-src", "PROJECT=DIR checkout of the sources uploads of PROJECT are converted against, instead of the current directory(can be repeated)")
+	s.cfg.register(fs)
+	fs.Parse(args)
+	s.dirs, s.urls = dirs, urls
+
+	base := s.cfg
+	err := s.cfg.resolve()
+	if err != nil {
+		panic(err)
+	}
+	s.projects, err = projectConfigs(base, projectSrcs)
+	if err != nil {
+		panic(err)
+	}
+	err = checkNamespace([2]string{s.project, s.branch})
+	if err != nil {
+		panic(err)
+	}
+	if s.cfg.Hermetic && (len(urls) > 0 || isRemote(s.data) || isDatabase(s.data) && !strings.HasPrefix(s.data, "sqlite://")) {
+		panic(fmt.Errorf("-url and remote -data need the network, which -hermetic forbids"))
+	}
+	if *tokens != "" {
+		s.tokens, err = readTokens(*tokens)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	go func() {
+		for {
+			s.poll()
+			time.Sleep(*interval)
+		}
+	}()
+
+	log.Printf("gobertura: listening on %s", *addr)
+	err = http.ListenAndServe(*addr, s.handler())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// projectConfigs returns the settings of every PROJECT=DIR of srcs: those of
+// base, unresolved, with the sources and module of DIR
+func projectConfigs(base config, srcs []string) (map[string]config, error) {
+	projects := map[string]config{}
+	for _, src := range srcs {
+		project, dir, ok := strings.Cut(src, "=")
+		if !ok || checkNamespace([2]string{project, "-"}) != nil || dir == "" {
+			return nil, fmt.Errorf("-project-src %q: expected PROJECT=DIR", src)
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		cfg := base
+		cfg.Src, cfg.readSrc = dir, true
+		if len(cfg.Pkg) == 0 && !cfg.Bazel {
+			r := resolvers[0]
+			if cfg.Hermetic {
+				r = resolvers[1]
+			}
+			path, err := r.ModulePath(dir)
+			if err != nil {
+				return nil, fmt.Errorf("-project-src %s: %v", project, err)
+			}
+			cfg.Pkg = stringList{path + "/"}
+		}
+		err = cfg.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("-project-src %s: %v", project, err)
+		}
+		projects[project] = cfg
+	}
+	return projects, nil
+}
+
+// config returns the conversion settings of project
+func (s *server) config(project string) config {
+	if cfg, ok := s.projects[project]; ok {
+		return cfg
+	}
+	return s.cfg
+}
+
+// errForeignProfile is returned for profiles listing no file of the module
+// their project is converted against
+var errForeignProfile = errors.New("profile lists no file of the module of the project")
+
+// checkModule fails with errForeignProfile unless a profile of profiles
+// lists a file of the modules of cfg, such as uploads of another repository
+// whose sources can't be found
+func (cfg config) checkModule(profiles []*cover.Profile) error {
+	if len(cfg.Pkg) == 0 {
+		return nil
+	}
+	for _, profile := range profiles {
+		for _, pkg := range cfg.Pkg {
+			// Files can also be listed through the module cache or their
+			// absolute path
+			if strings.Contains(profile.FileName, strings.TrimSuffix(pkg, "/")) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w %s, set its sources with -project-src", errForeignProfile, strings.TrimSuffix(cfg.Pkg[0], "/"))
+}
+
+// readTokens parses a tokens file, ignoring blank lines and # comments
+func readTokens(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s: token without project", path)
+		}
+		tokens[fields[0]] = fields[1:]
+	}
+	return tokens, scanner.Err()
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/report", s.authorized(s.handleReport))
+	mux.HandleFunc("/api/history", s.authorized(s.handleHistory))
+	mux.HandleFunc("/api/profiles", s.authorized(s.handleUpload))
+	mux.HandleFunc("/api/status", s.authorized(s.handleStatus))
+	mux.Handle(api.ServicePath, s.connectHandler())
+	return mux
+}
+
+// namespaceKey returns the project and branch selected by the query
+// parameters of r, defaulting to those of polled sources
+func (s *server) namespaceKey(r *http.Request) [2]string {
+	key := [2]string{r.URL.Query().Get("project"), r.URL.Query().Get("branch")}
+	if key[0] == "" {
+		key[0] = s.project
+	}
+	if key[1] == "" {
+		key[1] = s.branch
+	}
+	return key
+}
+
+// checkNamespace fails unless the project and branch of key can name the
+// folders and prefixes of the history store
+func checkNamespace(key [2]string) error {
+	for i, name := range key {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid %s %q", [2]string{"project", "branch"}[i], name)
+		}
+	}
+	return nil
+}
+
+// errTooManyNamespaces is returned when creating a namespace past
+// -max-namespaces
+var errTooManyNamespaces = fmt.Errorf("too many projects and branches")
+
+// authorized rejects requests for an invalid project or branch, and those
+// without a bearer token granting access to the requested project
+func (s *server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := s.namespaceKey(r)
+		if err := checkNamespace(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if status := s.access(r, key[0]); status != http.StatusOK {
+			http.Error(w, strings.ToLower(http.StatusText(status)), status)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// access returns http.StatusOK if the bearer token of r grants access to
+// project, http.StatusForbidden if it's a token of other projects and
+// http.StatusUnauthorized if it's unknown
+func (s *server) access(r *http.Request, project string) int {
+	if s.tokens == nil {
+		return http.StatusOK
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for token, projects := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			continue
+		}
+		for _, p := range projects {
+			if p == "*" || p == project {
+				return http.StatusOK
+			}
+		}
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// namespace returns the state of key, creating it if needed unless there
+// are -max-namespaces already. s.mu must be held.
+func (s *server) namespace(key [2]string) (*namespace, error) {
+	ns := s.namespaces[key]
+	if ns == nil {
+		if s.maxNamespaces > 0 && len(s.namespaces) >= s.maxNamespaces {
+			return nil, errTooManyNamespaces
+		}
+		ns = &namespace{
+			hashes:  map[string][32]byte{},
+			reports: map[string]*cobertura.Coverage{},
+			updated: map[string]time.Time{},
+		}
+		s.namespaces[key] = ns
+	}
+	return ns, nil
+}
+
+// store returns the history store of key: its table when -data is a
+// database, PROJECT/BRANCH/history.jsonl under -data otherwise
+func (s *server) store(key [2]string) (historyStore, error) {
+	err := checkNamespace(key)
+	if err != nil {
+		return nil, err
+	}
+	location := s.data
+	switch {
+	case isDatabase(s.data):
+	case isRemote(s.data):
+		location = strings.TrimSuffix(s.data, "/") + "/" + url.PathEscape(key[0]) + "/" + url.PathEscape(key[1]) + "/history.jsonl"
+	default:
+		location = filepath.Join(s.data, url.PathEscape(key[0]), url.PathEscape(key[1]), "history.jsonl")
+	}
+	return openStore(location, key[0], key[1])
+}
+
+// poll converts every new or changed profile of the configured sources
+func (s *server) poll() {
+	key := [2]string{s.project, s.branch}
+	changed := false
+	var errs []string
+	for _, dir := range s.dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, s.pattern))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				var c bool
+				c, err = s.update(key, path, data)
+				changed = changed || c
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+			}
+		}
+	}
+	for _, source := range s.urls {
+		tmp, err := download(source)
+		if err == nil {
+			var data []byte
+			data, err = ioutil.ReadFile(tmp)
+			os.Remove(tmp)
+			if err == nil {
+				var c bool
+				c, err = s.update(key, source, data)
+				changed = changed || c
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+		}
+	}
+
+	s.mu.Lock()
+	s.lastPoll = time.Now()
+	s.lastErr = ""
+	if len(errs) > 0 {
+		s.lastErr = fmt.Sprint(errs)
+		log.Printf("gobertura: %v", errs)
+	}
+	var keys [][2]string
+	for k := range s.namespaces {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+
+	for _, k := range keys {
+		expired := s.expire(k)
+		if changed && k == key || expired {
+			err := s.publish(k)
+			if err != nil {
+				log.Printf("gobertura: %v", err)
+			}
+		}
+	}
+}
+
+// expire drops the sources of key which weren't updated within the retention
+// period, reporting whether any was dropped
+func (s *server) expire(key [2]string) bool {
+	if s.retention == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := s.namespaces[key]
+	if ns == nil {
+		return false
+	}
+	expired := false
+	for source, updated := range ns.updated {
+		if time.Since(updated) > s.retention {
+			delete(ns.hashes, source)
+			delete(ns.reports, source)
+			delete(ns.updated, source)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// update converts the profile data of source if it changed since last seen
+func (s *server) update(key [2]string, source string, data []byte) (bool, error) {
+	hash := sha256.Sum256(data)
+	s.mu.Lock()
+	ns, err := s.namespace(key)
+	if err != nil {
+		s.mu.Unlock()
+		return false, err
+	}
+	seen, ok := ns.hashes[source]
+	if ok && seen == hash {
+		ns.updated[source] = time.Now()
+	}
+	s.mu.Unlock()
+	if ok && seen == hash {
+		return false, nil
+	}
+
+	cfg := s.config(key[0])
+	profiles, err := cfg.parseProfileData(source, data)
+	if err != nil {
+		return false, err
+	}
+	err = cfg.checkModule(profiles)
+	if err != nil {
+		return false, err
+	}
+	coverage, err := cfg.coverage(profiles)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The namespace may have been dropped by publish in the meantime
+	ns, err = s.namespace(key)
+	if err != nil {
+		return false, err
+	}
+	ns.hashes[source] = hash
+	ns.reports[source] = coverage
+	ns.updated[source] = time.Now()
+	return true, nil
+}
+
+// publish merges the reports of all sources of key and records the result,
+// dropping key once it has no source left. Keys dropped in the meantime, e.g.
+// by a concurrent publish, are skipped.
+func (s *server) publish(key [2]string) error {
+	s.mu.RLock()
+	ns := s.namespaces[key]
+	if ns == nil {
+		s.mu.RUnlock()
+		return nil
+	}
+	var sources []string
+	for source := range ns.reports {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var reports []*cobertura.Coverage
+	for _, source := range sources {
+		reports = append(reports, ns.reports[source])
+	}
+	s.mu.RUnlock()
+
+	// Once every source expired there is nothing left to report, and a 0%
+	// snapshot would show as a drop in the history
+	if len(reports) == 0 {
+		s.mu.Lock()
+		if s.namespaces[key] == ns && len(ns.reports) == 0 {
+			delete(s.namespaces, key)
+		}
+		s.mu.Unlock()
+		return nil
+	}
+
+	merged := cobertura.Merge(reports...)
+	merged.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	merged.RoundRates(s.cfg.Precision)
+	var buf bytes.Buffer
+	err := writeXML(&buf, merged)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.namespaces[key] != ns {
+		s.mu.Unlock()
+		return nil
+	}
+	ns.report = buf.Bytes()
+	ns.merged = merged
+	s.mu.Unlock()
+
+	store, err := s.store(key)
+	if err != nil {
+		return err
+	}
+	err = store.Add(newSnapshot(merged))
+	if err != nil {
+		return err
+	}
+	if s.retention == 0 {
+		return nil
+	}
+	return store.Prune(time.Now().Add(-s.retention).UnixNano() / int64(time.Millisecond))
+}
+
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	var report []byte
+	if ns := s.namespaces[s.namespaceKey(r)]; ns != nil {
+		report = ns.report
+	}
+	s.mu.RUnlock()
+	if report == nil {
+		http.Error(w, "no report yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(report)
+}
+
+func (s *server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(s.namespaceKey(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if snapshots == nil {
+		snapshots = []snapshot{}
+	}
+	writeJSON(w, snapshots)
+}
+
+// handleUpload accepts a profile POSTed as the request body, identified by
+// the name query parameter so later uploads replace it
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxUpload))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := s.namespaceKey(r)
+	changed, err := s.update(key, "upload:"+name, data)
+	if err == errTooManyNamespaces {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, errForeignProfile) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if changed {
+		err = s.publish(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	key := s.namespaceKey(r)
+	s.mu.RLock()
+	status := struct {
+		Project  string    `json:"project"`
+		Branch   string    `json:"branch"`
+		Sources  []string  `json:"sources"`
+		LastPoll time.Time `json:"lastPoll"`
+		LastErr  string    `json:"lastError,omitempty"`
+	}{key[0], key[1], []string{}, s.lastPoll, s.lastErr}
+	if ns := s.namespaces[key]; ns != nil {
+		for source := range ns.reports {
+			status.Sources = append(status.Sources, source)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(status.Sources)
+	writeJSON(w, status)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("gobertura: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+)
+
+// signingConfig holds the keys reports are signed with and verified against,
+// as PEM files written by openssl or cosign
+type signingConfig struct {
+	SignKey   string
+	VerifyKey string
+}
+
+var signing signingConfig
+
+// signFlags defines the flags of signing on fs, -sign-key for commands
+// writing reports and -verify-key for those reading them
+func signFlags(fs *flag.FlagSet, sign bool, verify bool) {
+	if sign {
+		fs.StringVar(&signing.SignKey, "sign-key", "", "PEM private key (Ed25519, ECDSA or RSA) signing the report into OUT.sig")
+	}
+	if verify {
+		fs.StringVar(&signing.VerifyKey, "verify-key", "", "PEM public key or certificate every report must be signed with, in REPORT.sig")
+	}
+}
+
+// writeSignature signs the report data written to out into out.sig, base64
+// encoded like cosign sign-blob, when -sign-key is set
+func writeSignature(out string, data []byte) error {
+	if signing.SignKey == "" {
+		return nil
+	}
+	key, err := readPrivateKey(signing.SignKey)
+	if err != nil {
+		return err
+	}
+	sig, err := sign(key, data)
+	if err != nil {
+		return err
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+	if isRemote(out) {
+		return upload(out+".sig", encoded)
+	}
+	return writeFile(out+".sig", encoded, 0644)
+}
+
+// verifyReport checks the signature of the report data read from path, in
+// path.sig, when -verify-key is set
+func verifyReport(path string, data []byte) error {
+	if signing.VerifyKey == "" {
+		return nil
+	}
+	key, err := readPublicKey(signing.VerifyKey)
+	if err != nil {
+		return err
+	}
+	sig, err := readReportData(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("no signature: %v", err)
+	}
+	// cosign sign-blob writes base64, openssl dgst -sign raw bytes
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = decoded
+	}
+	if !verify(key, data, sig) {
+		return fmt.Errorf("signature doesn't match %s", signing.VerifyKey)
+	}
+	return nil
+}
+
+// sign signs data with key: Ed25519 keys sign it as is, others its SHA-256
+func sign(key crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// verify reports whether sig is the signature of data by key, see sign
+func verify(key crypto.PublicKey, data []byte, sig []byte) bool {
+	digest := sha256.Sum256(data)
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+// readPEM returns the first PEM block of the file at path
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+// readPrivateKey reads an unencrypted PKCS #8, SEC 1 or PKCS #1 private key
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported %s, encrypted keys must be decrypted first, e.g. with openssl pkey", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	return signer, nil
+}
+
+// readPublicKey reads a PKIX or PKCS #1 public key, or the key of a
+// certificate
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes data as a PEM block of type kind into dir/name
+func writePEM(t *testing.T, dir string, name string, kind string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// certificate returns a self-signed certificate of key
+func certificate(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gobertura"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestSignVerify(t *testing.T) {
+	defer func(saved signingConfig) { signing = saved }(signing)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key crypto.Signer) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	pkixDER := func(key crypto.PublicKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		privType string
+		privDER  []byte
+		pubType  string
+		pubDER   []byte
+	}{
+		{"ed25519 pkcs8 pkix", "PRIVATE KEY", pkcs8(edKey), "PUBLIC KEY", pkixDER(edKey.Public())},
+		{"ed25519 certificate", "PRIVATE KEY", pkcs8(edKey), "CERTIFICATE", certificate(t, edKey)},
+		{"ecdsa pkcs8 pkix", "PRIVATE KEY", pkcs8(ecKey), "PUBLIC KEY", pkixDER(ecKey.Public())},
+		{"ecdsa sec1 certificate", "EC PRIVATE KEY", sec1, "CERTIFICATE", certificate(t, ecKey)},
+		{"rsa pkcs8 pkix", "PRIVATE KEY", pkcs8(rsaKey), "PUBLIC KEY", pkixDER(rsaKey.Public())},
+		{"rsa pkcs1", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)},
+		{"rsa pkcs1 certificate", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), "CERTIFICATE", certificate(t, rsaKey)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			report := filepath.Join(dir, "coverage.xml")
+			data := []byte(`<coverage line-rate="0.8"></coverage>`)
+			err := ioutil.WriteFile(report, data, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signing = signingConfig{
+				SignKey:   writePEM(t, dir, "key.pem", tt.privType, tt.privDER),
+				VerifyKey: writePEM(t, dir, "pub.pem", tt.pubType, tt.pubDER),
+			}
+
+			// base64, like cosign sign-blob
+			err = writeSignature(report, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = verifyReport(report, data)
+			if err != nil {
+				t.Errorf("base64 signature: %v", err)
+			}
+			err = verifyReport(report, []byte(`<coverage line-rate="0.9"></coverage>`))
+			if err == nil {
+				t.Error("tampered report verified")
+			}
+
+			// raw bytes, like openssl dgst -sign
+			key, err := readPrivateKey(signing.SignKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := sign(key, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(report+".sig", sig, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = verifyReport(report, data)
+			if err != nil {
+				t.Errorf("raw signature: %v", err)
+			}
+
+			signing.VerifyKey = writePEM(t, dir, "other.pem", "PUBLIC KEY", pkixDER(otherKey.Public()))
+			err = verifyReport(report, data)
+			if want := "signature doesn't match " + signing.VerifyKey; err == nil || err.Error() != want {
+				t.Errorf("wrong key: got error %v, want %s", err, want)
+			}
+		})
+	}
+}
+
+func TestVerifyReportWithoutSignature(t *testing.T) {
+	defer func(saved signingConfig) { signing = saved }(signing)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	signing = signingConfig{VerifyKey: writePEM(t, dir, "pub.pem", "PUBLIC KEY", der)}
+	err = verifyReport(filepath.Join(dir, "coverage.xml"), []byte("<coverage/>"))
+	if err == nil {
+		t.Error("unsigned report verified")
+	}
+}
+
+func TestReadKeyErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "key.txt")
+	err := ioutil.WriteFile(notPEM, []byte("not a key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := writePEM(t, dir, "encrypted.pem", "ENCRYPTED PRIVATE KEY", []byte{1})
+	garbage := writePEM(t, dir, "garbage.pem", "PRIVATE KEY", []byte{1})
+	request := writePEM(t, dir, "csr.pem", "CERTIFICATE REQUEST", []byte{1})
+
+	for _, tt := range []struct {
+		name string
+		read func(string) error
+		path string
+		want string
+	}{
+		{"private no PEM", readPrivate, notPEM, notPEM + ": no PEM data"},
+		{"private encrypted", readPrivate, encrypted, encrypted + ": unsupported ENCRYPTED PRIVATE KEY, encrypted keys must be decrypted first, e.g. with openssl pkey"},
+		{"public no PEM", readPublic, notPEM, notPEM + ": no PEM data"},
+		{"public certificate request", readPublic, request, request + ": unsupported CERTIFICATE REQUEST"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.read(tt.path)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := readPrivateKey(garbage); err == nil {
+		t.Error("malformed private key read")
+	}
+}
+
+func readPrivate(path string) error {
+	_, err := readPrivateKey(path)
+	return err
+}
+
+func readPublic(path string) error {
+	_, err := readPublicKey(path)
+	return err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// sloFile is the file declaring the coverage targets of components
+type sloFile struct {
+	SLOs []*slo `json:"slos"`
+}
+
+// slo is the line rate a component has to reach by a deadline
+type slo struct {
+	Name string `json:"name"`
+	// Include lists the files of the component, as regexps or package
+	// patterns like filter-profile -include
+	Include  []string `json:"include"`
+	Target   float64  `json:"target"`
+	Deadline string   `json:"deadline"`
+	// Start and Baseline, when set, are the date the target was set and the
+	// rate the component had then; progress is expected to be linear from
+	// there to the deadline. check needs both: without them there is no
+	// expected progress to be off track from.
+	Start    string   `json:"start,omitempty"`
+	Baseline *float64 `json:"baseline,omitempty"`
+}
+
+// sloStatus is the progress of a component towards its target
+type sloStatus struct {
+	*slo
+	Lines    int64   `json:"lines"`
+	Current  float64 `json:"current"`
+	Expected float64 `json:"expected"`
+	// PerWeek is the improvement of the rate needed every week to reach the
+	// target by the deadline
+	PerWeek float64 `json:"perWeek"`
+	State   string  `json:"state"`
+}
+
+// States of sloStatus, a component is failing unless met or on track
+const (
+	sloMet      = "met"
+	sloOnTrack  = "on track"
+	sloOffTrack = "off track"
+	sloMissed   = "missed"
+	sloNoLines  = "no lines"
+)
+
+// sloCommand reports the progress of components towards their coverage SLOs,
+// with check failing when any isn't met or on track
+func sloCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: gobertura slo report|check [flags] report.xml")
+		os.Exit(2)
+	}
+	if len(args) == 0 || args[0] != "report" && args[0] != "check" {
+		usage()
+	}
+	check := args[0] == "check"
+
+	fs := flag.NewFlagSet("slo "+args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gobertura slo %s [flags] report.xml\n", args[0])
+		fs.PrintDefaults()
+	}
+	path := fs.String("config", "gobertura-slo.json", "path of the file declaring the SLOs")
+	asJSON := fs.Bool("json", false, "write the statuses as JSON")
+	numberFlags(fs)
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	slos, err := readSLOs(*path)
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range slos {
+		if check && (s.Start == "" || s.Baseline == nil) {
+			panic(fmt.Errorf("%s: %s: slo check needs the start date and baseline rate of the SLO", *path, s.Name))
+		}
+	}
+	coverage, err := readReport(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	var statuses []*sloStatus
+	for _, s := range slos {
+		status, err := s.status(fileHits(coverage), time.Now())
+		if err != nil {
+			panic(fmt.Errorf("%s: %s: %v", *path, s.Name, err))
+		}
+		statuses = append(statuses, status)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(statuses)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		fmt.Println("component\tcurrent\texpected\ttarget\tdeadline\tper week\tstate")
+		for _, s := range statuses {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%+.2f\t%s\n", s.Name, formatPercent(s.Current), formatPercent(s.Expected), formatPercent(s.Target), s.Deadline, s.PerWeek*100, s.State)
+		}
+	}
+	if check {
+		for _, s := range statuses {
+			if s.State != sloMet && s.State != sloOnTrack {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// readSLOs reads the SLO file at path
+func readSLOs(path string) ([]*slo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f sloFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, s := range f.SLOs {
+		if s.Name == "" || len(s.Include) == 0 || s.Target <= 0 || s.Target > 1 {
+			return nil, fmt.Errorf("%s: SLO %q needs a name, include patterns and a target in (0, 1]", path, s.Name)
+		}
+		if s.Baseline != nil && (*s.Baseline < 0 || *s.Baseline > 1) {
+			return nil, fmt.Errorf("%s: SLO %q needs a baseline in [0, 1]", path, s.Name)
+		}
+	}
+	return f.SLOs, nil
+}
+
+// status computes the progress of the component at now from the hits of
+// the lines of every file
+func (s *slo) status(files map[string]map[int]int64, now time.Time) (*sloStatus, error) {
+	res, err := compilePatterns(s.Include)
+	if err != nil {
+		return nil, err
+	}
+	deadline, err := time.Parse("2006-01-02", s.Deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &sloStatus{slo: s, Expected: s.Target}
+	var covered int64
+	for file, hits := range files {
+		if !matchAny(res, file) {
+			continue
+		}
+		for _, h := range hits {
+			status.Lines++
+			if h > 0 {
+				covered++
+			}
+		}
+	}
+	if status.Lines > 0 {
+		status.Current = float64(covered) / float64(status.Lines)
+	}
+
+	if s.Start != "" && s.Baseline != nil {
+		start, err := time.Parse("2006-01-02", s.Start)
+		if err != nil {
+			return nil, err
+		}
+		if total := deadline.Sub(start); total > 0 && now.Before(deadline) {
+			elapsed := float64(now.Sub(start)) / float64(total)
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			status.Expected = *s.Baseline + (s.Target-*s.Baseline)*elapsed
+		}
+	}
+	week := 7 * 24 * time.Hour
+	if left := deadline.Sub(now); status.Current < s.Target && left > 0 {
+		weeks := float64(left) / float64(week)
+		if weeks < 1 {
+			weeks = 1
+		}
+		status.PerWeek = (s.Target - status.Current) / weeks
+	}
+
+	switch {
+	case status.Lines == 0:
+		status.State = sloNoLines
+	case status.Current >= s.Target:
+		status.State = sloMet
+	case !now.Before(deadline):
+		status.State = sloMissed
+	case s.Start != "" && s.Baseline != nil && status.Current < status.Expected:
+		status.State = sloOffTrack
+	default:
+		status.State = sloOnTrack
+	}
+	return status, nil
+}
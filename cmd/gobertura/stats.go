@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// slowestFiles is the number of files listed by the slowestFiles of stats
+const slowestFiles = 10
+
+// runStats describes the performance of a conversion, for build analytics
+// across many runs
+type runStats struct {
+	Version    string       `json:"version"`
+	GoVersion  string       `json:"goVersion"`
+	Totals     totals       `json:"totals"`
+	Files      int          `json:"files"`
+	Timings    []timing     `json:"timings"`
+	ParseMs    float64      `json:"parseMs"`
+	Slowest    []fileTiming `json:"slowestFiles"`
+	ParseTimes []fileTiming `json:"parseTimes"`
+	// PeakRSS is the high-water mark of the resident memory, where the
+	// platform reports it
+	PeakRSS   uint64 `json:"peakRSSBytes,omitempty"`
+	GoMemory  uint64 `json:"goMemoryBytes"`
+	GCCycles  uint32 `json:"gcCycles"`
+	HeapAlloc uint64 `json:"heapAllocBytes"`
+}
+
+// fileTiming is the time spent reading and parsing a file
+type fileTiming struct {
+	File     string  `json:"file"`
+	Duration float64 `json:"durationMs"`
+}
+
+// writeStats writes the statistics of the conversion of coverage, whose
+// steps m timed, as JSON at path
+func writeStats(path string, m *manifest, coverage *cobertura.Coverage) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := runStats{
+		GoVersion: runtime.Version(),
+		Totals:    reportTotals(coverage),
+		Files:     len(coverage.ParseTimes),
+		Timings:   append(append([]timing{}, m.Timings...), timing{Step: "total", Duration: milliseconds(time.Since(m.start))}),
+		PeakRSS:   peakRSS(),
+		GoMemory:  mem.Sys,
+		GCCycles:  mem.NumGC,
+		HeapAlloc: mem.HeapAlloc,
+	}
+	_, s.Version = buildVersion()
+
+	s.ParseTimes = []fileTiming{}
+	for file, d := range coverage.ParseTimes {
+		s.ParseTimes = append(s.ParseTimes, fileTiming{File: file, Duration: milliseconds(d)})
+		s.ParseMs += milliseconds(d)
+	}
+	sort.Slice(s.ParseTimes, func(i, j int) bool {
+		a, b := s.ParseTimes[i], s.ParseTimes[j]
+		return a.Duration > b.Duration || a.Duration == b.Duration && a.File < b.File
+	})
+	s.Slowest = s.ParseTimes
+	if len(s.Slowest) > slowestFiles {
+		s.Slowest = s.Slowest[:slowestFiles]
+	}
+	s.ParseTimes = append([]fileTiming{}, s.ParseTimes...)
+	sort.Slice(s.ParseTimes, func(i, j int) bool { return s.ParseTimes[i].File < s.ParseTimes[j].File })
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'), 0644)
+}
+
+// milliseconds returns d in fractional milliseconds, as in manifest timings
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// historyStore holds the snapshots of the history of one project and branch
+type historyStore interface {
+	// Add records s
+	Add(s snapshot) error
+	// Snapshots returns the recorded snapshots, oldest first, none if the
+	// store doesn't exist yet
+	Snapshots() ([]snapshot, error)
+	// Prune drops the snapshots older than cutoff, in milliseconds
+	Prune(cutoff int64) error
+}
+
+// databaseDrivers maps the schemes of database locations to the name of the
+// database/sql driver they need. No driver is built in: they are registered
+// by the blank imports of builds adding one.
+var databaseDrivers = map[string]string{
+	"sqlite://":     "sqlite",
+	"postgres://":   "postgres",
+	"postgresql://": "postgres",
+}
+
+// isDatabase reports whether location is one of databaseDrivers
+func isDatabase(location string) bool {
+	for scheme := range databaseDrivers {
+		if strings.HasPrefix(location, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openStore returns the history store at location: a JSON lines file, a JSON
+// lines object (http(s)://, s3://, gs://) or a table of a sqlite:// or
+// postgres:// database, shared by projects and branches
+func openStore(location string, project string, branch string) (historyStore, error) {
+	switch {
+	case isDatabase(location):
+		db, err := openDatabase(location)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlStore{db: db, project: project, branch: branch}, nil
+	case isRemote(location):
+		return objectStore(location), nil
+	}
+	return fileStore(location), nil
+}
+
+// encodeSnapshots returns snapshots as JSON lines
+func encodeSnapshots(snapshots []snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, s := range snapshots {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	return buf.Bytes(), nil
+}
+
+// pruneSnapshots returns the snapshots not older than cutoff, and whether any
+// was dropped
+func pruneSnapshots(snapshots []snapshot, cutoff int64) ([]snapshot, bool) {
+	var kept []snapshot
+	for _, s := range snapshots {
+		if s.Timestamp >= cutoff {
+			kept = append(kept, s)
+		}
+	}
+	return kept, len(kept) < len(snapshots)
+}
+
+// fileStore is a JSON lines history file
+type fileStore string
+
+func (path fileStore) Add(s snapshot) error {
+	err := os.MkdirAll(filepath.Dir(string(path)), 0700)
+	if err != nil {
+		return err
+	}
+	return appendSnapshot(string(path), s)
+}
+
+func (path fileStore) Snapshots() ([]snapshot, error) {
+	snapshots, err := readSnapshots(string(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return snapshots, err
+}
+
+func (path fileStore) Prune(cutoff int64) error {
+	snapshots, err := path.Snapshots()
+	if err != nil {
+		return err
+	}
+	kept, pruned := pruneSnapshots(snapshots, cutoff)
+	if !pruned {
+		return nil
+	}
+	data, err := encodeSnapshots(kept)
+	if err != nil {
+		return err
+	}
+	return writeFile(string(path), data, 0600)
+}
+
+// objectStore is a JSON lines history object, rewritten by every change.
+// Concurrent writers can lose each other's snapshots.
+type objectStore string
+
+func (location objectStore) Add(s snapshot) error {
+	snapshots, err := location.Snapshots()
+	if err != nil {
+		return err
+	}
+	return location.write(append(snapshots, s))
+}
+
+func (location objectStore) Snapshots() ([]snapshot, error) {
+	req, err := remoteRequest(http.MethodGet, string(location), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", location, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile("", "gobertura-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.ReadFrom(resp.Body)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	return readSnapshots(tmp.Name())
+}
+
+func (location objectStore) Prune(cutoff int64) error {
+	snapshots, err := location.Snapshots()
+	if err != nil {
+		return err
+	}
+	kept, pruned := pruneSnapshots(snapshots, cutoff)
+	if !pruned {
+		return nil
+	}
+	return location.write(kept)
+}
+
+func (location objectStore) write(snapshots []snapshot) error {
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Timestamp < snapshots[j].Timestamp })
+	data, err := encodeSnapshots(snapshots)
+	if err != nil {
+		return err
+	}
+	return upload(string(location), data)
+}
+
+// databases are the opened databases by location, shared by their stores
+var databases = struct {
+	sync.Mutex
+	byLocation map[string]*sql.DB
+}{byLocation: map[string]*sql.DB{}}
+
+// openDatabase opens the database at location, creating the history table
+// if needed
+func openDatabase(location string) (*sql.DB, error) {
+	databases.Lock()
+	defer databases.Unlock()
+	if db := databases.byLocation[location]; db != nil {
+		return db, nil
+	}
+
+	var driver, dsn string
+	for scheme, name := range databaseDrivers {
+		if strings.HasPrefix(location, scheme) {
+			driver, dsn = name, location
+			if name == "sqlite" {
+				dsn = strings.TrimPrefix(location, scheme)
+			}
+		}
+	}
+	found := false
+	for _, name := range sql.Drivers() {
+		found = found || name == driver
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: gobertura was built without the %s driver", location, driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS gobertura_history (
+		project TEXT NOT NULL,
+		branch TEXT NOT NULL,
+		timestamp BIGINT NOT NULL,
+		snapshot TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", location, err)
+	}
+	databases.byLocation[location] = db
+	return db, nil
+}
+
+// sqlStore is the history of one project and branch in a database table
+// holding the JSON snapshots of all of them
+type sqlStore struct {
+	db      *sql.DB
+	project string
+	branch  string
+}
+
+func (store *sqlStore) Add(s snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = store.db.Exec("INSERT INTO gobertura_history (project, branch, timestamp, snapshot) VALUES ($1, $2, $3, $4)",
+		store.project, store.branch, s.Timestamp, string(data))
+	return err
+}
+
+func (store *sqlStore) Snapshots() ([]snapshot, error) {
+	rows, err := store.db.Query("SELECT snapshot FROM gobertura_history WHERE project = $1 AND branch = $2 ORDER BY timestamp",
+		store.project, store.branch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []snapshot
+	for rows.Next() {
+		var data string
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		var s snapshot
+		err = json.Unmarshal([]byte(data), &s)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+func (store *sqlStore) Prune(cutoff int64) error {
+	_, err := store.db.Exec("DELETE FROM gobertura_history WHERE project = $1 AND branch = $2 AND timestamp < $3",
+		store.project, store.branch, cutoff)
+	return err
+}
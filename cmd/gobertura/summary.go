@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// warningGroup is a reason a conversion completed with warnings, the files
+// it concerns, or the items named by unit, and a hint at fixing it
+type warningGroup struct {
+	unit   string
+	reason string
+	files  []string
+	hint   string
+}
+
+// warningSummary groups the warnings of the conversion of coverage by
+// reason, in the order they are likely to be fixed in: files that weren't
+// found first, as they often hide the other problems
+func (cfg config) warningSummary(coverage *cobertura.Coverage) []warningGroup {
+	notFound := warningGroup{reason: "not found under " + cfg.Src}
+	parse := warningGroup{reason: "couldn't be parsed", hint: "the sources are likely not the ones the profile was recorded from, or use syntax " + runtime.Version() + " doesn't know"}
+	deadline := warningGroup{reason: fmt.Sprintf("skipped past -deadline %v", cfg.Deadline), hint: "raise -deadline, or speed conversions up with -incremental"}
+	for _, u := range coverage.Unresolved {
+		switch {
+		case u.Reason == "deadline exceeded":
+			deadline.files = append(deadline.files, u.Path)
+		case strings.Contains(u.Reason, "no such file") || strings.Contains(u.Reason, "file does not exist") || strings.Contains(u.Reason, "cannot find the file"):
+			notFound.files = append(notFound.files, u.Path)
+		default:
+			parse.files = append(parse.files, u.Path)
+		}
+	}
+	notFound.hint = notFoundHint(notFound.files)
+
+	mismatched := warningGroup{reason: "have profile blocks outside of the source", hint: "regenerate the profile from these sources, or pass -assume-compatible if they only differ in position by Go version"}
+	if !cfg.Compatible {
+		for file := range coverage.Mismatches {
+			mismatched.files = append(mismatched.files, file)
+		}
+		sort.Strings(mismatched.files)
+	}
+	exclusions := warningGroup{unit: "-exclusions range(s)", reason: "left out no line", hint: "update " + cfg.Exclusions + " after the files changed or were renamed"}
+	for _, e := range cfg.exclusions {
+		if e.Lines == 0 {
+			exclusions.files = append(exclusions.files, fmt.Sprintf("%s:%d-%d", e.File, e.First, e.Last))
+		}
+	}
+
+	var groups []warningGroup
+	for _, g := range []warningGroup{notFound, parse, mismatched, deadline, exclusions} {
+		if len(g.files) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// notFoundHint suggests the flags mapping the files that weren't found to
+// their sources, from the names they kept
+func notFoundHint(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	switch segments := strings.Split(filepath.ToSlash(files[0]), "/"); {
+	case filepath.IsAbs(files[0]):
+		return "the profile was recorded in another checkout, did you mean to pass -src with its folder, or -overlay?"
+	case len(segments) > 1 && strings.Contains(segments[0], "."):
+		return "their names kept an import path, did you mean to pass -pkg with their module path?"
+	default:
+		return "did you mean to pass -src with the checkout the profile was recorded in? -plan shows how every file is mapped"
+	}
+}
+
+// printWarningSummary prints groups on stderr, with up to three example
+// files each
+func printWarningSummary(groups []warningGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "gobertura: completed with warnings:")
+	for _, g := range groups {
+		examples := g.files
+		if len(examples) > 3 {
+			examples = examples[:3]
+		}
+		more := ""
+		if len(g.files) > len(examples) {
+			more = fmt.Sprintf(" and %d more", len(g.files)-len(examples))
+		}
+		unit := g.unit
+		if unit == "" {
+			unit = "file(s)"
+		}
+		fmt.Fprintf(os.Stderr, "gobertura:   %d %s %s (%s%s): %s\n", len(g.files), unit, g.reason, strings.Join(examples, ", "), more, g.hint)
+	}
+}
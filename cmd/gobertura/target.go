@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// targetDirective declares the minimum line coverage of a package, in
+// percent, in a comment of its doc.go:
+//
+//	//gobertura:target 85
+const targetDirective = "//gobertura:target"
+
+// packageTargets returns the line rates(0-1) required by the
+// //gobertura:target directives of the packages of the module at src,
+// keyed by import path and by directory relative to the module root
+func packageTargets(src string) (map[string]float64, error) {
+	module, root, dirs, err := packageDirs(src)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]float64{}
+	for _, dir := range dirs {
+		path := filepath.Join(root, filepath.FromSlash(dir), "doc.go")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				if !strings.HasPrefix(comment.Text, targetDirective+" ") {
+					continue
+				}
+				value := strings.TrimSpace(strings.TrimPrefix(comment.Text, targetDirective))
+				percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+				if err != nil || percent < 0 || percent > 100 {
+					return nil, fmt.Errorf("%s: invalid target %q, expected a percentage", fset.Position(comment.Pos()), value)
+				}
+				targets[importPath(module, dir)] = percent / 100
+				targets[dir] = percent / 100
+			}
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// writeTemplate executes the user supplied template at path against coverage.
+// Templates whose name contains ".html" are executed with html/template.
+func writeTemplate(w io.Writer, coverage *cobertura.Coverage, path string) error {
+	if path == "" {
+		return errors.New("-format template requires -template")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	if strings.Contains(name, ".html") {
+		tmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(string(data))
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, coverage)
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, coverage)
+}
+
+// templateFuncs are the helpers available to report templates:
+//
+//	percent RATE                   formats a 0.0-1.0 rate, e.g. 83.3%
+//	sortBy FIELD LIST              sorts by FIELD, ascending or descending with a "-" prefix
+//	filter FIELD OP VALUE LIST     keeps items where FIELD OP VALUE holds,
+//	                               OP is one of == != < <= > >= or ~ (regexp match)
+//	json VALUE                     encodes VALUE as JSON, e.g. .LineKinds with -line-kinds
+//
+// FIELD names a field or a method without arguments, e.g. Name, LineRate or NumLines.
+var templateFuncs = map[string]interface{}{
+	"percent": formatPercent,
+	"sortBy":  sortBy,
+	"filter":  filter,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func sortBy(field string, list interface{}) (interface{}, error) {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	items, err := listItems(list)
+	if err != nil {
+		return nil, err
+	}
+	var sortErr error
+	sort.SliceStable(items.Interface(), func(i, j int) bool {
+		a, err := fieldValue(items.Index(i), field)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		b, err := fieldValue(items.Index(j), field)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return items.Interface(), sortErr
+}
+
+func filter(field string, op string, value interface{}, list interface{}) (interface{}, error) {
+	items, err := listItems(list)
+	if err != nil {
+		return nil, err
+	}
+	kept := reflect.MakeSlice(items.Type(), 0, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		v, err := fieldValue(items.Index(i), field)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := compare(v, op, reflect.ValueOf(value))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = reflect.Append(kept, items.Index(i))
+		}
+	}
+	return kept.Interface(), nil
+}
+
+// listItems returns a copy of list so sorting doesn't reorder the report
+func listItems(list interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return v, fmt.Errorf("expected a list, got %T", list)
+	}
+	items := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(items, v)
+	return items, nil
+}
+
+func fieldValue(item reflect.Value, field string) (reflect.Value, error) {
+	if m := item.MethodByName(field); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return m.Call(nil)[0], nil
+	}
+	for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+		item = item.Elem()
+	}
+	if item.Kind() == reflect.Struct {
+		if f := item.FieldByName(field); f.IsValid() {
+			return f, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("%s has no field %q", item.Type(), field)
+}
+
+func less(a reflect.Value, b reflect.Value) bool {
+	if x, ok := number(a); ok {
+		y, _ := number(b)
+		return x < y
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+func compare(a reflect.Value, op string, b reflect.Value) (bool, error) {
+	if op == "~" {
+		re, err := regexp.Compile(fmt.Sprint(b.Interface()))
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(a.Interface())), nil
+	}
+
+	x, xNum := number(a)
+	y, yNum := number(b)
+	if !xNum || !yNum {
+		s, t := fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface())
+		switch op {
+		case "==":
+			return s == t, nil
+		case "!=":
+			return s != t, nil
+		}
+		return false, fmt.Errorf("operator %q needs numbers", op)
+	}
+	switch op {
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
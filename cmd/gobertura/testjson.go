@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"os"
+	"strings"
+)
+
+// parseTestJSON reads the go test -json stream at path, returning the
+// profiles referenced in it or given by -coverprofile, stitched together,
+// // and the test results of every package. Plain go test -json runs don't echo
+// their -coverprofile flag, so a stream naming no profile is an error unless
+// -coverprofile is given.
+func (cfg config) parseTestJSON(path string) ([]*cover.Profile, []*cobertura.TestPackage, error) {
+	data, err := readReportData(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	packages, paths, err := cobertura.ParseTestEvents(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		seen[p] = true
+	}
+	for _, p := range cfg.CoverProf {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil, fmt.Errorf("%s: the stream references no coverage profile, pass the one given to go test with -coverprofile", path)
+	}
+
+	var profiles []*cover.Profile
+	for _, p := range paths {
+		fragment, err := cfg.parseProfiles(p)
+		if err != nil && cfg.SkipMissing {
+			fmt.Fprintf(os.Stderr, "gobertura: skipped %s: %v\n", p, err)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		profiles = append(profiles, fragment...)
+	}
+	return profiles, packages, nil
+}
+
+// printTestPackages prints the test results of every package in packages
+func printTestPackages(packages []*cobertura.TestPackage) {
+	for _, pkg := range packages {
+		coverage := "no coverage"
+		if pkg.Coverage >= 0 {
+			coverage = formatPercent(pkg.Coverage/100) + " of statements"
+		}
+		result := pkg.Result
+		if result == "" {
+			result = "incomplete"
+		}
+		fmt.Fprintf(os.Stderr, "gobertura: test %s: %s, %d passed, %d failed, %d skipped, %s\n", pkg.Name, result, pkg.Passed, pkg.Failed, pkg.Skipped, coverage)
+		if len(pkg.FailedTests) > 0 {
+			fmt.Fprintf(os.Stderr, "gobertura: test %s: failed %s\n", pkg.Name, strings.Join(pkg.FailedTests, ", "))
+		}
+	}
+}
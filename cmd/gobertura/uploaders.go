@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"github.com/nim4/gocover-cobertura/publish"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"plugin"
+	"strings"
+)
+
+// networkTransport sends the requests of uploaders with send, so they honor
+// the network flags
+type networkTransport struct{}
+
+// RoundTrip implements http.RoundTripper. Dry runs get an empty 200.
+func (networkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := send(req)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// registerUploaders registers the uploaders shipped with gobertura, then
+// loads the Go plugins at plugins, which register theirs from their init
+// functions
+func registerUploaders(plugins []string) error {
+	client := &http.Client{Transport: networkTransport{}}
+	publish.Register(&publish.GitHub{HTTPClient: client})
+	publish.Register(&publish.GitLab{HTTPClient: client})
+	publish.Register(&publish.Coveralls{HTTPClient: client})
+	for _, path := range plugins {
+		_, err := plugin.Open(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadReport hands coverage and the report written at out to the
+// uploaders named by -upload
+func (cfg config) uploadReport(coverage *cobertura.Coverage, report []byte) error {
+	err := registerUploaders(cfg.Plugins)
+	if err != nil {
+		return err
+	}
+	artifacts := []publish.Artifact{{Name: filepath.Base(cfg.Output), Data: report}}
+	for _, name := range cfg.Upload {
+		u, ok := publish.Lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown uploader %q, expected one of %s", name, strings.Join(publish.Names(), ", "))
+		}
+		err = u.Upload(context.Background(), coverage, artifacts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
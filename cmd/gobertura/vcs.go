@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// vcs is the version control system of the working copy, used by the
+// features relating coverage to changes
+type vcs interface {
+	// Root returns the root directory of the working copy
+	Root() string
+	// ChangedLines returns the lines added or modified in the working copy
+	// since rev, by path relative to Root, every line of new files not yet
+	// tracked included
+	ChangedLines(rev string) (map[string]map[int]bool, error)
+	// Renames returns the new path of the files renamed in the working copy
+	// since rev by their old path, both relative to Root
+	Renames(rev string) (map[string]string, error)
+	// FileAt returns the content of the file at path, relative to Root, in
+	// rev, an error wrapping os.ErrNotExist if it didn't exist
+	FileAt(rev string, path string) ([]byte, error)
+}
+
+// detectVCS returns the vcs of the working copy containing dir
+func detectVCS(dir string) (vcs, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return git{root: dir}, nil
+		}
+		for _, other := range [][2]string{{".hg", "Mercurial"}, {".jj", "Jujutsu"}} {
+			if _, err := os.Stat(filepath.Join(dir, other[0])); err == nil {
+				return nil, fmt.Errorf("%s: %s working copies aren't supported yet", dir, other[1])
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no working copy found")
+		}
+		dir = parent
+	}
+}
+
+type git struct {
+	root string
+}
+
+func (g git) Root() string {
+	return g.root
+}
+
+func (g git) ChangedLines(rev string) (map[string]map[int]bool, error) {
+	cmd := exec.Command("git", "-C", g.root, "diff", "--no-color", "--no-ext-diff", "--no-prefix", "-U0", rev, "--")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %v: %s", rev, err, strings.TrimSpace(stderr.String()))
+	}
+	changed, err := parseUnifiedDiff(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	// git diff leaves out untracked files, which are added as a whole
+	cmd = exec.Command("git", "-C", g.root, "ls-files", "--others", "--exclude-standard", "-z")
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	for _, name := range strings.Split(string(out), "\x00") {
+		// Nested repositories are listed as directories
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(g.root, name))
+		if err != nil {
+			return nil, err
+		}
+		n := bytes.Count(data, []byte("\n"))
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			n++
+		}
+		lines := map[int]bool{}
+		for i := 1; i <= n; i++ {
+			lines[i] = true
+		}
+		changed[filepath.FromSlash(name)] = lines
+	}
+	return changed, nil
+}
+
+func (g git) Renames(rev string) (map[string]string, error) {
+	cmd := exec.Command("git", "-C", g.root, "diff", "--no-color", "--no-ext-diff", "--name-status", "-M", "-z", rev, "--")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %v: %s", rev, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseNameStatus(out)
+}
+
+func (g git) FileAt(rev string, path string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", g.root, "show", rev+":"+filepath.ToSlash(path))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(message, "does not exist in") || strings.Contains(message, "exists on disk, but not in") {
+			return nil, fmt.Errorf("%s in %s: %w", path, rev, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("git show %s:%s: %v: %s", rev, path, err, message)
+	}
+	return out, nil
+}
+
+// parseNameStatus returns the renames listed by git diff --name-status -z:
+// the status of every file followed by its path, or by its old and new paths
+// for renames (R) and copies (C)
+func parseNameStatus(out []byte) (map[string]string, error) {
+	renames := map[string]string{}
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		status := fields[i]
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("malformed status %q", status)
+			}
+			if status[0] == 'R' {
+				renames[filepath.FromSlash(fields[i+1])] = filepath.FromSlash(fields[i+2])
+			}
+			i += 3
+		default:
+			i += 2
+		}
+	}
+	return renames, nil
+}
+
+// parseUnifiedDiff returns the lines added by a zero context unified diff, by
+// path of the new file. The lines left in the current hunk are counted, so
+// that removed and added lines such as "--- x" or "+++ y" aren't taken for
+// file headers.
+func parseUnifiedDiff(r io.Reader) (map[string]map[int]bool, error) {
+	changed := map[string]map[int]bool{}
+	var lines map[int]bool
+	var oldLeft, newLeft int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, " "):
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, "\\"):
+				// \ No newline at end of file
+			default:
+				return nil, fmt.Errorf("malformed hunk line %q", line)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			name := strings.TrimPrefix(line, "+++ ")
+			lines = nil
+			if name != "/dev/null" {
+				lines = map[int]bool{}
+				changed[filepath.FromSlash(name)] = lines
+			}
+		case strings.HasPrefix(line, "@@ "):
+			// @@ -a[,b] +c[,d] @@
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("malformed hunk %q", line)
+			}
+			_, removed, err := hunkRange(fields[1], "-")
+			if err != nil {
+				return nil, fmt.Errorf("malformed hunk %q", line)
+			}
+			first, n, err := hunkRange(fields[2], "+")
+			if err != nil {
+				return nil, fmt.Errorf("malformed hunk %q", line)
+			}
+			oldLeft, newLeft = removed, n
+			for i := first; i < first+n && lines != nil; i++ {
+				lines[i] = true
+			}
+		}
+	}
+	return changed, scanner.Err()
+}
+
+// hunkRange parses the start[,count] range of a hunk header, prefixed by
+// sign, the count defaulting to 1
+func hunkRange(field string, sign string) (int, int, error) {
+	if !strings.HasPrefix(field, sign) {
+		return 0, 0, fmt.Errorf("malformed range %q", field)
+	}
+	start, count := strings.TrimPrefix(field, sign), "1"
+	if i := strings.Index(start, ","); i >= 0 {
+		start, count = start[:i], start[i+1:]
+	}
+	first, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("malformed range %q", field)
+	}
+	return first, n, nil
+}
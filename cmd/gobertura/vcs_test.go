@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		diff string
+		want map[string]map[int]bool
+	}{
+		{
+			name: "hunks",
+			diff: `diff --git calc/calc.go calc/calc.go
+index 1..2 100644
+--- calc/calc.go
++++ calc/calc.go
+@@ -3 +3,2 @@ func Add(a, b int) int {
+-	return a + b
++	sum := a + b
++	return sum
+@@ -9,0 +11 @@ func Sub(a, b int) int {
++// Mul multiplies
+`,
+			want: map[string]map[int]bool{"calc/calc.go": {3: true, 4: true, 11: true}},
+		},
+		{
+			name: "lines looking like headers",
+			diff: `--- a.txt
++++ a.txt
+@@ -1,2 +1,2 @@
+--- removed
+-x
++++ added
++y
+--- b.txt
++++ b.txt
+@@ -5 +5 @@
+-a
++b
+`,
+			want: map[string]map[int]bool{"a.txt": {1: true, 2: true}, "b.txt": {5: true}},
+		},
+		{
+			name: "new and deleted files",
+			diff: `--- /dev/null
++++ new.go
+@@ -0,0 +1,2 @@
++package main
++
+\ No newline at end of file
+--- old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package main
+-+++ old
+`,
+			want: map[string]map[int]bool{"new.go": {1: true, 2: true}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUnifiedDiff(strings.NewReader(tt.diff))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]map[int]bool{}
+			for name, lines := range tt.want {
+				want[filepath.FromSlash(name)] = lines
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseUnifiedDiffErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		diff string
+		want string
+	}{
+		{"short header", "+++ a.go\n@@ -1\n", `malformed hunk "@@ -1"`},
+		{"bad range", "+++ a.go\n@@ -1 +x,2 @@\n", `malformed hunk "@@ -1 +x,2 @@"`},
+		{"truncated hunk", "+++ a.go\n@@ -1 +1,2 @@\n+a\ndiff --git b.go b.go\n", `malformed hunk line "diff --git b.go b.go"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseUnifiedDiff(strings.NewReader(tt.diff))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/tools/cover"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// verifyAgainstGoTool converts profiles weighting by statements and compares
+// the total and the rate of every function with go tool cover -func, which
+// must agree within epsilon(0-1). It returns the divergences found.
+func verifyAgainstGoTool(cfg config, profiles []*cover.Profile, epsilon float64) ([]string, error) {
+	if cfg.Bazel {
+		return nil, fmt.Errorf("-verify-against-go-tool doesn't support -bazel profiles")
+	}
+	f, err := ioutil.TempFile("", "gobertura-*.out")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	err = writeProfiles(f, profiles)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := goCommand.RunGo("", "tool", "cover", "-func="+f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare the mapping alone, without the options changing rates on purpose
+	cfg.WeightStmts, cfg.MinHits, cfg.exclusions = true, 0, nil
+	coverage, err := cfg.coverage(profiles)
+	if err != nil {
+		return nil, err
+	}
+	rates := map[string]float64{}
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			for _, method := range class.Methods {
+				key := fmt.Sprintf("%s:%d", filepath.ToSlash(class.Filename), method.FirstLine)
+				rates[key] = float64(method.LineRate)
+			}
+		}
+	}
+
+	// Lines look like "example.com/mod/file.go:12:\tName\t\t75.0%" and end
+	// with "total:\t\t(statements)\t55.6%"
+	var divergences []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[len(fields)-1], "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("go tool cover: unexpected line %q", scanner.Text())
+		}
+		want := percent / 100
+
+		if fields[0] == "total:" {
+			if got := float64(coverage.LineRate); math.Abs(got-want) > epsilon {
+				divergences = append(divergences, fmt.Sprintf("total: %.1f%%, go tool cover %.1f%%", got*100, percent))
+			}
+			continue
+		}
+		key := strings.TrimSuffix(fields[0], ":")
+		key = coverage.TrimPackagePath(key)
+		got, ok := rates[key]
+		if !ok {
+			divergences = append(divergences, fmt.Sprintf("%s %s: missing, go tool cover %.1f%%", key, fields[1], percent))
+			continue
+		}
+		if math.Abs(got-want) > epsilon {
+			divergences = append(divergences, fmt.Sprintf("%s %s: %.1f%%, go tool cover %.1f%%", key, fields[1], got*100, percent))
+		}
+	}
+	return divergences, scanner.Err()
+}
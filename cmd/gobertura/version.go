@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// modulePath is the module gobertura is released from, used when the binary
+// carries no build info
+const modulePath = "github.com/nim4/gocover-cobertura"
+
+// releaseURL is where release binaries and their checksums are published,
+// by version
+const releaseURL = "https://github.com/nim4/gocover-cobertura/releases/download"
+
+// buildVersion returns the module path and version gobertura was built from,
+// (devel) for builds outside of a module version
+func buildVersion() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return modulePath, "(devel)"
+	}
+	return info.Main.Path, info.Main.Version
+}
+
+// buildInfo describes the binary and its capabilities for orchestration
+// tools, see -version -json
+type buildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"goVersion"`
+	// Formats are the values of -format, Inputs the profile formats read
+	Formats []string `json:"formats"`
+	Inputs  []string `json:"inputs"`
+}
+
+// outputFormats are the values of -format
+var outputFormats = []string{"xml", "html", "template"}
+
+// inputFormats name the inputs gobertura reads: go test profiles, bazel
+// coverage (-bazel) and go test -json streams (-test-json)
+var inputFormats = []string{"go", "bazel", "test-json"}
+
+// currentBuild describes the running binary
+func currentBuild() buildInfo {
+	b := buildInfo{GoVersion: runtime.Version(), Formats: outputFormats, Inputs: inputFormats}
+	b.Module, b.Version = buildVersion()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				b.Revision = setting.Value
+			case "vcs.time":
+				b.Time = setting.Value
+			case "vcs.modified":
+				b.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return b
+}
+
+// printVersion prints the running binary, as JSON if asJSON
+func printVersion(asJSON bool) {
+	b := currentBuild()
+	if !asJSON {
+		fmt.Printf("gobertura %s %s\n", b.Version, b.GoVersion)
+		return
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	err := encoder.Encode(b)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// versionCommand prints the version of gobertura. With -check the latest
+// release is looked up, with -min the version is asserted.
+func versionCommand(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura version [flags]")
+		fs.PrintDefaults()
+	}
+	check := fs.Bool("check", false, "look up the latest release, exiting with 1 if it is newer")
+	asJSON := fs.Bool("json", false, "print the version, VCS revision and supported formats as JSON")
+	min := fs.String("min", "", "minimum version required, exiting with 1 if this one is older or unknown, e.g. v1.4.0")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path, version := buildVersion()
+	printVersion(*asJSON)
+	if *min != "" && compareVersions(version, *min) < 0 {
+		fmt.Fprintf(os.Stderr, "gobertura: version %s is older than the required %s\n", version, *min)
+		os.Exit(1)
+	}
+	if *check {
+		latest, err := latestVersion(path)
+		if err != nil {
+			panic(err)
+		}
+		if compareVersions(version, latest) < 0 {
+			fmt.Fprintf(os.Stderr, "gobertura: %s is available, run gobertura self-update\n", latest)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "gobertura: up to date")
+	}
+}
+
+// selfUpdateCommand replaces the running binary with the release binary of
+// a version, verified against the checksums published with it
+func selfUpdateCommand(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gobertura self-update [flags]")
+		fs.PrintDefaults()
+	}
+	version := fs.String("version", "latest", "version to install")
+	base := fs.String("url", releaseURL, "URL releases are published under, as <url>/<version>/gobertura_<GOOS>_<GOARCH> along with checksums.txt")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path, current := buildVersion()
+	if *version == "latest" {
+		var err error
+		*version, err = latestVersion(path)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if *version == current {
+		fmt.Fprintf(os.Stderr, "gobertura: %s already installed\n", current)
+		return
+	}
+
+	name := "gobertura_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	prefix := strings.TrimSuffix(*base, "/") + "/" + *version + "/"
+	sums, err := fetch(prefix + "checksums.txt")
+	if err != nil {
+		panic(err)
+	}
+	want, err := checksum(sums, name)
+	if err != nil {
+		panic(err)
+	}
+	binary, err := fetch(prefix + name)
+	if err != nil {
+		panic(err)
+	}
+	got := sha256.Sum256(binary)
+	if hex.EncodeToString(got[:]) != want {
+		panic(fmt.Errorf("checksum mismatch for %s %s", name, *version))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		panic(err)
+	}
+	err = writeFile(exe, binary, 0755)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "gobertura: updated %s to %s\n", current, *version)
+}
+
+// latestVersion asks the module proxy for the latest version of module
+func latestVersion(module string) (string, error) {
+	proxy := "https://proxy.golang.org"
+	for _, p := range strings.Split(os.Getenv("GOPROXY"), ",") {
+		if strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "http://") {
+			proxy = strings.TrimSuffix(p, "/")
+			break
+		}
+	}
+	data, err := fetch(proxy + "/" + escapeModule(module) + "/@latest")
+	if err != nil {
+		return "", err
+	}
+	var info struct{ Version string }
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// escapeModule escapes the upper case letters of a module path for the
+// module proxy protocol
+func escapeModule(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fetch returns the body of a GET of url. Unlike download, no credentials
+// are sent.
+func fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// checksum returns the SHA-256 of name listed in sums, in sha256sum format
+func checksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+// compareVersions compares the semantic versions a and b like strings.Compare.
+// Unknown versions, like (devel), are older than any other.
+func compareVersions(a, b string) int {
+	pa, oka := parseVersion(a)
+	pb, okb := parseVersion(b)
+	switch {
+	case !oka && !okb:
+		return 0
+	case !oka:
+		return -1
+	case !okb:
+		return 1
+	}
+	for i := 0; i < 3; i++ {
+		if pa.numbers[i] != pb.numbers[i] {
+			if pa.numbers[i] < pb.numbers[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// A pre-release is older than the release
+	switch {
+	case pa.pre == pb.pre:
+		return 0
+	case pa.pre == "":
+		return 1
+	case pb.pre == "":
+		return -1
+	}
+	return strings.Compare(pa.pre, pb.pre)
+}
+
+// semver is a parsed vMAJOR.MINOR.PATCH[-PRE][+BUILD] version
+type semver struct {
+	numbers [3]int
+	pre     string
+}
+
+func parseVersion(v string) (semver, bool) {
+	var s semver
+	if !strings.HasPrefix(v, "v") {
+		return s, false
+	}
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, s.pre = v[:i], v[i+1:]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return s, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return s, false
+		}
+		s.numbers[i] = n
+	}
+	return s, true
+}
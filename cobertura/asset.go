@@ -0,0 +1,79 @@
+package cobertura
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listAssets adds a class without lines for every non-Go file of pkg, whose
+// files are in dir, including those of subdirectories which aren't packages
+// themselves, such as the tmpl/*.tmpl files of a //go:embed directive
+func (cov *Coverage) listAssets(pkg *Package, dir string) error {
+	names, err := cov.assetFiles(dir, "")
+	if err != nil {
+		return cov.unresolved(dir, err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg.Classes = append(pkg.Classes, &Class{
+			Name:     name,
+			Filename: filepath.Join(pkg.Name, name),
+			Asset:    true,
+			Methods:  []*Method{},
+			Lines:    Lines{},
+		})
+	}
+	return nil
+}
+
+// assetFiles returns the non-Go files of dir, named relative to the package
+// directory by prefix, and those of its subdirectories. Subdirectories
+// holding Go files or a go.mod belong to other packages or modules and are
+// skipped, as are hidden ones, those starting with _ (like //go:embed does)
+// and testdata.
+func (cov *Coverage) assetFiles(dir string, prefix string) ([]string, error) {
+	var files []fs.DirEntry
+	var err error
+	if cov.FS != nil {
+		var name string
+		name, err = cov.fsPath(dir)
+		if err == nil {
+			files, err = fs.ReadDir(cov.FS, name)
+		}
+	} else {
+		files, err = os.ReadDir(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		for _, f := range files {
+			if f.Type().IsRegular() && (strings.HasSuffix(f.Name(), ".go") || f.Name() == "go.mod") {
+				return nil, nil
+			}
+		}
+	}
+
+	var names []string
+	for _, f := range files {
+		name := f.Name()
+		switch {
+		case strings.HasPrefix(name, "."):
+		case f.IsDir():
+			if strings.HasPrefix(name, "_") || name == "testdata" {
+				continue
+			}
+			nested, err := cov.assetFiles(filepath.Join(dir, name), prefix+name+"/")
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, nested...)
+		case f.Type().IsRegular() && !strings.HasSuffix(name, ".go"):
+			names = append(names, prefix+name)
+		}
+	}
+	return names, nil
+}
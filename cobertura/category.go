@@ -0,0 +1,128 @@
+package cobertura
+
+import (
+	"go/ast"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Categories a class can be classified as when Classify is set
+const (
+	CategoryProduction = "production"
+	CategoryTestHelper = "test-helper"
+	CategoryGenerated  = "generated"
+)
+
+// Category holds the totals of the classes of one category
+type Category struct {
+	Name         string  `xml:"name,attr"`
+	LineRate     float64 `xml:"line-rate,attr"`
+	LinesCovered int64   `xml:"lines-covered,attr"`
+	LinesValid   int64   `xml:"lines-valid,attr"`
+}
+
+// generatedRe matches the comment marking generated files, see
+// https://golang.org/s/generatedcode
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// testHelperDirs are directory names conventionally holding test helpers
+var testHelperDirs = map[string]bool{
+	"testutil":     true,
+	"testutils":    true,
+	"testhelper":   true,
+	"testhelpers":  true,
+	"testing":      true,
+	"testfixtures": true,
+}
+
+// classify returns the category of the parsed file. It needs to be parsed
+// with comments for generated files to be detected.
+func classify(fileName string, file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if generatedRe.MatchString(comment.Text) {
+				return CategoryGenerated
+			}
+		}
+	}
+
+	if strings.HasSuffix(file.Name.Name, "_test") || strings.HasSuffix(fileName, "_test.go") {
+		return CategoryTestHelper
+	}
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(fileName)), "/") {
+		if testHelperDirs[dir] {
+			return CategoryTestHelper
+		}
+	}
+	return CategoryProduction
+}
+
+// CategoryTotals sums the lines of classes by category, sorted by name. Rates
+// are weighted by statements when lines carry them; classes without a
+// category are ignored.
+func (cov Coverage) CategoryTotals() []*Category {
+	byName := map[string]*Category{}
+	statements := map[string][2]int64{}
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			if class.Category == "" {
+				continue
+			}
+			category := byName[class.Category]
+			if category == nil {
+				category = &Category{Name: class.Category}
+				byName[class.Category] = category
+			}
+			category.LinesValid += class.Lines.NumLines()
+			category.LinesCovered += class.Lines.NumLinesWithHits()
+			st := statements[class.Category]
+			statements[class.Category] = [2]int64{st[0] + class.Lines.NumStatementsWithHits(), st[1] + class.Lines.NumStatements()}
+		}
+	}
+
+	categories := []*Category{}
+	for _, category := range byName {
+		category.LineRate = rate(category.LinesCovered, category.LinesValid)
+		if st := statements[category.Name]; st[1] > 0 {
+			category.LineRate = rate(st[0], st[1])
+		}
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories
+}
+
+// TotalsWithout sums the lines of the report left once the classes and
+// methods for which excluded returns true are taken out, weighted by
+// statements when lines carry them. excluded is called with a nil method for
+// every class, then with each of its methods.
+func (cov Coverage) TotalsWithout(excluded func(class *Class, method *Method) bool) *Category {
+	var kept Lines
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			if excluded(class, nil) {
+				continue
+			}
+			// Decoded reports don't share lines between classes and methods
+			left := map[int]bool{}
+			for _, method := range class.Methods {
+				if excluded(class, method) {
+					for _, line := range method.Lines {
+						left[line.Number] = true
+					}
+				}
+			}
+			for _, line := range class.Lines {
+				if !left[line.Number] {
+					kept = append(kept, line)
+				}
+			}
+		}
+	}
+	return &Category{LineRate: lineRate(kept), LinesCovered: kept.NumLinesWithHits(), LinesValid: kept.NumLines()}
+}
@@ -0,0 +1,27 @@
+package cobertura
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// uniqueClasses renames the classes of pkg sharing their name with a
+// class of another file, such as a type whose methods are spread over
+// several files, after the base name of their file, e.g. "Store (query.go)".
+// Classes can't be merged instead, as Cobertura lines are located by the
+// file name of their class. The "-" classes of functions keep their name,
+// telling functions from methods.
+func uniqueClasses(pkg *Package) {
+	files := map[string]map[string]bool{}
+	for _, class := range pkg.Classes {
+		if files[class.Name] == nil {
+			files[class.Name] = map[string]bool{}
+		}
+		files[class.Name][class.Filename] = true
+	}
+	for _, class := range pkg.Classes {
+		if class.Name != "-" && len(files[class.Name]) > 1 {
+			class.Name = fmt.Sprintf("%s (%s)", class.Name, filepath.Base(class.Filename))
+		}
+	}
+}
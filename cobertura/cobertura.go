@@ -1,76 +1,357 @@
 package cobertura
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"golang.org/x/tools/cover"
-	"io/ioutil"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Coverage struct {
-	PackagePath     string     `xml:"-"`
+	PackagePath string `xml:"-"`
+	SkipMissing bool   `xml:"-"`
+	// PackagePaths are more prefixes stripped from profile file names, e.g.
+	// former import paths of the module; the longest matching one of them
+	// and PackagePath is stripped
+	PackagePaths []string `xml:"-"`
+	// MinHits is the number of executions a line needs to be counted as
+	// covered in count and atomic mode, lines below it get 0 hits
+	MinHits int64 `xml:"-"`
+	// WeightStatements weights rates by the number of statements of each
+	// line, matching the percentage reported by go test -cover
+	WeightStatements bool `xml:"-"`
+	// LineFilter, when set, is called for every line recorded while parsing
+	// with the file name, line number and source text; lines for which it
+	// returns false are dropped from the report
+	LineFilter func(file string, line int, text string) bool `xml:"-"`
+	// Classify tags every class as production, test-helper or generated code
+	// and reports the totals of each category
+	Classify bool `xml:"-"`
+	// ExcludeMocks leaves the files generated by mockgen or moq out of the
+	// report, listing the coverage of their mocks in Mocks instead
+	ExcludeMocks bool `xml:"-"`
+	// ExcludeTrivial leaves functions without branches of up to two lines,
+	// such as getters and setters, out of the report, listing them in Trivial
+	// instead
+	ExcludeTrivial bool `xml:"-"`
+	// DetectDeprecated marks the functions whose doc has a "Deprecated:"
+	// paragraph and reports their totals in Deprecated
+	DetectDeprecated bool `xml:"-"`
+	// DetectMain marks the classes of the files declaring package main, the
+	// entrypoints of commands, and reports their totals in Entrypoints
+	DetectMain bool `xml:"-"`
+	// GroupByType reports top-level functions in the class of the type of
+	// their file they construct, returned first as by NewFoo or ParseFoo, or
+	// operate on, taken first, instead of the "-" class. A
+	// //gobertura:class Foo comment in the doc of a function picks the class.
+	GroupByType bool `xml:"-"`
+	// UniqueClasses renames the classes of a package named like a class of
+	// another file after their file, e.g. "Store (query.go)", for viewers
+	// expecting class names to be unique within a package. The "-" classes
+	// of functions are kept.
+	UniqueClasses bool `xml:"-"`
+	// ClassifyLines fills LineKinds
+	ClassifyLines bool `xml:"-"`
+	// ListAssets adds the non-Go files of every package, such as templates or
+	// SQL, as classes without lines
+	ListAssets bool `xml:"-"`
+	// Logger, when set, receives the warnings of the conversion, such as the
+	// files skipped while SkipMissing is set
+	Logger *slog.Logger `xml:"-"`
+	// Overlay maps the logical paths of files to the files holding their
+	// content, like go build -overlay: profiles listing the latter are
+	// reported under the former, whose content is read from the latter
+	Overlay map[string]string `xml:"-"`
+	// FS, when set, is the only way source files are read: by their path in
+	// the module, or relative to a source folder for absolute paths; the OS
+	// file system is never touched and Overlay can't be used
+	FS fs.FS `xml:"-"`
+	// Mismatches counts by file the profile blocks falling outside of the
+	// source, a sign that the profile was generated from other sources or by
+	// a Go version placing blocks differently
+	Mismatches map[string]int `xml:"-"`
+	// ParseTimes holds by file how long reading and parsing its source took,
+	// filled by ParseProfiles
+	ParseTimes map[string]time.Duration `xml:"-"`
+	// LineKinds holds by file the kind of every line outside of the profile
+	// blocks, LineBlank, LineComment or LineDeclaration, telling lines which
+	// can't be executed from uncovered ones; filled by ParseProfiles when
+	// ClassifyLines is set
+	LineKinds map[string]map[int]string `xml:"-"`
+	// HashSources records the SourceHash of every class
+	HashSources bool `xml:"-"`
+	// Previous, when set, is a report of the same module converted earlier
+	// with HashSources, e.g. the day before: the classes of the files whose
+	// SourceHash didn't change are taken from it instead of parsing the
+	// files again, only their lines being computed from the profile
+	Previous *Coverage `xml:"-"`
+	// Reused lists the files whose classes were taken from Previous, filled
+	// by ParseProfiles
+	Reused []string `xml:"-"`
+	// Deadline, when set, is the time after which ParseProfiles stops parsing
+	// files, recording the remaining ones as unresolved and Partial as set
+	Deadline time.Time `xml:"-"`
+	// onPackage are the callbacks registered with OnPackage
+	onPackage []func(*Package)
+	// overlay indexes Overlay while parsing
+	overlay overlayFiles
+	// previous indexes Previous while parsing
+	previous previousFiles
+
 	XMLName         xml.Name   `xml:"coverage"`
-	LineRate        float32    `xml:"line-rate,attr"`
-	BranchRate      float32    `xml:"branch-rate,attr"`
+	LineRate        float64    `xml:"line-rate,attr"`
+	BranchRate      float64    `xml:"branch-rate,attr"`
 	Version         string     `xml:"version,attr"`
 	Timestamp       int64      `xml:"timestamp,attr"`
 	LinesCovered    int64      `xml:"lines-covered,attr"`
 	LinesValid      int64      `xml:"lines-valid,attr"`
 	BranchesCovered int64      `xml:"branches-covered,attr"`
 	BranchesValid   int64      `xml:"branches-valid,attr"`
-	Complexity      float32    `xml:"complexity,attr"`
+	Complexity      float64    `xml:"complexity,attr"`
 	Sources         []*Source  `xml:"sources>source"`
 	Packages        []*Package `xml:"packages>package"`
+	// Unresolved is an extension listing profile files which couldn't be
+	// read or parsed while SkipMissing was set
+	Unresolved []*Unresolved `xml:"unresolved"`
+	// Flags is an extension labeling the partition the report belongs to,
+	// e.g. unit or integration
+	Flags []string `xml:"flag"`
+	// Categories is an extension holding the totals by category when
+	// classifying
+	Categories []*Category `xml:"category"`
+	// Deprecated is an extension holding the totals of the deprecated
+	// methods when DetectDeprecated is set
+	Deprecated *Category `xml:"deprecated"`
+	// Entrypoints is an extension holding the totals of the classes of
+	// package main when DetectMain is set
+	Entrypoints *Category `xml:"entrypoints"`
+	// Partial is an extension marking reports missing the files left
+	// unresolved once Deadline passed
+	Partial bool `xml:"partial,attr,omitempty"`
+	// Platform is an extension naming the GOOS/GOARCH the profile was
+	// recorded on
+	Platform string `xml:"platform,attr,omitempty"`
+	// RunType is an extension naming the kind of go test run the profile
+	// comes from: unit, fuzz (go test -fuzz) or bench (go test -bench -run ^$)
+	RunType string `xml:"run-type,attr,omitempty"`
+	// Mocks is an extension listing the mocks left out when ExcludeMocks is
+	// set, with the methods exercised
+	Mocks []*Mock `xml:"mock"`
+	// DeadCode is an extension listing the functions that are neither
+	// covered nor referenced, filled by tools analyzing the sources
+	DeadCode []*DeadFunction `xml:"dead-function"`
+	// Trivial is an extension listing the functions left out when
+	// ExcludeTrivial is set
+	Trivial []*TrivialFunction `xml:"trivial-function"`
+	// Metadata is an extension describing how the report was generated
+	Metadata *Metadata `xml:"metadata"`
+	// TestPackages is an extension holding the test results of every package
+	// when converting a go test -json stream
+	TestPackages []*TestPackage `xml:"test-package"`
+	// Extra and Unknown hold attributes and child elements unknown to
+	// gobertura, kept when decoding third-party reports, and Comment their
+	// comments, joined
+	Extra   []xml.Attr `xml:",any,attr"`
+	Comment string     `xml:",comment"`
+	Unknown []*Element `xml:",any"`
+}
+
+// Run types a report can be labeled with, see Coverage.RunType
+const (
+	RunUnit  = "unit"
+	RunFuzz  = "fuzz"
+	RunBench = "bench"
+	RunMixed = "mixed"
+)
+
+// InitializerMethod is the method of the "-" class of every file holding the
+// lines of its package-level variable initializers, executed at init like
+// the static initializers javac names so
+const InitializerMethod = "<clinit>"
+
+// DeadFunction is a function, or a method of Class when it isn't "-", that
+// is candidate for deletion rather than testing
+type DeadFunction struct {
+	Filename string `xml:"filename,attr"`
+	Class    string `xml:"class,attr"`
+	Name     string `xml:"name,attr"`
+	Line     int    `xml:"line,attr,omitempty"`
+}
+
+// Metadata records the cover mode of the profile and the tool, Go version and
+// arguments the report was generated with, so that it describes itself
+type Metadata struct {
+	Mode      string   `xml:"mode,attr,omitempty"`
+	Tool      string   `xml:"tool,attr,omitempty"`
+	GoVersion string   `xml:"go-version,attr,omitempty"`
+	Args      []string `xml:"arg"`
 }
 
 type Source struct {
 	Path string `xml:",chardata"`
 }
 
+type Unresolved struct {
+	Path   string `xml:"path,attr" json:"path"`
+	Reason string `xml:"reason,attr" json:"reason"`
+}
+
+// HasFlag reports whether the report is labeled with flag
+func (cov Coverage) HasFlag(flag string) bool {
+	for _, f := range cov.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Element is an XML element unknown to gobertura, such as the conditions of
+// a line, kept verbatim so round-tripping a report doesn't strip data
+type Element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content []byte     `xml:",innerxml"`
+}
+
+// UnmarshalXML keeps the element and its content, including comments, as
+// they were read by RawDecoder: the only namespace left resolved by it is
+// the default one, which is dropped as it is declared by an xmlns attribute
+// kept on the element or one of its parents
+func (e *Element) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	e.XMLName = xml.Name{Local: start.Name.Local}
+	e.Attrs = plainAttrs(start.Attr)
+	var content bytes.Buffer
+	encoder := xml.NewEncoder(&content)
+	for depth := 1; ; {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch token := t.(type) {
+		case xml.StartElement:
+			depth++
+			t = xml.StartElement{Name: xml.Name{Local: token.Name.Local}, Attr: plainAttrs(token.Attr)}
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				err = encoder.Flush()
+				e.Content = content.Bytes()
+				return err
+			}
+			t = xml.EndElement{Name: xml.Name{Local: token.Name.Local}}
+		}
+		err = encoder.EncodeToken(t)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// plainAttrs returns attrs without the default namespace, see UnmarshalXML
+func plainAttrs(attrs []xml.Attr) []xml.Attr {
+	var plain []xml.Attr
+	for _, attr := range attrs {
+		plain = append(plain, xml.Attr{Name: xml.Name{Local: attr.Name.Local}, Value: attr.Value})
+	}
+	return plain
+}
+
 type Package struct {
-	Name       string   `xml:"name,attr"`
-	LineRate   float32  `xml:"line-rate,attr"`
-	BranchRate float32  `xml:"branch-rate,attr"`
-	Complexity float32  `xml:"complexity,attr"`
-	Classes    []*Class `xml:"classes>class"`
+	Name       string     `xml:"name,attr"`
+	LineRate   float64    `xml:"line-rate,attr"`
+	BranchRate float64    `xml:"branch-rate,attr"`
+	Complexity float64    `xml:"complexity,attr"`
+	Classes    []*Class   `xml:"classes>class"`
+	Extra      []xml.Attr `xml:",any,attr"`
+	Comment    string     `xml:",comment"`
+	Unknown    []*Element `xml:",any"`
 }
 
 type Class struct {
-	Name       string    `xml:"name,attr"`
-	Filename   string    `xml:"filename,attr"`
-	LineRate   float32   `xml:"line-rate,attr"`
-	BranchRate float32   `xml:"branch-rate,attr"`
-	Complexity float32   `xml:"complexity,attr"`
-	Methods    []*Method `xml:"methods>method"`
-	Lines      Lines     `xml:"lines>line"`
+	Name     string `xml:"name,attr"`
+	Filename string `xml:"filename,attr"`
+	Category string `xml:"category,attr,omitempty"`
+	// Asset is an extension marking the non-Go files listed by ListAssets,
+	// SourceHash one hashing the file and options, set with HashSources, and
+	// Main one marking the files of package main with DetectMain
+	Asset      bool    `xml:"asset,attr,omitempty"`
+	SourceHash string  `xml:"source-hash,attr,omitempty"`
+	Main       bool    `xml:"main,attr,omitempty"`
+	LineRate   float64 `xml:"line-rate,attr"`
+	BranchRate float64 `xml:"branch-rate,attr"`
+	Complexity float64 `xml:"complexity,attr"`
+	// FirstLine and LastLine are extensions holding the first and last line
+	// of the methods of the class
+	FirstLine int        `xml:"first-line,attr,omitempty"`
+	LastLine  int        `xml:"last-line,attr,omitempty"`
+	Methods   []*Method  `xml:"methods>method"`
+	Lines     Lines      `xml:"lines>line"`
+	Extra     []xml.Attr `xml:",any,attr"`
+	Comment   string     `xml:",comment"`
+	Unknown   []*Element `xml:",any"`
 }
 
 type Method struct {
 	Name       string  `xml:"name,attr"`
 	Signature  string  `xml:"signature,attr"`
-	LineRate   float32 `xml:"line-rate,attr"`
-	BranchRate float32 `xml:"branch-rate,attr"`
-	Complexity float32 `xml:"complexity,attr"`
-	Lines      Lines   `xml:"lines>line"`
+	LineRate   float64 `xml:"line-rate,attr"`
+	BranchRate float64 `xml:"branch-rate,attr"`
+	Complexity float64 `xml:"complexity,attr"`
+	// FirstLine and LastLine are extensions holding the lines the method
+	// starts and ends at
+	FirstLine int   `xml:"first-line,attr,omitempty"`
+	LastLine  int   `xml:"last-line,attr,omitempty"`
+	Lines     Lines `xml:"lines>line"`
+	// Function is an extension marking the top-level functions reported in
+	// the class of a type with GroupByType
+	Function bool `xml:"function,attr,omitempty"`
+	// Deprecated is an extension marking the methods documented as
+	// deprecated with DetectDeprecated
+	Deprecated bool `xml:"deprecated,attr,omitempty"`
+	// Tests is an extension naming the tests covering the method, see AddTests
+	Tests   []string   `xml:"test"`
+	Extra   []xml.Attr `xml:",any,attr"`
+	Comment string     `xml:",comment"`
+	Unknown []*Element `xml:",any"`
 }
 
 type Line struct {
 	Number int   `xml:"number,attr"`
 	Hits   int64 `xml:"hits,attr"`
+	// Statements and StatementsWithHits are extensions counting the
+	// statements of the profile blocks starting on the line, filled when
+	// weighting by statements
+	Statements         int64 `xml:"statements,attr,omitempty"`
+	StatementsWithHits int64 `xml:"statements-with-hits,attr,omitempty"`
+	// Platforms is an extension holding the hits of every platform, filled
+	// by MergePlatforms
+	Platforms []*PlatformHits `xml:"platform"`
+	Extra     []xml.Attr      `xml:",any,attr"`
+	Comment   string          `xml:",comment"`
+	Unknown   []*Element      `xml:",any"`
 }
 
 // Lines is a slice of Line pointers, with some convenience methods
 type Lines []*Line
 
-// HitRate returns a float32 from 0.0 to 1.0 representing what fraction of lines
-// have hits
-func (lines Lines) HitRate() (hitRate float32) {
-	return float32(lines.NumLinesWithHits()) / float32(len(lines))
+// HitRate returns a float64 from 0.0 to 1.0 representing what fraction of lines
+// have hits, or of statements when lines are weighted by statements
+func (lines Lines) HitRate() (hitRate float64) {
+	if numStatements := lines.NumStatements(); numStatements > 0 {
+		return ratio(lines.NumStatementsWithHits(), numStatements)
+	}
+	return ratio(lines.NumLinesWithHits(), lines.NumLines())
 }
 
 // NumLines returns the number of lines
@@ -88,6 +369,37 @@ func (lines Lines) NumLinesWithHits() (numLinesWithHits int64) {
 	return numLinesWithHits
 }
 
+// NumStatements returns the number of statements, 0 unless lines are weighted
+// by statements
+func (lines Lines) NumStatements() (numStatements int64) {
+	for _, line := range lines {
+		numStatements += line.Statements
+	}
+	return numStatements
+}
+
+// NumStatementsWithHits returns the number of statements with a hit count > 0
+func (lines Lines) NumStatementsWithHits() (numStatementsWithHits int64) {
+	for _, line := range lines {
+		numStatementsWithHits += line.StatementsWithHits
+	}
+	return numStatementsWithHits
+}
+
+// AddStatements accounts the statements of a profile block starting on
+// lineNumber, which must already be recorded
+func (lines Lines) AddStatements(lineNumber int, statements int64, hit bool) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Number == lineNumber {
+			lines[i].Statements += statements
+			if hit {
+				lines[i].StatementsWithHits += statements
+			}
+			return
+		}
+	}
+}
+
 // AddOrUpdateLine adds a line if it is a different line than the last line recorded.
 // If it's the same line as the last line recorded then we update the hits down
 // if the new hits is less; otherwise just leave it as-is
@@ -104,9 +416,9 @@ func (lines *Lines) AddOrUpdateLine(lineNumber int, hits int64) {
 	*lines = append(*lines, &Line{Number: lineNumber, Hits: hits})
 }
 
-// HitRate returns a float32 from 0.0 to 1.0 representing what fraction of lines
+// HitRate returns a float64 from 0.0 to 1.0 representing what fraction of lines
 // have hits
-func (method Method) HitRate() float32 {
+func (method Method) HitRate() float64 {
 	return method.Lines.HitRate()
 }
 
@@ -120,10 +432,23 @@ func (method Method) NumLinesWithHits() int64 {
 	return method.Lines.NumLinesWithHits()
 }
 
-// HitRate returns a float32 from 0.0 to 1.0 representing what fraction of lines
-// have hits
-func (class Class) HitRate() float32 {
-	return float32(class.NumLinesWithHits()) / float32(class.NumLines())
+// NumStatements returns the number of statements
+func (method Method) NumStatements() int64 {
+	return method.Lines.NumStatements()
+}
+
+// NumStatementsWithHits returns the number of statements with a hit count > 0
+func (method Method) NumStatementsWithHits() int64 {
+	return method.Lines.NumStatementsWithHits()
+}
+
+// HitRate returns a float64 from 0.0 to 1.0 representing what fraction of lines
+// have hits, or of statements when lines are weighted by statements
+func (class Class) HitRate() float64 {
+	if numStatements := class.NumStatements(); numStatements > 0 {
+		return ratio(class.NumStatementsWithHits(), numStatements)
+	}
+	return ratio(class.NumLinesWithHits(), class.NumLines())
 }
 
 // NumLines returns the number of lines
@@ -142,10 +467,29 @@ func (class Class) NumLinesWithHits() (numLinesWithHits int64) {
 	return numLinesWithHits
 }
 
-// HitRate returns a float32 from 0.0 to 1.0 representing what fraction of lines
-// have hits
-func (pkg Package) HitRate() float32 {
-	return float32(pkg.NumLinesWithHits()) / float32(pkg.NumLines())
+// NumStatements returns the number of statements
+func (class Class) NumStatements() (numStatements int64) {
+	for _, method := range class.Methods {
+		numStatements += method.NumStatements()
+	}
+	return numStatements
+}
+
+// NumStatementsWithHits returns the number of statements with a hit count > 0
+func (class Class) NumStatementsWithHits() (numStatementsWithHits int64) {
+	for _, method := range class.Methods {
+		numStatementsWithHits += method.NumStatementsWithHits()
+	}
+	return numStatementsWithHits
+}
+
+// HitRate returns a float64 from 0.0 to 1.0 representing what fraction of lines
+// have hits, or of statements when lines are weighted by statements
+func (pkg Package) HitRate() float64 {
+	if numStatements := pkg.NumStatements(); numStatements > 0 {
+		return ratio(pkg.NumStatementsWithHits(), numStatements)
+	}
+	return ratio(pkg.NumLinesWithHits(), pkg.NumLines())
 }
 
 // NumLines returns the number of lines
@@ -164,10 +508,29 @@ func (pkg Package) NumLinesWithHits() (numLinesWithHits int64) {
 	return numLinesWithHits
 }
 
-// HitRate returns a float32 from 0.0 to 1.0 representing what fraction of lines
-// have hits
-func (cov Coverage) HitRate() float32 {
-	return float32(cov.NumLinesWithHits()) / float32(cov.NumLines())
+// NumStatements returns the number of statements
+func (pkg Package) NumStatements() (numStatements int64) {
+	for _, class := range pkg.Classes {
+		numStatements += class.NumStatements()
+	}
+	return numStatements
+}
+
+// NumStatementsWithHits returns the number of statements with a hit count > 0
+func (pkg Package) NumStatementsWithHits() (numStatementsWithHits int64) {
+	for _, class := range pkg.Classes {
+		numStatementsWithHits += class.NumStatementsWithHits()
+	}
+	return numStatementsWithHits
+}
+
+// HitRate returns a float64 from 0.0 to 1.0 representing what fraction of lines
+// have hits, or of statements when lines are weighted by statements
+func (cov Coverage) HitRate() float64 {
+	if numStatements := cov.NumStatements(); numStatements > 0 {
+		return ratio(cov.NumStatementsWithHits(), numStatements)
+	}
+	return ratio(cov.NumLinesWithHits(), cov.NumLines())
 }
 
 // NumLines returns the number of lines
@@ -186,57 +549,406 @@ func (cov Coverage) NumLinesWithHits() (numLinesWithHits int64) {
 	return numLinesWithHits
 }
 
+// NumStatements returns the number of statements
+func (cov Coverage) NumStatements() (numStatements int64) {
+	for _, pkg := range cov.Packages {
+		numStatements += pkg.NumStatements()
+	}
+	return numStatements
+}
+
+// NumStatementsWithHits returns the number of statements with a hit count > 0
+func (cov Coverage) NumStatementsWithHits() (numStatementsWithHits int64) {
+	for _, pkg := range cov.Packages {
+		numStatementsWithHits += pkg.NumStatementsWithHits()
+	}
+	return numStatementsWithHits
+}
+
 func (cov *Coverage) ParseProfiles(profiles []*cover.Profile) error {
 	cov.Packages = []*Package{}
+	cov.Unresolved = nil
+	cov.Partial = false
+	cov.Mocks = nil
+	cov.Trivial = nil
+	cov.Reused = nil
+	cov.Mismatches = map[string]int{}
+	cov.ParseTimes = map[string]time.Duration{}
+	if cov.ClassifyLines {
+		cov.LineKinds = map[string]map[int]string{}
+	}
+	if cov.FS != nil && len(cov.Overlay) > 0 {
+		return fmt.Errorf("Overlay can't be used with FS")
+	}
+	cov.indexOverlay()
+	cov.indexPrevious()
+
+	// The same file may be listed under different roots, e.g. the module
+	// cache and the workspace, and is reported once under its import path
+	var names []string
+	byName := map[string][]*cover.Profile{}
 	for _, profile := range profiles {
-		err := cov.parseProfile(profile)
-		if err != nil {
-			return err
+		name := cov.canonicalName(cov.logicalName(profile.FileName))
+		if byName[name] == nil {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], profile)
+	}
+	// A package is complete once its last file is parsed
+	last := map[string]int{}
+	for i, name := range names {
+		last[packageName(name)] = i
+	}
+	for i, name := range names {
+		if len(byName[name]) > 1 && cov.Logger != nil {
+			cov.Logger.Debug("merging profiles of the same file", "file", name, "profiles", len(byName[name]))
+		}
+		profile := mergeProfiles(byName[name])
+		profile.FileName = cov.sourceFile(name, byName[name])
+		start := time.Now()
+		if !cov.Deadline.IsZero() && !start.Before(cov.Deadline) {
+			cov.pastDeadline(cov.TrimPackagePath(profile.FileName))
+		} else {
+			err := cov.parseProfile(name, profile)
+			if err != nil {
+				return err
+			}
+			cov.ParseTimes[name] = time.Since(start)
+		}
+		if last[packageName(name)] == i {
+			err := cov.packageDone(packageName(name), filepath.Dir(cov.TrimPackagePath(profile.FileName)))
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	cov.LinesValid = cov.NumLines()
 	cov.LinesCovered = cov.NumLinesWithHits()
 	cov.LineRate = cov.HitRate()
+	if cov.Classify {
+		cov.Categories = cov.CategoryTotals()
+	}
+	if cov.DetectDeprecated {
+		cov.Deprecated, _ = cov.DeprecatedTotals()
+	}
+	if cov.DetectMain {
+		cov.Entrypoints = cov.MainTotals()
+	}
 	return nil
 }
 
-func (cov *Coverage) parseProfile(profile *cover.Profile) error {
-	fileName := strings.TrimPrefix(profile.FileName, cov.PackagePath)
+// parseProfile adds the classes of the file of profile, reported as name
+func (cov *Coverage) parseProfile(name string, profile *cover.Profile) error {
+	fileName := cov.TrimPackagePath(profile.FileName)
 
 	fset := token.NewFileSet()
-	parsed, err := parser.ParseFile(fset, fileName, nil, 0)
+	mode := parser.Mode(0)
+	if cov.Classify || cov.ExcludeMocks || cov.GroupByType || cov.DetectDeprecated {
+		mode = parser.ParseComments
+	}
+	data, err := cov.readSource(fileName)
 	if err != nil {
-		return err
+		return cov.unresolved(fileName, err)
+	}
+	hash := ""
+	if cov.HashSources || cov.Previous != nil {
+		hash = cov.sourceHash(data)
 	}
-	data, err := ioutil.ReadFile(fileName)
+	if previous := cov.unchanged(name, hash); previous != nil {
+		cov.reuseClasses(cov.newVisitor(name, data, profile), previous, hash)
+		return nil
+	}
+	parsed, err := parser.ParseFile(fset, fileName, data, mode)
 	if err != nil {
-		return err
+		return cov.unresolved(fileName, err)
 	}
 
-	pkgPath, _ := filepath.Split(fileName)
-	pkgPath = strings.TrimRight(pkgPath, string(os.PathSeparator))
+	visitor := cov.newVisitor(name, data, profile)
+	visitor.fset = fset
+	if cov.GroupByType {
+		visitor.types = fileTypes(parsed)
+	}
+	if cov.Classify {
+		visitor.category = classify(name, parsed)
+	}
+	visitor.main = cov.DetectMain && parsed.Name.Name == "main"
+	if generator := mockGenerator(parsed); cov.ExcludeMocks && generator != "" {
+		cov.addMocks(name, generator, parsed, visitor)
+		return nil
+	}
 
-	var pkg *Package
-	for _, p := range cov.Packages {
-		if p.Name == pkgPath {
-			pkg = p
-		}
+	if cov.ClassifyLines {
+		cov.LineKinds[name] = lineKinds(data, profile)
 	}
-	if pkg == nil {
-		pkg = &Package{Name: pkgPath, Classes: []*Class{}}
-		cov.Packages = append(cov.Packages, pkg)
+
+	visitor.pkg = cov.packageOf(name)
+	ast.Walk(visitor, parsed)
+	for _, class := range visitor.classes {
+		class.sortByPosition()
+		class.SourceHash = hash
+	}
+	cov.Trivial = append(cov.Trivial, visitor.trivial...)
+	visitor.pkg.LineRate = visitor.pkg.HitRate()
+	return nil
+}
+
+// newVisitor returns the visitor of the file of profile, reported as name,
+// whose source is data, recording its mismatches
+func (cov *Coverage) newVisitor(name string, data []byte, profile *cover.Profile) *fileVisitor {
+	if n := outOfSource(profile, data); n > 0 {
+		cov.Mismatches[name] += n
 	}
 	visitor := &fileVisitor{
-		fset:     fset,
-		fileName: fileName,
+		fileName: name,
 		fileData: data,
 		classes:  make(map[string]*Class),
-		pkg:      pkg,
 		profile:  profile,
 	}
-	ast.Walk(visitor, parsed)
-	pkg.LineRate = pkg.HitRate()
+	if profile.Mode != "set" {
+		visitor.minHits = cov.MinHits
+	}
+	visitor.weightStatements = cov.WeightStatements
+	visitor.excludeTrivial = cov.ExcludeTrivial
+	visitor.detectDeprecated = cov.DetectDeprecated
+	if cov.LineFilter != nil {
+		visitor.lineFilter = cov.LineFilter
+		visitor.sourceLines = strings.Split(string(data), "\n")
+	}
+	return visitor
+}
+
+// packageOf returns the package of the file reported as name, added if
+// needed
+func (cov *Coverage) packageOf(name string) *Package {
+	pkgPath := packageName(name)
+	pkg := cov.findPackage(pkgPath)
+	if pkg == nil {
+		pkg = &Package{Name: pkgPath, Classes: []*Class{}}
+		cov.Packages = append(cov.Packages, pkg)
+	}
+	return pkg
+}
+
+// TrimPackagePath returns fileName without the longest of PackagePath and
+// PackagePaths prefixing it
+func (cov Coverage) TrimPackagePath(fileName string) string {
+	prefix := ""
+	for _, p := range append([]string{cov.PackagePath}, cov.PackagePaths...) {
+		if strings.HasPrefix(fileName, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	return fileName[len(prefix):]
+}
+
+// packageName returns the name of the package of the file reported as name
+func packageName(name string) string {
+	pkgPath, _ := filepath.Split(name)
+	return strings.TrimRight(pkgPath, string(os.PathSeparator))
+}
+
+// findPackage returns the package named name, nil if there is none yet
+func (cov *Coverage) findPackage(name string) *Package {
+	for _, p := range cov.Packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// OnPackage registers fn to be called by ParseProfiles with every package as
+// soon as all its files are parsed. Packages aren't modified afterwards, so
+// fn can hand them to other goroutines, e.g. to stream them to a dashboard,
+// while the remaining files are parsed. Callbacks are called in the order
+// they were registered, from the goroutine calling ParseProfiles.
+func (cov *Coverage) OnPackage(fn func(*Package)) {
+	cov.onPackage = append(cov.onPackage, fn)
+}
+
+// packageDone completes the package named name, whose files are in dir: its
+// assets are listed when ListAssets is set, its classes renamed when
+// UniqueClasses is set and it is handed to the OnPackage callbacks. Packages
+// of unresolved files only don't exist.
+func (cov *Coverage) packageDone(name string, dir string) error {
+	pkg := cov.findPackage(name)
+	if pkg == nil {
+		return nil
+	}
+	if cov.ListAssets {
+		err := cov.listAssets(pkg, dir)
+		if err != nil {
+			return err
+		}
+	}
+	if cov.UniqueClasses {
+		uniqueClasses(pkg)
+	}
+	for _, fn := range cov.onPackage {
+		fn(pkg)
+	}
+	return nil
+}
+
+// canonicalName returns the path of fileName relative to the module: files
+// of the module cache are mapped back to their import path and absolute paths
+// are made relative to the module, see relativeName
+func (cov *Coverage) canonicalName(fileName string) string {
+	name := filepath.ToSlash(fileName)
+	if i := strings.Index(name, "/pkg/mod/"); i >= 0 && strings.Contains(name[i:], "@") {
+		// GOMODCACHE/example.com/!some/mod@v1.2.3/pkg/file.go
+		name = name[i+len("/pkg/mod/"):]
+		at := strings.Index(name, "@")
+		if end := strings.Index(name[at:], "/"); end >= 0 {
+			name = name[:at] + name[at+end:]
+		}
+		name = unescapeModulePath(name)
+	} else if filepath.IsAbs(fileName) {
+		name = cov.relativeName(fileName)
+	}
+	return filepath.FromSlash(cov.TrimPackagePath(name))
+}
+
+// relativeName returns the slash separated path of the absolute fileName
+// relative to the module, as written by build systems compiling elsewhere:
+//   - below a source folder, relative to it
+//   - below a GOPATH-like directory holding the package path, the import path
+//   - of an existing file, relative to the closest go.mod
+//   - otherwise, the longest suffix naming a file of a source folder
+//
+// fileName is kept as is when none applies.
+func (cov *Coverage) relativeName(fileName string) string {
+	name := filepath.ToSlash(fileName)
+	for _, source := range cov.Sources {
+		rel, err := filepath.Rel(source.Path, fileName)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	for _, prefix := range append([]string{cov.PackagePath}, cov.PackagePaths...) {
+		if prefix == "" {
+			continue
+		}
+		if i := strings.Index(name, "/"+prefix); i >= 0 {
+			return name[i+1:]
+		}
+	}
+	if cov.FS == nil && cov.sourceExists(fileName) {
+		if root, err := moduleRoot(filepath.Dir(fileName)); err == nil {
+			rel, err := filepath.Rel(root, fileName)
+			if err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		for _, source := range cov.Sources {
+			suffix := filepath.Join(parts[i:]...)
+			if cov.sourceExists(filepath.Join(source.Path, suffix)) {
+				return filepath.ToSlash(suffix)
+			}
+		}
+	}
+	return name
+}
+
+// sourceFile returns the local file to read for the profile of the file
+// reported as name, which may have been written elsewhere
+func (cov *Coverage) sourceFile(name string, profiles []*cover.Profile) string {
+	for _, p := range profiles {
+		fileName := cov.logicalName(p.FileName)
+		if cov.sourceExists(cov.TrimPackagePath(fileName)) {
+			return fileName
+		}
+	}
+	for _, source := range cov.Sources {
+		path := filepath.Join(source.Path, name)
+		if cov.sourceExists(path) && filepath.IsAbs(profiles[0].FileName) {
+			return path
+		}
+	}
+	return cov.logicalName(profiles[0].FileName)
+}
+
+// unescapeModulePath reverses the escaping of upper case letters, written as
+// "!" and the lower case letter, of module cache paths
+func unescapeModulePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '!' && i+1 < len(path) {
+			i++
+			b.WriteString(strings.ToUpper(path[i : i+1]))
+			continue
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// mergeProfiles returns a profile holding the blocks of profiles, which list
+// the same file, combining duplicate blocks. Profiles built by hand or by
+// other parsers may repeat blocks, which would otherwise be counted as
+// separate statements of the same line. When modes differ, counts are summed
+// in the first mode other than set.
+func mergeProfiles(profiles []*cover.Profile) *cover.Profile {
+	merged := &cover.Profile{FileName: profiles[0].FileName, Mode: profiles[0].Mode}
+	for _, profile := range profiles {
+		if merged.Mode == "set" {
+			merged.Mode = profile.Mode
+		}
+		merged.Blocks = append(merged.Blocks, profile.Blocks...)
+	}
+	merged.Blocks = mergeBlocks(merged.Mode, merged.Blocks)
+	return merged
+}
+
+// mergeBlocks sorts blocks, combining the counts of blocks covering the same
+// range like go tool cover: summed, or or-ed in set mode
+func mergeBlocks(mode string, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		a, b := blocks[i], blocks[j]
+		return a.StartLine < b.StartLine || a.StartLine == b.StartLine && a.StartCol < b.StartCol
+	})
+	var merged []cover.ProfileBlock
+	for _, b := range blocks {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.StartLine == b.StartLine && last.StartCol == b.StartCol && last.EndLine == b.EndLine && last.EndCol == b.EndCol {
+				if mode == "set" {
+					last.Count |= b.Count
+				} else {
+					last.Count = addCounts(last.Count, b.Count)
+				}
+				continue
+			}
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// pastDeadline records fileName, not parsed because Deadline passed, as
+// unresolved and the report as partial
+func (cov *Coverage) pastDeadline(fileName string) {
+	if !cov.Partial && cov.Logger != nil {
+		cov.Logger.Warn("deadline exceeded, skipping the remaining files", "deadline", cov.Deadline)
+	}
+	cov.Partial = true
+	cov.Unresolved = append(cov.Unresolved, &Unresolved{Path: fileName, Reason: "deadline exceeded"})
+}
+
+// unresolved records fileName as unresolved when SkipMissing is set, otherwise
+// it returns err as-is
+func (cov *Coverage) unresolved(fileName string, err error) error {
+	if !cov.SkipMissing {
+		return err
+	}
+	if cov.Logger != nil {
+		cov.Logger.Warn("skipping unresolved file", "file", fileName, "error", err)
+	}
+	cov.Unresolved = append(cov.Unresolved, &Unresolved{Path: fileName, Reason: err.Error()})
 	return nil
 }
 
@@ -247,29 +959,97 @@ type fileVisitor struct {
 	pkg      *Package
 	classes  map[string]*Class
 	profile  *cover.Profile
+	minHits  int64
+
+	weightStatements bool
+	lineFilter       func(file string, line int, text string) bool
+	sourceLines      []string
+	category         string
+	main             bool
+	excludeTrivial   bool
+	trivial          []*TrivialFunction
+	detectDeprecated bool
+	// types are the types declared in the file when grouping by type
+	types map[string]bool
 }
 
 func (v *fileVisitor) Visit(node ast.Node) ast.Visitor {
 	switch n := node.(type) {
 	case *ast.FuncDecl:
-		class := v.class(n)
 		method := v.method(n)
-		method.LineRate = method.Lines.HitRate()
-		class.Methods = append(class.Methods, method)
-		for _, line := range method.Lines {
-			class.Lines = append(class.Lines, line)
+		if v.excludeTrivial && isTrivial(n, method) {
+			v.trivial = append(v.trivial, &TrivialFunction{Filename: v.fileName, Class: v.className(n), Name: n.Name.Name, Line: method.FirstLine})
+			return v
+		}
+		class := v.class(n)
+		method.Function = n.Recv == nil && class.Name != "-"
+		method.Deprecated = v.detectDeprecated && isDeprecated(n.Doc)
+		class.addMethod(method)
+	case *ast.File:
+		if method := v.initializer(n); method != nil {
+			v.classNamed("-").addMethod(method)
 		}
-		class.LineRate = class.Lines.HitRate()
 	}
 	return v
 }
 
+// addMethod adds method and its lines to the class
+func (class *Class) addMethod(method *Method) {
+	method.LineRate = method.Lines.HitRate()
+	class.Methods = append(class.Methods, method)
+	for _, line := range method.Lines {
+		class.Lines = append(class.Lines, line)
+	}
+	class.addRange(method.FirstLine, method.LastLine)
+	class.LineRate = class.Lines.HitRate()
+}
+
 func (v *fileVisitor) method(n *ast.FuncDecl) *Method {
 	method := &Method{Name: n.Name.Name}
 	method.Lines = Lines{}
 
 	start := v.fset.Position(n.Pos())
 	end := v.fset.Position(n.End())
+	method.FirstLine, method.LastLine = start.Line, end.Line
+	v.addBlocks(method, start, end)
+	if v.lineFilter != nil {
+		method.Lines = v.filterLines(method.Lines)
+	}
+	sort.SliceStable(method.Lines, func(i, j int) bool { return method.Lines[i].Number < method.Lines[j].Number })
+	return method
+}
+
+// initializer returns the InitializerMethod of file, holding the blocks of
+// the values of its package-level variables such as function literals, nil
+// when there are none
+func (v *fileVisitor) initializer(file *ast.File) *Method {
+	method := &Method{Name: InitializerMethod}
+	method.Lines = Lines{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, value := range spec.(*ast.ValueSpec).Values {
+				v.addBlocks(method, v.fset.Position(value.Pos()), v.fset.Position(value.End()))
+			}
+		}
+	}
+	if v.lineFilter != nil {
+		method.Lines = v.filterLines(method.Lines)
+	}
+	if len(method.Lines) == 0 {
+		return nil
+	}
+	sort.SliceStable(method.Lines, func(i, j int) bool { return method.Lines[i].Number < method.Lines[j].Number })
+	method.FirstLine, method.LastLine = method.Lines[0].Number, method.Lines[len(method.Lines)-1].Number
+	return method
+}
+
+// addBlocks adds to method the lines of the profile blocks between start and
+// end
+func (v *fileVisitor) addBlocks(method *Method, start token.Position, end token.Position) {
 	startLine := start.Line
 	startCol := start.Column
 	endLine := end.Line
@@ -284,31 +1064,84 @@ func (v *fileVisitor) method(n *ast.FuncDecl) *Method {
 			// Before the beginning of the function
 			continue
 		}
-		for i := b.StartLine; i <= b.EndLine; i++ {
-			method.Lines.AddOrUpdateLine(i, int64(b.Count))
+		v.addBlock(method, b)
+	}
+}
+
+// addBlock adds to method the lines of the profile block b
+func (v *fileVisitor) addBlock(method *Method, b cover.ProfileBlock) {
+	hits := int64(b.Count)
+	if hits < v.minHits {
+		hits = 0
+	}
+	for i := b.StartLine; i <= b.EndLine; i++ {
+		method.Lines.AddOrUpdateLine(i, hits)
+	}
+	if v.weightStatements {
+		method.Lines.AddStatements(b.StartLine, int64(b.NumStmt), hits > 0)
+	}
+}
+
+func (v *fileVisitor) filterLines(lines Lines) Lines {
+	kept := Lines{}
+	for _, line := range lines {
+		text := ""
+		if line.Number <= len(v.sourceLines) {
+			text = v.sourceLines[line.Number-1]
+		}
+		if v.lineFilter(v.fileName, line.Number, text) {
+			kept = append(kept, line)
 		}
 	}
-	return method
+	return kept
+}
+
+// addRange extends the first and last lines of the class to include the
+// lines from first to last
+func (class *Class) addRange(first int, last int) {
+	if first > 0 && (class.FirstLine == 0 || first < class.FirstLine) {
+		class.FirstLine = first
+	}
+	if last > class.LastLine {
+		class.LastLine = last
+	}
+}
+
+// sortByPosition orders the methods of the class by their first line and its
+// lines by number
+func (class *Class) sortByPosition() {
+	sort.SliceStable(class.Methods, func(i, j int) bool { return class.Methods[i].FirstLine < class.Methods[j].FirstLine })
+	sort.SliceStable(class.Lines, func(i, j int) bool { return class.Lines[i].Number < class.Lines[j].Number })
 }
 
 func (v *fileVisitor) class(n *ast.FuncDecl) *Class {
-	className := v.recvName(n)
+	return v.classNamed(v.className(n))
+}
+
+// classNamed returns the class of the file named className, added to the
+// package if needed
+func (v *fileVisitor) classNamed(className string) *Class {
 	class := v.classes[className]
 	if class == nil {
-		class = &Class{Name: className, Filename: v.fileName, Methods: []*Method{}, Lines: Lines{}}
+		class = &Class{Name: className, Filename: v.fileName, Category: v.category, Main: v.main, Methods: []*Method{}, Lines: Lines{}}
 		v.classes[className] = class
 		v.pkg.Classes = append(v.pkg.Classes, class)
 	}
 	return class
 }
 
+// className returns the class of n: its receiver type, or when grouping by
+// type the type a top-level function is associated with
+func (v *fileVisitor) className(n *ast.FuncDecl) string {
+	if n.Recv == nil && v.types != nil {
+		return v.associatedType(n)
+	}
+	return v.recvName(n)
+}
+
 func (v *fileVisitor) recvName(n *ast.FuncDecl) string {
 	if n.Recv == nil {
 		return "-"
 	}
-	recv := n.Recv.List[0].Type
-	start := v.fset.Position(recv.Pos())
-	end := v.fset.Position(recv.End())
-	name := string(v.fileData[start.Offset:end.Offset])
-	return strings.TrimSpace(strings.TrimLeft(name, "*"))
+	return v.typeName(n.Recv.List[0].Type)
 }
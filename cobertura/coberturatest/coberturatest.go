@@ -0,0 +1,201 @@
+// Package coberturatest helps testing the programs built on the cobertura
+// package: it builds synthetic profiles, converts them against sources held
+// in an fs.FS such as an embed.FS or a fstest.MapFS, compares reports
+// structurally and checks them against golden XML files.
+package coberturatest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"golang.org/x/tools/cover"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// UpdateGolden makes Golden write the golden files instead of checking them,
+// set when GOBERTURA_UPDATE_GOLDEN is
+var UpdateGolden = os.Getenv("GOBERTURA_UPDATE_GOLDEN") != ""
+
+// Epsilon is the difference tolerated between the rates of compared reports
+var Epsilon = 1e-9
+
+// Block returns a profile block of numStmt statements executed count times,
+// from startLine.startCol to endLine.endCol
+func Block(startLine, startCol, endLine, endCol, numStmt, count int) cover.ProfileBlock {
+	return cover.ProfileBlock{
+		StartLine: startLine,
+		StartCol:  startCol,
+		EndLine:   endLine,
+		EndCol:    endCol,
+		NumStmt:   numStmt,
+		Count:     count,
+	}
+}
+
+// Profile returns the profile of fileName, as listed by go test, e.g.
+// example.com/mod/pkg/file.go, in mode set, count or atomic
+func Profile(fileName string, mode string, blocks ...cover.ProfileBlock) *cover.Profile {
+	return &cover.Profile{FileName: fileName, Mode: mode, Blocks: blocks}
+}
+
+// ParseProfiles parses the text of a go test -coverprofile file, failing t
+// when it is malformed
+func ParseProfiles(t testing.TB, text string) []*cover.Profile {
+	t.Helper()
+	profiles, err := cobertura.ParseProfile(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("parsing profile: %v", err)
+	}
+	return profiles
+}
+
+// Convert converts profiles of the files of module, reading their sources
+// from fsys by their path in the module, failing t when it can't. The report
+// has a zero timestamp.
+func Convert(t testing.TB, fsys fs.FS, module string, profiles []*cover.Profile) *cobertura.Coverage {
+	t.Helper()
+	coverage := &cobertura.Coverage{
+		PackagePath: strings.TrimSuffix(module, "/") + "/",
+		FS:          fsys,
+		Sources:     []*cobertura.Source{{Path: "."}},
+	}
+	err := coverage.ParseProfiles(profiles)
+	if err != nil {
+		t.Fatalf("converting profiles: %v", err)
+	}
+	return coverage
+}
+
+// Equal fails t with the differences between want and got, see Diff
+func Equal(t testing.TB, want *cobertura.Coverage, got *cobertura.Coverage) {
+	t.Helper()
+	for _, d := range Diff(want, got) {
+		t.Error(d)
+	}
+}
+
+// Diff lists the differences between the reports want and got, such as
+// `Coverage.Packages[calc].Classes[Calc].Lines[12].Hits: want 1, got 0`.
+// Timestamps, the conversion options and results excluded from XML reports
+// and rate differences within Epsilon are ignored, as are nil and empty
+// slices.
+func Diff(want *cobertura.Coverage, got *cobertura.Coverage) []string {
+	var diffs []string
+	compare("Coverage", reflect.ValueOf(want), reflect.ValueOf(got), &diffs)
+	return diffs
+}
+
+func compare(path string, want reflect.Value, got reflect.Value, diffs *[]string) {
+	switch want.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			if want.IsNil() != got.IsNil() {
+				*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, describe(want), describe(got)))
+			}
+			return
+		}
+		compare(path, want.Elem(), got.Elem(), diffs)
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			field := want.Type().Field(i)
+			if field.PkgPath != "" || field.Tag.Get("xml") == "-" || field.Type == reflect.TypeOf(xml.Name{}) || field.Name == "Timestamp" && want.Type() == reflect.TypeOf(cobertura.Coverage{}) {
+				continue
+			}
+			compare(path+"."+field.Name, want.Field(i), got.Field(i), diffs)
+		}
+	case reflect.Slice:
+		if want.Type().Elem().Kind() == reflect.Uint8 {
+			if !bytes.Equal(want.Bytes(), got.Bytes()) {
+				*diffs = append(*diffs, fmt.Sprintf("%s: want %q, got %q", path, want.Bytes(), got.Bytes()))
+			}
+			return
+		}
+		if want.Len() != got.Len() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %d elements, got %d", path, want.Len(), got.Len()))
+		}
+		for i := 0; i < want.Len() && i < got.Len(); i++ {
+			compare(fmt.Sprintf("%s[%s]", path, key(want.Index(i), i)), want.Index(i), got.Index(i), diffs)
+		}
+	case reflect.Map:
+		if want.Len() != got.Len() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %d entries, got %d", path, want.Len(), got.Len()))
+		}
+		for _, k := range want.MapKeys() {
+			if g := got.MapIndex(k); g.IsValid() {
+				compare(fmt.Sprintf("%s[%v]", path, k), want.MapIndex(k), g, diffs)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if math.Abs(want.Float()-got.Float()) > Epsilon {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %v, got %v", path, want.Float(), got.Float()))
+		}
+	case reflect.Func:
+	default:
+		if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: want %#v, got %#v", path, want.Interface(), got.Interface()))
+		}
+	}
+}
+
+// key identifies the element v of a slice by its Name or Number, if any,
+// otherwise by its index i
+func key(v reflect.Value, i int) string {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		for _, name := range []string{"Name", "Number"} {
+			if f := v.FieldByName(name); f.IsValid() && (f.Kind() == reflect.String || f.Kind() == reflect.Int) {
+				return fmt.Sprint(f.Interface())
+			}
+		}
+	}
+	return fmt.Sprint(i)
+}
+
+func describe(v reflect.Value) string {
+	if v.IsNil() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+// Golden checks got against the report of the golden file at path, see
+// Diff, or writes it there with UpdateGolden
+func Golden(t testing.TB, path string, got *cobertura.Coverage) {
+	t.Helper()
+	if UpdateGolden {
+		c := *got
+		c.Timestamp = 0
+		data, err := xml.MarshalIndent(&c, "", "\t")
+		if err != nil {
+			t.Fatalf("encoding %s: %v", path, err)
+		}
+		data = append([]byte(xml.Header), append(data, '\n')...)
+		err = ioutil.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatalf("updating %s: %v", path, err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden report: %v, set GOBERTURA_UPDATE_GOLDEN=1 to create it", err)
+	}
+	want := &cobertura.Coverage{}
+	err = cobertura.UnmarshalRaw(data, want)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+	for _, d := range Diff(want, got) {
+		t.Errorf("%s: %s", path, d)
+	}
+}
@@ -0,0 +1,28 @@
+package cobertura
+
+import (
+	"bytes"
+	"golang.org/x/tools/cover"
+)
+
+// EndOfLine is the end column of blocks spanning the rest of their line,
+// such as those built from the line hits of LCOV reports, which don't know
+// the length of lines
+const EndOfLine = 1 << 30
+
+// outOfSource counts the blocks of profile that fall outside of data, the
+// source of its file
+func outOfSource(profile *cover.Profile, data []byte) int {
+	lines := bytes.Split(data, []byte("\n"))
+	valid := func(line, col int) bool {
+		return line >= 1 && line <= len(lines) && col >= 1 && (col <= len(lines[line-1])+1 || col == EndOfLine)
+	}
+	n := 0
+	for _, b := range profile.Blocks {
+		ordered := b.StartLine < b.EndLine || b.StartLine == b.EndLine && b.StartCol <= b.EndCol
+		if !ordered || !valid(b.StartLine, b.StartCol) || !valid(b.EndLine, b.EndCol) {
+			n++
+		}
+	}
+	return n
+}
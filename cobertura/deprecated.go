@@ -0,0 +1,64 @@
+package cobertura
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// CategoryDeprecated names the totals of the deprecated methods, see
+// DetectDeprecated
+const CategoryDeprecated = "deprecated"
+
+// isDeprecated reports whether doc has a paragraph starting with
+// "Deprecated:", the convention marking deprecated APIs
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	paragraph := true
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if paragraph && strings.HasPrefix(line, "Deprecated:") {
+			return true
+		}
+		paragraph = strings.TrimSpace(line) == ""
+	}
+	return false
+}
+
+// DeprecatedTotals sums the lines of the methods marked as deprecated and
+// those of the other lines of the report, weighted by statements when lines
+// carry them. Checking the rest leaves deprecated APIs, which are meant to
+// be removed rather than tested, out of thresholds.
+func (cov Coverage) DeprecatedTotals() (deprecated, rest *Category) {
+	deprecated, rest = &Category{Name: CategoryDeprecated}, &Category{}
+	var statements, statementsWithHits [2]int64
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			rest.LinesValid += class.Lines.NumLines()
+			rest.LinesCovered += class.Lines.NumLinesWithHits()
+			statements[1] += class.Lines.NumStatements()
+			statementsWithHits[1] += class.Lines.NumStatementsWithHits()
+			for _, method := range class.Methods {
+				if !method.Deprecated {
+					continue
+				}
+				deprecated.LinesValid += method.Lines.NumLines()
+				deprecated.LinesCovered += method.Lines.NumLinesWithHits()
+				statements[0] += method.Lines.NumStatements()
+				statementsWithHits[0] += method.Lines.NumStatementsWithHits()
+			}
+		}
+	}
+	rest.LinesValid -= deprecated.LinesValid
+	rest.LinesCovered -= deprecated.LinesCovered
+	statements[1] -= statements[0]
+	statementsWithHits[1] -= statementsWithHits[0]
+
+	for i, category := range []*Category{deprecated, rest} {
+		category.LineRate = rate(category.LinesCovered, category.LinesValid)
+		if statements[i] > 0 {
+			category.LineRate = rate(statementsWithHits[i], statements[i])
+		}
+	}
+	return deprecated, rest
+}
@@ -0,0 +1,41 @@
+package cobertura
+
+import "fmt"
+
+// Levels of detail a report can be trimmed to with TrimDetail
+const (
+	DetailPackage = "package"
+	DetailClass   = "class"
+	DetailMethod  = "method"
+	DetailLine    = "line"
+)
+
+// TrimDetail drops the elements of the report below detail, keeping the
+// rates and totals of the remaining ones. Trimmed reports can't be merged or
+// recomputed as both rely on line data.
+func (cov *Coverage) TrimDetail(detail string) error {
+	switch detail {
+	case DetailPackage, DetailClass, DetailMethod:
+	case DetailLine:
+		return nil
+	default:
+		return fmt.Errorf("unknown detail %q", detail)
+	}
+	for _, pkg := range cov.Packages {
+		if detail == DetailPackage {
+			pkg.Classes = nil
+			continue
+		}
+		for _, class := range pkg.Classes {
+			class.Lines = nil
+			if detail == DetailClass {
+				class.Methods = nil
+				continue
+			}
+			for _, method := range class.Methods {
+				method.Lines = nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package cobertura
+
+// CategoryMain names the totals of the classes of package main, see
+// DetectMain
+const CategoryMain = "main"
+
+// MainTotals sums the lines of the classes marked as being in package main,
+// weighted by statements when lines carry them. Commands are commonly kept
+// to thin entrypoints that aren't unit-tested, whatever their path: checking
+// TotalsWithout them leaves them out of thresholds while they're still
+// reported.
+func (cov Coverage) MainTotals() *Category {
+	var lines Lines
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			if class.Main {
+				lines = append(lines, class.Lines...)
+			}
+		}
+	}
+	return &Category{Name: CategoryMain, LineRate: lineRate(lines), LinesCovered: lines.NumLinesWithHits(), LinesValid: lines.NumLines()}
+}
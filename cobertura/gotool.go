@@ -0,0 +1,88 @@
+package cobertura
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GoRunner runs the go command, e.g. go list -m or go tool covdata, so that
+// programs in sandboxes without one can substitute their own
+type GoRunner interface {
+	// RunGo runs go with args in dir, the current directory if empty,
+	// returning its standard output
+	RunGo(dir string, args ...string) ([]byte, error)
+}
+
+// GoCommand is the GoRunner executing the go command in an isolated
+// workspace, so that concurrent runs don't interfere: each invocation gets a
+// GOTMPDIR of its own, removed once it exits, and GOFLAGS with -mod=readonly
+// so that go.mod and go.sum are never updated. Other GOFLAGS, such as
+// -mod=vendor, are kept.
+type GoCommand struct {
+	// Path is the go command run, go from PATH if empty
+	Path string
+	// Env holds more environment variables, overriding the inherited ones
+	Env []string
+}
+
+// RunGo implements GoRunner
+func (g GoCommand) RunGo(dir string, args ...string) ([]byte, error) {
+	path := g.Path
+	if path == "" {
+		path = "go"
+	}
+	tmp, err := ioutil.TempDir("", "gobertura-go-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTMPDIR="+tmp, "GOFLAGS="+readonlyGoFlags(os.Getenv("GOFLAGS")))
+	cmd.Env = append(cmd.Env, g.Env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		name := "go"
+		if len(args) > 0 {
+			name += " " + args[0]
+		}
+		if len(args) > 1 && args[0] == "tool" {
+			name += " " + args[1]
+		}
+		return nil, fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// readonlyGoFlags returns flags, the GOFLAGS of the user, with -mod=mod
+// replaced by -mod=readonly, which is added when -mod isn't set
+func readonlyGoFlags(flags string) string {
+	var kept []string
+	mod := false
+	for _, f := range strings.Fields(flags) {
+		if f == "-mod=mod" || f == "--mod=mod" {
+			continue
+		}
+		mod = mod || strings.HasPrefix(strings.TrimLeft(f, "-"), "mod=")
+		kept = append(kept, f)
+	}
+	if !mod {
+		kept = append(kept, "-mod=readonly")
+	}
+	return strings.Join(kept, " ")
+}
+
+// goRunner returns r, or GoCommand if nil
+func goRunner(r GoRunner) GoRunner {
+	if r == nil {
+		return GoCommand{}
+	}
+	return r
+}
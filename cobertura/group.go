@@ -0,0 +1,66 @@
+package cobertura
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// classDirective assigns a top-level function to the class of a type when
+// GroupByType is set, in the doc comment of the function:
+//
+//	//gobertura:class Foo
+const classDirective = "//gobertura:class"
+
+// fileTypes returns the names of the types declared in file
+func fileTypes(file *ast.File) map[string]bool {
+	types := map[string]bool{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			types[spec.(*ast.TypeSpec).Name.Name] = true
+		}
+	}
+	return types
+}
+
+// associatedType returns the class of the top-level function n when grouping
+// by type: the one named by a classDirective, else the type of its file it
+// constructs, returned first as by NewFoo or ParseFoo, else the one it
+// operates on, taken as its first parameter. Other functions are grouped in
+// the "-" class.
+func (v *fileVisitor) associatedType(n *ast.FuncDecl) string {
+	if n.Doc != nil {
+		for _, comment := range n.Doc.List {
+			if strings.HasPrefix(comment.Text, classDirective+" ") {
+				return strings.TrimSpace(strings.TrimPrefix(comment.Text, classDirective))
+			}
+		}
+	}
+	var candidates []ast.Expr
+	if n.Type.Results != nil && len(n.Type.Results.List) > 0 {
+		candidates = append(candidates, n.Type.Results.List[0].Type)
+	}
+	if params := n.Type.Params.List; len(params) > 0 {
+		candidates = append(candidates, params[0].Type)
+	}
+	for _, expr := range candidates {
+		name := v.typeName(expr)
+		if i := strings.Index(name, "["); i >= 0 && v.types[name[:i]] || v.types[name] {
+			return name
+		}
+	}
+	return "-"
+}
+
+// typeName returns the source of the type expr without pointer indirection,
+// e.g. Foo for *Foo, keeping type parameters
+func (v *fileVisitor) typeName(expr ast.Expr) string {
+	start := v.fset.Position(expr.Pos())
+	end := v.fset.Position(expr.End())
+	name := string(v.fileData[start.Offset:end.Offset])
+	return strings.TrimSpace(strings.TrimLeft(name, "*"))
+}
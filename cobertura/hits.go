@@ -0,0 +1,68 @@
+package cobertura
+
+import "math"
+
+// maxCount is the largest count a profile block can hold
+const maxCount = int(^uint(0) >> 1)
+
+// addHits sums hit counts, saturating instead of overflowing so that the hot
+// paths of long atomic mode runs stay covered
+func addHits(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// addCounts is addHits for the int counts of profile blocks
+func addCounts(a, b int) int {
+	if a > maxCount-b {
+		return maxCount
+	}
+	return a + b
+}
+
+// ratio returns n/d, 0 when d is 0
+func ratio(n, d int64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// RoundRates rounds the rates of the report and of all its elements to the
+// given number of decimals, so encoded reports don't change with the last
+// bits of a rate. A negative number of decimals keeps rates as they are.
+func (cov *Coverage) RoundRates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	scale := math.Pow(10, float64(decimals))
+	round := func(rate *float64) {
+		*rate = math.Round(*rate*scale) / scale
+	}
+
+	round(&cov.LineRate)
+	round(&cov.BranchRate)
+	for _, pkg := range cov.Packages {
+		round(&pkg.LineRate)
+		round(&pkg.BranchRate)
+		for _, class := range pkg.Classes {
+			round(&class.LineRate)
+			round(&class.BranchRate)
+			for _, method := range class.Methods {
+				round(&method.LineRate)
+				round(&method.BranchRate)
+			}
+		}
+	}
+	for _, category := range cov.Categories {
+		round(&category.LineRate)
+	}
+	if cov.Deprecated != nil {
+		round(&cov.Deprecated.LineRate)
+	}
+	if cov.Entrypoints != nil {
+		round(&cov.Entrypoints.LineRate)
+	}
+}
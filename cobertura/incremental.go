@@ -0,0 +1,120 @@
+package cobertura
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// previousFiles indexes the classes and trivial functions of Previous by
+// file
+type previousFiles struct {
+	classes map[string][]*Class
+	trivial map[string][]*TrivialFunction
+}
+
+// indexPrevious fills cov.previous from Previous
+func (cov *Coverage) indexPrevious() {
+	cov.previous = previousFiles{classes: map[string][]*Class{}, trivial: map[string][]*TrivialFunction{}}
+	if cov.Previous == nil {
+		return
+	}
+	for _, pkg := range cov.Previous.Packages {
+		for _, class := range pkg.Classes {
+			cov.previous.classes[class.Filename] = append(cov.previous.classes[class.Filename], class)
+		}
+	}
+	for _, f := range cov.Previous.Trivial {
+		cov.previous.trivial[f.Filename] = append(cov.previous.trivial[f.Filename], f)
+	}
+}
+
+// sourceHash hashes the source data of a file along with the options
+// changing its classes, so that classes converted with other options aren't
+// reused
+func (cov *Coverage) sourceHash(data []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "classify=%t exclude-mocks=%t exclude-trivial=%t group-by-type=%t deprecated=%t main=%t\n", cov.Classify, cov.ExcludeMocks, cov.ExcludeTrivial, cov.GroupByType, cov.DetectDeprecated, cov.DetectMain)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// unchanged returns the classes of Previous for the file reported as name
+// when they all have hash, nil otherwise or when the lines of its
+// initializer, needed to tell its blocks, were trimmed
+func (cov *Coverage) unchanged(name string, hash string) []*Class {
+	classes := cov.previous.classes[name]
+	for _, class := range classes {
+		if class.SourceHash != hash {
+			return nil
+		}
+		for _, method := range class.Methods {
+			if method.Name == InitializerMethod && len(method.Lines) == 0 {
+				return nil
+			}
+		}
+	}
+	return classes
+}
+
+// reuseClasses adds the classes previous of the file of v, along with their
+// methods and trivial functions, computing their lines from the profile of
+// v: the blocks between the first and last lines of each method, or starting
+// on a line of the previous initializer. For files formatted by gofmt, which
+// never share a line between functions, it matches a conversion parsing the
+// file.
+func (cov *Coverage) reuseClasses(v *fileVisitor, previous []*Class, hash string) {
+	if cov.ClassifyLines {
+		cov.LineKinds[v.fileName] = lineKinds(v.fileData, v.profile)
+	}
+	v.pkg = cov.packageOf(v.fileName)
+	for _, p := range previous {
+		name := p.Name
+		if cov.UniqueClasses {
+			// Renamed again once the package is complete
+			name = strings.TrimSuffix(name, " ("+filepath.Base(p.Filename)+")")
+		}
+		v.category, v.main = p.Category, p.Main
+		class := v.classNamed(name)
+		for _, m := range p.Methods {
+			if method := v.reuseMethod(m); method != nil {
+				class.addMethod(method)
+			}
+		}
+		class.sortByPosition()
+		class.SourceHash = hash
+	}
+	for _, f := range cov.previous.trivial[v.fileName] {
+		trivial := *f
+		cov.Trivial = append(cov.Trivial, &trivial)
+	}
+	v.pkg.LineRate = v.pkg.HitRate()
+	cov.Reused = append(cov.Reused, v.fileName)
+}
+
+// reuseMethod returns the method m of the previous report with the lines of
+// the profile of v, nil for an initializer left without lines
+func (v *fileVisitor) reuseMethod(m *Method) *Method {
+	method := &Method{Name: m.Name, Signature: m.Signature, FirstLine: m.FirstLine, LastLine: m.LastLine, Function: m.Function, Deprecated: m.Deprecated, Lines: Lines{}}
+	initializer := m.Name == InitializerMethod
+	lines := map[int]bool{}
+	for _, line := range m.Lines {
+		lines[line.Number] = true
+	}
+	for _, b := range v.profile.Blocks {
+		if initializer && lines[b.StartLine] || !initializer && b.StartLine >= m.FirstLine && b.EndLine <= m.LastLine {
+			v.addBlock(method, b)
+		}
+	}
+	if v.lineFilter != nil {
+		method.Lines = v.filterLines(method.Lines)
+	}
+	if initializer && len(method.Lines) == 0 {
+		return nil
+	}
+	sort.SliceStable(method.Lines, func(i, j int) bool { return method.Lines[i].Number < method.Lines[j].Number })
+	return method
+}
@@ -0,0 +1,72 @@
+package cobertura
+
+import (
+	"go/scanner"
+	"go/token"
+	"golang.org/x/tools/cover"
+	"strings"
+)
+
+// Kinds of the lines holding no statement, see Coverage.LineKinds
+const (
+	LineBlank       = "blank"
+	LineComment     = "comment"
+	LineDeclaration = "declaration"
+)
+
+// lineKinds classifies the lines of data outside of the blocks of profile,
+// the ones go tool cover -html shows in grey: blank lines, lines holding
+// comments only and the other ones, declarations such as package, import,
+// type or function signatures
+func lineKinds(data []byte, profile *cover.Profile) map[int]string {
+	executable := map[int]bool{}
+	for _, b := range profile.Blocks {
+		for i := b.StartLine; i <= b.EndLine; i++ {
+			executable[i] = true
+		}
+	}
+
+	code := map[int]bool{}
+	comments := map[int]bool{}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(data))
+	var s scanner.Scanner
+	s.Init(file, data, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Automatic semicolons are inserted at newlines, not written
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		first := fset.Position(pos).Line
+		last := first + strings.Count(lit, "\n")
+		for i := first; i <= last; i++ {
+			if tok == token.COMMENT {
+				comments[i] = true
+			} else {
+				code[i] = true
+			}
+		}
+	}
+
+	kinds := map[int]string{}
+	n := strings.Count(strings.TrimSuffix(string(data), "\n"), "\n") + 1
+	for i := 1; i <= n; i++ {
+		switch {
+		case executable[i]:
+		case code[i]:
+			kinds[i] = LineDeclaration
+		case comments[i]:
+			kinds[i] = LineComment
+		default:
+			kinds[i] = LineBlank
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,367 @@
+package cobertura
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Merge combines reports, which don't have to be generated by gobertura, into
+// a single one. Packages are matched by name, classes by name and filename,
+// methods by name and signature and lines by number; hits of matching lines
+// are summed. Attributes and elements unknown to gobertura, like the metadata,
+// are kept from the first report defining them and all rates and totals are recomputed from
+// line data. The merged report carries the flags of all reports, and their
+// run type when they share it, mixed otherwise.
+func Merge(reports ...*Coverage) *Coverage {
+	merged := &Coverage{Packages: []*Package{}}
+	sources := map[string]bool{}
+	for i, report := range reports {
+		if i == 0 {
+			merged.RunType = report.RunType
+		} else if report.RunType != merged.RunType {
+			merged.RunType = RunMixed
+		}
+		if merged.Version == "" {
+			merged.Version = report.Version
+		}
+		if report.Timestamp > merged.Timestamp {
+			merged.Timestamp = report.Timestamp
+		}
+		if merged.Metadata == nil {
+			merged.Metadata = report.Metadata
+		}
+		merged.Extra = mergeAttrs(merged.Extra, report.Extra)
+		merged.Comment = mergeComment(merged.Comment, report.Comment)
+		merged.Unknown = mergeElements(merged.Unknown, report.Unknown)
+		for _, source := range report.Sources {
+			if !sources[source.Path] {
+				sources[source.Path] = true
+				merged.Sources = append(merged.Sources, &Source{Path: source.Path})
+			}
+		}
+		for _, pkg := range report.Packages {
+			merged.mergePackage(pkg)
+		}
+		merged.Unresolved = append(merged.Unresolved, report.Unresolved...)
+		merged.Partial = merged.Partial || report.Partial
+		merged.mergeMocks(report.Mocks)
+		merged.DeadCode = append(merged.DeadCode, report.DeadCode...)
+		merged.mergeTrivial(report.Trivial)
+		merged.TestPackages = append(merged.TestPackages, report.TestPackages...)
+		if len(report.Categories) > 0 {
+			// Recomputed from the merged classes below
+			merged.Categories = report.Categories
+		}
+		if report.Deprecated != nil {
+			merged.Deprecated = report.Deprecated
+		}
+		if report.Entrypoints != nil {
+			merged.Entrypoints = report.Entrypoints
+		}
+		for _, flag := range report.Flags {
+			if !merged.HasFlag(flag) {
+				merged.Flags = append(merged.Flags, flag)
+			}
+		}
+	}
+	sort.Strings(merged.Flags)
+	merged.Recompute()
+	merged.DeadCode = merged.stillDead(merged.DeadCode)
+	return merged
+}
+
+// stillDead returns the functions of dead not covered by cov, once each
+func (cov *Coverage) stillDead(dead []*DeadFunction) []*DeadFunction {
+	covered := map[DeadFunction]bool{}
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			for _, method := range class.Methods {
+				if method.Lines.NumLinesWithHits() > 0 {
+					covered[DeadFunction{Filename: class.Filename, Class: class.Name, Name: method.Name}] = true
+				}
+			}
+		}
+	}
+	var kept []*DeadFunction
+	seen := map[DeadFunction]bool{}
+	for _, f := range dead {
+		key := DeadFunction{Filename: f.Filename, Class: f.Class, Name: f.Name}
+		if !covered[key] && !seen[key] {
+			seen[key] = true
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// Recompute updates rates and totals of every element from its line data,
+// weighted by statements when lines carry them. Classes without methods, as produced by some other Cobertura converters,
+// are accounted by their own lines.
+func (cov *Coverage) Recompute() {
+	cov.LinesValid, cov.LinesCovered = 0, 0
+	cov.BranchesValid, cov.BranchesCovered = 0, 0
+	var totalStatements, totalStatementsWithHits int64
+	for _, pkg := range cov.Packages {
+		var valid, covered, statements, statementsWithHits, branchesValid, branchesCovered int64
+		for _, class := range pkg.Classes {
+			for _, method := range class.Methods {
+				method.LineRate = lineRate(method.Lines)
+				method.BranchRate = rate(method.Lines.branches())
+			}
+			class.LineRate = lineRate(class.Lines)
+			class.BranchRate = rate(class.Lines.branches())
+
+			valid += class.Lines.NumLines()
+			covered += class.Lines.NumLinesWithHits()
+			statements += class.Lines.NumStatements()
+			statementsWithHits += class.Lines.NumStatementsWithHits()
+			c, v := class.Lines.branches()
+			branchesCovered += c
+			branchesValid += v
+		}
+		pkg.LineRate = rate(covered, valid)
+		if statements > 0 {
+			pkg.LineRate = rate(statementsWithHits, statements)
+		}
+		totalStatements += statements
+		totalStatementsWithHits += statementsWithHits
+		pkg.BranchRate = rate(branchesCovered, branchesValid)
+
+		cov.LinesValid += valid
+		cov.LinesCovered += covered
+		cov.BranchesValid += branchesValid
+		cov.BranchesCovered += branchesCovered
+	}
+	cov.LineRate = rate(cov.LinesCovered, cov.LinesValid)
+	if totalStatements > 0 {
+		cov.LineRate = rate(totalStatementsWithHits, totalStatements)
+	}
+	cov.BranchRate = rate(cov.BranchesCovered, cov.BranchesValid)
+	if len(cov.Categories) > 0 {
+		cov.Categories = cov.CategoryTotals()
+	}
+	if cov.Deprecated != nil {
+		cov.Deprecated, _ = cov.DeprecatedTotals()
+	}
+	if cov.Entrypoints != nil {
+		cov.Entrypoints = cov.MainTotals()
+	}
+}
+
+// lineRate is Lines.HitRate, 0 for no lines
+func lineRate(lines Lines) float64 {
+	if len(lines) == 0 {
+		return 0
+	}
+	return lines.HitRate()
+}
+
+func rate(covered int64, valid int64) float64 {
+	return ratio(covered, valid)
+}
+
+func (cov *Coverage) mergePackage(pkg *Package) {
+	var merged *Package
+	for _, p := range cov.Packages {
+		if p.Name == pkg.Name {
+			merged = p
+		}
+	}
+	if merged == nil {
+		merged = &Package{Name: pkg.Name, Complexity: pkg.Complexity, Classes: []*Class{}}
+		cov.Packages = append(cov.Packages, merged)
+	}
+	merged.Extra = mergeAttrs(merged.Extra, pkg.Extra)
+	merged.Comment = mergeComment(merged.Comment, pkg.Comment)
+	merged.Unknown = mergeElements(merged.Unknown, pkg.Unknown)
+
+	for _, class := range pkg.Classes {
+		merged.mergeClass(class)
+	}
+}
+
+func (pkg *Package) mergeClass(class *Class) {
+	var merged *Class
+	for _, c := range pkg.Classes {
+		if c.Name == class.Name && c.Filename == class.Filename {
+			merged = c
+		}
+	}
+	if merged == nil {
+		merged = &Class{Name: class.Name, Filename: class.Filename, Category: class.Category, Asset: class.Asset, Main: class.Main, SourceHash: class.SourceHash, Complexity: class.Complexity, Methods: []*Method{}, Lines: Lines{}}
+		pkg.Classes = append(pkg.Classes, merged)
+	}
+	// Reports of different sources can't be reused
+	if merged.SourceHash != class.SourceHash {
+		merged.SourceHash = ""
+	}
+	merged.Extra = mergeAttrs(merged.Extra, class.Extra)
+	merged.Comment = mergeComment(merged.Comment, class.Comment)
+	merged.Unknown = mergeElements(merged.Unknown, class.Unknown)
+	merged.Lines = mergeLines(merged.Lines, class.Lines)
+	merged.addRange(class.FirstLine, class.LastLine)
+
+	for _, method := range class.Methods {
+		var m *Method
+		for _, candidate := range merged.Methods {
+			if candidate.Name == method.Name && candidate.Signature == method.Signature {
+				m = candidate
+			}
+		}
+		if m == nil {
+			m = &Method{Name: method.Name, Signature: method.Signature, Complexity: method.Complexity, FirstLine: method.FirstLine, LastLine: method.LastLine, Function: method.Function, Deprecated: method.Deprecated, Lines: Lines{}}
+			merged.Methods = append(merged.Methods, m)
+		}
+		m.Extra = mergeAttrs(m.Extra, method.Extra)
+		m.Comment = mergeComment(m.Comment, method.Comment)
+		m.Unknown = mergeElements(m.Unknown, method.Unknown)
+		m.Lines = mergeLines(m.Lines, method.Lines)
+		if len(method.Tests) > 0 {
+			m.Tests = mergeTests(m.Tests, method.Tests)
+		}
+	}
+	merged.sortByPosition()
+}
+
+// mergeLines adds the hits of lines to dst, returning it sorted by line number
+func mergeLines(dst Lines, lines Lines) Lines {
+	byNumber := map[int]*Line{}
+	for _, line := range dst {
+		byNumber[line.Number] = line
+	}
+	for _, line := range lines {
+		merged := byNumber[line.Number]
+		if merged == nil {
+			merged = &Line{Number: line.Number}
+			byNumber[line.Number] = merged
+			dst = append(dst, merged)
+		}
+		merged.Hits = addHits(merged.Hits, line.Hits)
+		if line.Statements > merged.Statements {
+			merged.Statements = line.Statements
+		}
+		if line.StatementsWithHits > merged.StatementsWithHits {
+			merged.StatementsWithHits = line.StatementsWithHits
+		}
+
+		// Keep the best branch coverage seen for the line
+		if c, _, ok := line.conditionCoverage(); ok {
+			mc, _, mok := merged.conditionCoverage()
+			if !mok || c > mc {
+				merged.Extra = setAttr(merged.Extra, line.attr("branch"), line.attr("condition-coverage"))
+				var unknown []*Element
+				for _, element := range merged.Unknown {
+					if element.XMLName.Local != "conditions" {
+						unknown = append(unknown, element)
+					}
+				}
+				merged.Unknown = unknown
+			}
+		}
+		for _, platform := range line.Platforms {
+			merged.addPlatformHits(platform.Name, platform.Hits)
+		}
+		merged.Extra = mergeAttrs(merged.Extra, line.Extra)
+		merged.Comment = mergeComment(merged.Comment, line.Comment)
+		merged.Unknown = mergeElements(merged.Unknown, line.Unknown)
+	}
+	sort.Slice(dst, func(i, j int) bool { return dst[i].Number < dst[j].Number })
+	return dst
+}
+
+// mergeAttrs appends the attributes of src not already defined in dst
+func mergeAttrs(dst []xml.Attr, src []xml.Attr) []xml.Attr {
+	for _, attr := range src {
+		found := false
+		for _, d := range dst {
+			if d.Name == attr.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, attr)
+		}
+	}
+	return dst
+}
+
+// mergeComment appends the comment src to dst unless dst holds it already
+func mergeComment(dst string, src string) string {
+	switch {
+	case src == "" || strings.Contains(dst, src):
+		return dst
+	case dst == "":
+		return src
+	}
+	return dst + " " + src
+}
+
+// mergeElements appends the elements of src whose name isn't used in dst
+func mergeElements(dst []*Element, src []*Element) []*Element {
+	names := map[xml.Name]bool{}
+	for _, d := range dst {
+		names[d.XMLName] = true
+	}
+	for _, element := range src {
+		if !names[element.XMLName] {
+			dst = append(dst, element)
+		}
+	}
+	return dst
+}
+
+// setAttr replaces or appends the given attributes, skipping empty names
+func setAttr(dst []xml.Attr, attrs ...xml.Attr) []xml.Attr {
+	for _, attr := range attrs {
+		if attr.Name.Local == "" {
+			continue
+		}
+		replaced := false
+		for i := range dst {
+			if dst[i].Name == attr.Name {
+				dst[i] = attr
+				replaced = true
+			}
+		}
+		if !replaced {
+			dst = append(dst, attr)
+		}
+	}
+	return dst
+}
+
+func (line *Line) attr(name string) xml.Attr {
+	for _, attr := range line.Extra {
+		if attr.Name.Local == name {
+			return attr
+		}
+	}
+	return xml.Attr{}
+}
+
+// conditionCoverage parses the covered and valid branch counts of a
+// condition-coverage attribute such as "50% (1/2)"
+func (line *Line) conditionCoverage() (covered int64, valid int64, ok bool) {
+	value := line.attr("condition-coverage").Value
+	if value == "" {
+		return 0, 0, false
+	}
+	var percent int
+	_, err := fmt.Sscanf(value, "%d%% (%d/%d)", &percent, &covered, &valid)
+	return covered, valid, err == nil
+}
+
+// branches returns the covered and valid branch counts of lines
+func (lines Lines) branches() (covered int64, valid int64) {
+	for _, line := range lines {
+		c, v, ok := line.conditionCoverage()
+		if ok {
+			covered += c
+			valid += v
+		}
+	}
+	return covered, valid
+}
@@ -0,0 +1,166 @@
+package cobertura
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mock is the coverage of a mock generated by mockgen or moq, reported
+// instead of its file when ExcludeMocks is set
+type Mock struct {
+	// Interface is the mocked interface, as named by the generator
+	Interface string        `xml:"interface,attr"`
+	Type      string        `xml:"type,attr"`
+	Filename  string        `xml:"filename,attr"`
+	Generator string        `xml:"generator,attr"`
+	Methods   []*MockMethod `xml:"method"`
+}
+
+// MockMethod is a method of a mock, exercised when any of its lines was hit
+type MockMethod struct {
+	Name      string `xml:"name,attr"`
+	Exercised bool   `xml:"exercised,attr"`
+}
+
+// Dead reports whether none of the methods of the mock is exercised
+func (m *Mock) Dead() bool {
+	for _, method := range m.Methods {
+		if method.Exercised {
+			return false
+		}
+	}
+	return true
+}
+
+// mockHeaders match the comments marking the files of each generator
+var mockHeaders = map[string]*regexp.Regexp{
+	"mockgen": regexp.MustCompile(`^// Code generated by MockGen\. DO NOT EDIT\.$`),
+	"moq":     regexp.MustCompile(`^// Code generated by moq; DO NOT EDIT\.$`),
+}
+
+// mockDocs extract the mocked interface from the doc comment of mock types
+var mockDocs = map[string]*regexp.Regexp{
+	"mockgen": regexp.MustCompile(`is a mock of (\S+) interface`),
+	"moq":     regexp.MustCompile(`is a mock implementation of (\S+?)\.?$`),
+}
+
+// mockGenerator returns the generator of file, "" if it isn't a mock. The
+// file needs to be parsed with comments.
+func mockGenerator(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			for generator, re := range mockHeaders {
+				if re.MatchString(comment.Text) {
+					return generator
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// mockTypes maps the mock types of file, written by generator, to the
+// interface they mock
+func mockTypes(file *ast.File, generator string) map[string]string {
+	types := map[string]string{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if _, ok := ts.Type.(*ast.StructType); !ok {
+				continue
+			}
+			name := ts.Name.Name
+			doc := ts.Doc
+			if doc == nil {
+				doc = gen.Doc
+			}
+			if doc != nil {
+				if m := mockDocs[generator].FindStringSubmatch(strings.TrimSpace(doc.Text())); m != nil {
+					types[name] = m[1]
+					continue
+				}
+			}
+			switch {
+			case generator == "mockgen" && strings.HasPrefix(name, "Mock") && !strings.HasSuffix(name, "MockRecorder"):
+				types[name] = strings.TrimPrefix(name, "Mock")
+			case generator == "moq" && strings.HasSuffix(name, "Mock"):
+				types[name] = strings.TrimSuffix(name, "Mock")
+			}
+		}
+	}
+	return types
+}
+
+// addMocks records the mocks of the file reported as name instead of its
+// classes. Methods added by the generators to inspect calls, EXPECT and the
+// Calls methods, aren't mocked methods and are left out.
+func (cov *Coverage) addMocks(name string, generator string, file *ast.File, visitor *fileVisitor) {
+	visitor.pkg = &Package{}
+	ast.Walk(visitor, file)
+
+	types := mockTypes(file, generator)
+	var names []string
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, typeName := range names {
+		mock := &Mock{Interface: types[typeName], Type: typeName, Filename: name, Generator: generator}
+		for className, class := range visitor.classes {
+			if i := strings.Index(className, "["); i >= 0 {
+				className = className[:i]
+			}
+			if className != typeName {
+				continue
+			}
+			for _, method := range class.Methods {
+				if method.Name == "EXPECT" || generator == "moq" && strings.HasSuffix(method.Name, "Calls") {
+					continue
+				}
+				mock.Methods = append(mock.Methods, &MockMethod{Name: method.Name, Exercised: method.Lines.NumLinesWithHits() > 0})
+			}
+		}
+		sort.Slice(mock.Methods, func(i, j int) bool { return mock.Methods[i].Name < mock.Methods[j].Name })
+		cov.Mocks = append(cov.Mocks, mock)
+	}
+}
+
+// mergeMocks adds mocks to the mocks of cov, methods of a mock being
+// exercised if they are in any report
+func (cov *Coverage) mergeMocks(mocks []*Mock) {
+	for _, mock := range mocks {
+		var merged *Mock
+		for _, m := range cov.Mocks {
+			if m.Filename == mock.Filename && m.Type == mock.Type {
+				merged = m
+			}
+		}
+		if merged == nil {
+			merged = &Mock{Interface: mock.Interface, Type: mock.Type, Filename: mock.Filename, Generator: mock.Generator}
+			cov.Mocks = append(cov.Mocks, merged)
+		}
+		for _, method := range mock.Methods {
+			found := false
+			for _, m := range merged.Methods {
+				if m.Name == method.Name {
+					m.Exercised = m.Exercised || method.Exercised
+					found = true
+				}
+			}
+			if !found {
+				merged.Methods = append(merged.Methods, &MockMethod{Name: method.Name, Exercised: method.Exercised})
+			}
+		}
+		sort.Slice(merged.Methods, func(i, j int) bool { return merged.Methods[i].Name < merged.Methods[j].Name })
+	}
+}
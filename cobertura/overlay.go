@@ -0,0 +1,130 @@
+package cobertura
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadOverlay reads the replacements of an overlay file, in the format of
+// go build -overlay
+func ReadOverlay(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overlay struct {
+		Replace map[string]string
+	}
+	err = json.Unmarshal(data, &overlay)
+	if err != nil {
+		return nil, err
+	}
+	return overlay.Replace, nil
+}
+
+// overlayFiles indexes Overlay by absolute path, logical paths in replaced
+// and the files replacing them in replacing
+type overlayFiles struct {
+	replaced  map[string]string
+	replacing map[string]string
+}
+
+// indexOverlay fills cov.overlay from Overlay
+func (cov *Coverage) indexOverlay() {
+	cov.overlay = overlayFiles{replaced: map[string]string{}, replacing: map[string]string{}}
+	for logical, actual := range cov.Overlay {
+		logical = absPath(logical)
+		if actual == "" {
+			// Deleted by the overlay
+			cov.overlay.replaced[logical] = ""
+			continue
+		}
+		actual = absPath(actual)
+		cov.overlay.replaced[logical] = actual
+		cov.overlay.replacing[actual] = logical
+	}
+}
+
+// absPath returns path made absolute, or as is if that fails
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// logicalName maps fileName back to the file it replaces in Overlay
+func (cov *Coverage) logicalName(fileName string) string {
+	if logical, ok := cov.overlay.replacing[absPath(fileName)]; ok {
+		return logical
+	}
+	return fileName
+}
+
+// sourcePath returns the file holding the content of fileName, replaced in
+// Overlay or itself. ok is false if the overlay deleted it.
+func (cov *Coverage) sourcePath(fileName string) (path string, ok bool) {
+	if actual, replaced := cov.overlay.replaced[absPath(fileName)]; replaced {
+		return actual, actual != ""
+	}
+	return fileName, true
+}
+
+// fsPath returns the path of fileName in FS: relative paths are relative to
+// its root, absolute ones must be below a source folder
+func (cov *Coverage) fsPath(fileName string) (string, error) {
+	if filepath.IsAbs(fileName) {
+		for _, source := range cov.Sources {
+			rel, err := filepath.Rel(source.Path, fileName)
+			if err == nil && !strings.HasPrefix(rel, "..") {
+				return filepath.ToSlash(rel), nil
+			}
+		}
+		return "", &os.PathError{Op: "open", Path: fileName, Err: errors.New("outside of the source folders")}
+	}
+	name := filepath.ToSlash(filepath.Clean(fileName))
+	if !fs.ValidPath(name) {
+		return "", &os.PathError{Op: "open", Path: fileName, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+// readSource reads the content of fileName, honoring Overlay and FS
+func (cov *Coverage) readSource(fileName string) ([]byte, error) {
+	if cov.FS != nil {
+		name, err := cov.fsPath(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return fs.ReadFile(cov.FS, name)
+	}
+	path, ok := cov.sourcePath(fileName)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: fileName, Err: os.ErrNotExist}
+	}
+	return ioutil.ReadFile(path)
+}
+
+// sourceExists reports whether fileName exists, honoring Overlay and FS
+func (cov *Coverage) sourceExists(fileName string) bool {
+	if cov.FS != nil {
+		name, err := cov.fsPath(fileName)
+		if err != nil {
+			return false
+		}
+		_, err = fs.Stat(cov.FS, name)
+		return err == nil
+	}
+	path, ok := cov.sourcePath(fileName)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,109 @@
+package cobertura
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/tools/cover"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PlannedFile is a file of the profiles as ParseProfiles would handle it
+type PlannedFile struct {
+	// Name is the file name reported in classes
+	Name    string
+	Package string
+	// Profiles are the file names listing it in the profiles
+	Profiles []string
+	// Source is the file its content would be read from
+	Source   string
+	Included bool
+	// Missing is set when the source can't be read, which fails the
+	// conversion unless SkipMissing is set
+	Missing bool
+	// Reason tells why the file is excluded, or how its name was mapped
+	Reason string
+}
+
+// Plan resolves the files of profiles like ParseProfiles, applying the path
+// mappings and exclusions of cov, but without parsing sources, to debug
+// their configuration. Files are listed in the order they would be parsed.
+func (cov *Coverage) Plan(profiles []*cover.Profile) ([]*PlannedFile, error) {
+	if cov.FS != nil && len(cov.Overlay) > 0 {
+		return nil, fmt.Errorf("Overlay can't be used with FS")
+	}
+	cov.indexOverlay()
+
+	var files []*PlannedFile
+	byName := map[string]*PlannedFile{}
+	listed := map[*PlannedFile][]*cover.Profile{}
+	notes := map[*PlannedFile]map[string]bool{}
+	for _, profile := range profiles {
+		logical := cov.logicalName(profile.FileName)
+		name := cov.canonicalName(logical)
+		file := byName[name]
+		if file == nil {
+			file = &PlannedFile{Name: name, Package: packageName(name)}
+			byName[name] = file
+			files = append(files, file)
+			notes[file] = map[string]bool{}
+		}
+		file.Profiles = append(file.Profiles, profile.FileName)
+		listed[file] = append(listed[file], profile)
+
+		slashed := filepath.ToSlash(logical)
+		switch {
+		case logical != profile.FileName:
+			notes[file]["replaced by the overlay"] = true
+		case strings.Contains(slashed, "/pkg/mod/") && strings.Contains(slashed, "@"):
+			notes[file]["mapped from the module cache"] = true
+		case filepath.IsAbs(logical):
+			notes[file]["made relative from an absolute path"] = true
+		}
+	}
+
+	for _, file := range files {
+		file.Source = cov.TrimPackagePath(cov.sourceFile(file.Name, listed[file]))
+		if len(file.Profiles) > 1 {
+			notes[file][fmt.Sprintf("merged from %d profiles", len(file.Profiles))] = true
+		}
+		data, err := cov.readSource(file.Source)
+		switch {
+		case err != nil:
+			file.Missing = true
+			file.Reason = fmt.Sprintf("source not found: %v", err)
+		case cov.ExcludeMocks && headerGenerator(data) != "":
+			file.Reason = "mock generated by " + headerGenerator(data)
+		default:
+			file.Included = true
+			var reasons []string
+			for note := range notes[file] {
+				reasons = append(reasons, note)
+			}
+			sort.Strings(reasons)
+			file.Reason = strings.Join(reasons, ", ")
+		}
+	}
+	return files, nil
+}
+
+// headerGenerator returns the mock generator named by the comments before
+// the package clause of the source data, "" if it isn't a mock. Unlike
+// mockGenerator, it scans the text without parsing.
+func headerGenerator(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		for generator, re := range mockHeaders {
+			if re.MatchString(line) {
+				return generator
+			}
+		}
+	}
+	return ""
+}
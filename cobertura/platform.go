@@ -0,0 +1,100 @@
+package cobertura
+
+import "sort"
+
+// PlatformHits holds the hits of a line on one platform
+type PlatformHits struct {
+	Name string `xml:"name,attr"`
+	Hits int64  `xml:"hits,attr"`
+}
+
+// PlatformGap is a line covered on some platforms but not on others
+type PlatformGap struct {
+	Filename    string
+	Line        int
+	CoveredOn   []string
+	UncoveredOn []string
+}
+
+// MergePlatforms merges reports like Merge, additionally keeping the hits of
+// every line by the Platform of the report it comes from. Reports without
+// Platform only contribute the platform hits they already carry.
+func MergePlatforms(reports ...*Coverage) *Coverage {
+	merged := Merge(reports...)
+	for _, report := range reports {
+		if report.Platform == "" {
+			continue
+		}
+		hits := map[string]map[int]int64{}
+		for _, pkg := range report.Packages {
+			for _, class := range pkg.Classes {
+				if hits[class.Filename] == nil {
+					hits[class.Filename] = map[int]int64{}
+				}
+				for _, line := range class.Lines {
+					hits[class.Filename][line.Number] += line.Hits
+				}
+			}
+		}
+
+		for _, pkg := range merged.Packages {
+			for _, class := range pkg.Classes {
+				fileHits, ok := hits[class.Filename]
+				if !ok {
+					continue
+				}
+				lines := append(Lines{}, class.Lines...)
+				for _, method := range class.Methods {
+					lines = append(lines, method.Lines...)
+				}
+				for _, line := range lines {
+					if h, ok := fileHits[line.Number]; ok {
+						line.addPlatformHits(report.Platform, h)
+					}
+				}
+			}
+		}
+	}
+	return merged
+}
+
+func (line *Line) addPlatformHits(name string, hits int64) {
+	for _, p := range line.Platforms {
+		if p.Name == name {
+			p.Hits = addHits(p.Hits, hits)
+			return
+		}
+	}
+	line.Platforms = append(line.Platforms, &PlatformHits{Name: name, Hits: hits})
+	sort.Slice(line.Platforms, func(i, j int) bool { return line.Platforms[i].Name < line.Platforms[j].Name })
+}
+
+// PlatformGaps lists the lines covered on some of the platforms recording
+// them but not on others, sorted by file and line
+func (cov Coverage) PlatformGaps() []PlatformGap {
+	var gaps []PlatformGap
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				gap := PlatformGap{Filename: class.Filename, Line: line.Number}
+				for _, p := range line.Platforms {
+					if p.Hits > 0 {
+						gap.CoveredOn = append(gap.CoveredOn, p.Name)
+					} else {
+						gap.UncoveredOn = append(gap.UncoveredOn, p.Name)
+					}
+				}
+				if len(gap.CoveredOn) > 0 && len(gap.UncoveredOn) > 0 {
+					gaps = append(gaps, gap)
+				}
+			}
+		}
+	}
+	sort.SliceStable(gaps, func(i, j int) bool {
+		if gaps[i].Filename != gaps[j].Filename {
+			return gaps[i].Filename < gaps[j].Filename
+		}
+		return gaps[i].Line < gaps[j].Line
+	})
+	return gaps
+}
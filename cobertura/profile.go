@@ -0,0 +1,222 @@
+package cobertura
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/tools/cover"
+	"io"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPosition bounds the line and column numbers of profile blocks, larger
+// values come from corrupted or hand-edited profiles
+const maxPosition = 1 << 24
+
+// ParseProfile parses the coverage profile written by go test -coverprofile
+// from r like cover.ParseProfiles, returning a profile per source file. It
+// also validates every block, failing with the line number of the first
+// malformed one. Concatenated profiles, repeating the mode line, are accepted
+// when their modes match.
+func ParseProfile(r io.Reader) ([]*cover.Profile, error) {
+	profiles, warnings, err := parseProfile(r, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		return nil, warnings[0]
+	}
+	return profiles, nil
+}
+
+// ParseProfileLenient is like ParseProfile but skips malformed lines,
+// returning a warning for each of them
+func ParseProfileLenient(r io.Reader) ([]*cover.Profile, []error, error) {
+	return parseProfile(r, true)
+}
+
+func parseProfile(r io.Reader, lenient bool) ([]*cover.Profile, []error, error) {
+	var warnings []error
+	files := map[string]*cover.Profile{}
+	mode := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "mode: ") {
+			m := strings.TrimPrefix(line, "mode: ")
+			if mode == "" {
+				mode = m
+				continue
+			}
+			if m != mode {
+				warnings = append(warnings, fmt.Errorf("line %d: mode %q doesn't match %q", n, m, mode))
+				if !lenient {
+					break
+				}
+			}
+			continue
+		}
+		if mode == "" {
+			return nil, nil, fmt.Errorf("line %d: expected a mode line, got %q", n, line)
+		}
+
+		fileName, block, err := parseBlock(line)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("line %d: %v", n, err))
+			if !lenient {
+				break
+			}
+			continue
+		}
+		profile := files[fileName]
+		if profile == nil {
+			profile = &cover.Profile{FileName: fileName, Mode: mode}
+			files[fileName] = profile
+		}
+		profile.Blocks = append(profile.Blocks, block)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if mode == "" {
+		return nil, nil, fmt.Errorf("empty profile")
+	}
+
+	profiles := make([]*cover.Profile, 0, len(files))
+	for _, profile := range files {
+		profile.Blocks = mergeBlocks(mode, profile.Blocks)
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles, warnings, nil
+}
+
+// parseBlock parses a line such as
+//
+//	encoding/base64/base64.go:34.44,37.40 3 1
+//
+// from the right, as file names may contain colons
+func parseBlock(line string) (string, cover.ProfileBlock, error) {
+	var b cover.ProfileBlock
+	colon := strings.LastIndex(line, ":")
+	if colon <= 0 {
+		return "", b, fmt.Errorf("missing file name in %q", line)
+	}
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return "", b, fmt.Errorf("expected \"file:start,end statements count\", got %q", line)
+	}
+	positions := strings.Split(fields[0], ",")
+	if len(positions) != 2 {
+		return "", b, fmt.Errorf("malformed range %q", fields[0])
+	}
+
+	var err error
+	b.StartLine, b.StartCol, err = parsePosition(positions[0])
+	if err != nil {
+		return "", b, err
+	}
+	b.EndLine, b.EndCol, err = parsePosition(positions[1])
+	if err != nil {
+		return "", b, err
+	}
+	if b.EndLine < b.StartLine || b.EndLine == b.StartLine && b.EndCol < b.StartCol {
+		return "", b, fmt.Errorf("reversed range %s", fields[0])
+	}
+	b.NumStmt, err = strconv.Atoi(fields[1])
+	if err != nil || b.NumStmt < 0 {
+		return "", b, fmt.Errorf("invalid statement count %q", fields[1])
+	}
+	b.Count, err = parseCount(fields[2])
+	if err != nil {
+		return "", b, err
+	}
+	return line[:colon], b, nil
+}
+
+// parseCount parses the count of a block. Counts too large for an int, which
+// atomic mode hot paths can reach, saturate instead of failing.
+func parseCount(s string) (int, error) {
+	count, err := strconv.ParseInt(s, 10, strconv.IntSize)
+	if errors.Is(err, strconv.ErrRange) && count > 0 {
+		return maxCount, nil
+	}
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid count %q", s)
+	}
+	return int(count), nil
+}
+
+// parsePosition parses a "line.column" position
+func parsePosition(s string) (int, int, error) {
+	dot := strings.Index(s, ".")
+	if dot < 0 {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	line, err := strconv.Atoi(s[:dot])
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	col, err := strconv.Atoi(s[dot+1:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	if line < 1 || col < 1 || line > maxPosition || col > maxPosition {
+		return 0, 0, fmt.Errorf("position %q out of range", s)
+	}
+	return line, col, nil
+}
+
+// CompactProfiles shrinks profiles, such as the huge ones of long atomic mode
+// runs, without changing which blocks are covered. Blocks of the same range
+// are combined, then counts above clamp, when positive, are clamped and with
+// buckets counts are rounded down to a power of two.
+func CompactProfiles(profiles []*cover.Profile, clamp int, buckets bool) {
+	for _, profile := range profiles {
+		profile.Blocks = mergeBlocks(profile.Mode, profile.Blocks)
+		for i := range profile.Blocks {
+			b := &profile.Blocks[i]
+			if clamp > 0 && b.Count > clamp {
+				b.Count = clamp
+			}
+			if buckets && b.Count > 0 {
+				b.Count = 1 << (bits.Len(uint(b.Count)) - 1)
+			}
+		}
+	}
+}
+
+// MergeProfiles combines profiles, such as those of several processes, into
+// one profile per file: counts of the same block are summed, or or-ed in set
+// mode. Mixing modes, counts are summed in the first mode other than set,
+// which all returned profiles share. Files keep the order they first appear
+// in.
+func MergeProfiles(profiles []*cover.Profile) []*cover.Profile {
+	mode := ""
+	var names []string
+	byName := map[string][]*cover.Profile{}
+	for _, profile := range profiles {
+		if mode == "" || mode == "set" {
+			mode = profile.Mode
+		}
+		if byName[profile.FileName] == nil {
+			names = append(names, profile.FileName)
+		}
+		byName[profile.FileName] = append(byName[profile.FileName], profile)
+	}
+	merged := make([]*cover.Profile, 0, len(names))
+	for _, name := range names {
+		profile := mergeProfiles(byName[name])
+		profile.Mode = mode
+		merged = append(merged, profile)
+	}
+	return merged
+}
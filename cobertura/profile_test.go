@@ -0,0 +1,239 @@
+package cobertura_test
+
+import (
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"github.com/nim4/gocover-cobertura/cobertura/coberturatest"
+	"golang.org/x/tools/cover"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const calcSource = `package calc
+
+func Add(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	return a + b
+}
+`
+
+func TestParseProfileCombinesDuplicateBlocks(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		profile string
+		want    []cover.ProfileBlock
+	}{
+		{
+			name: "set duplicates are or-ed",
+			profile: `mode: set
+example.com/calc/calc.go:3.24,4.12 1 1
+example.com/calc/calc.go:3.24,4.12 1 1
+example.com/calc/calc.go:4.12,6.3 1 0
+example.com/calc/calc.go:4.12,6.3 1 1
+`,
+			want: []cover.ProfileBlock{
+				coberturatest.Block(3, 24, 4, 12, 1, 1),
+				coberturatest.Block(4, 12, 6, 3, 1, 1),
+			},
+		},
+		{
+			name: "count duplicates are summed",
+			profile: `mode: count
+example.com/calc/calc.go:3.24,4.12 1 2
+example.com/calc/calc.go:3.24,4.12 1 3
+example.com/calc/calc.go:4.12,6.3 1 0
+`,
+			want: []cover.ProfileBlock{
+				coberturatest.Block(3, 24, 4, 12, 1, 5),
+				coberturatest.Block(4, 12, 6, 3, 1, 0),
+			},
+		},
+		{
+			name: "concatenated set profiles",
+			profile: `mode: set
+example.com/calc/calc.go:4.12,6.3 1 0
+example.com/calc/calc.go:3.24,4.12 1 1
+mode: set
+example.com/calc/calc.go:3.24,4.12 1 0
+example.com/calc/calc.go:4.12,6.3 1 1
+`,
+			want: []cover.ProfileBlock{
+				coberturatest.Block(3, 24, 4, 12, 1, 1),
+				coberturatest.Block(4, 12, 6, 3, 1, 1),
+			},
+		},
+		{
+			name: "concatenated count profiles",
+			profile: `mode: count
+example.com/calc/calc.go:3.24,4.12 1 1
+example.com/calc/calc.go:6.3,7.14 1 1
+mode: count
+example.com/calc/calc.go:3.24,4.12 1 4
+example.com/calc/calc.go:4.12,6.3 1 2
+`,
+			want: []cover.ProfileBlock{
+				coberturatest.Block(3, 24, 4, 12, 1, 5),
+				coberturatest.Block(4, 12, 6, 3, 1, 2),
+				coberturatest.Block(6, 3, 7, 14, 1, 1),
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := coberturatest.ParseProfiles(t, tt.profile)
+			if len(profiles) != 1 {
+				t.Fatalf("got %d profiles, want 1", len(profiles))
+			}
+			if got := profiles[0].Blocks; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got blocks %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCombinesDuplicateProfiles(t *testing.T) {
+	fsys := fstest.MapFS{"calc/calc.go": {Data: []byte(calcSource)}}
+	for _, tt := range []struct {
+		name     string
+		profiles []*cover.Profile
+		want     map[int]int64
+	}{
+		{
+			name: "set",
+			profiles: []*cover.Profile{
+				coberturatest.Profile("example.com/m/calc/calc.go", "set", coberturatest.Block(3, 24, 4, 12, 1, 1), coberturatest.Block(4, 12, 6, 3, 1, 0)),
+				coberturatest.Profile("example.com/m/calc/calc.go", "set", coberturatest.Block(3, 24, 4, 12, 1, 1), coberturatest.Block(4, 12, 6, 3, 1, 1)),
+			},
+			want: map[int]int64{3: 1, 4: 1, 5: 1, 6: 1},
+		},
+		{
+			name: "count",
+			profiles: []*cover.Profile{
+				coberturatest.Profile("example.com/m/calc/calc.go", "count", coberturatest.Block(3, 24, 4, 12, 1, 2), coberturatest.Block(4, 12, 6, 3, 1, 0)),
+				coberturatest.Profile("example.com/m/calc/calc.go", "count", coberturatest.Block(3, 24, 4, 12, 1, 3)),
+			},
+			want: map[int]int64{3: 5, 4: 0, 5: 0, 6: 0},
+		},
+		{
+			name: "duplicate blocks in one profile",
+			profiles: []*cover.Profile{
+				coberturatest.Profile("example.com/m/calc/calc.go", "count", coberturatest.Block(3, 24, 4, 12, 1, 2), coberturatest.Block(3, 24, 4, 12, 1, 2)),
+			},
+			want: map[int]int64{3: 4, 4: 4},
+		},
+		{
+			name: "mixed modes are summed",
+			profiles: []*cover.Profile{
+				coberturatest.Profile("example.com/m/calc/calc.go", "set", coberturatest.Block(3, 24, 4, 12, 1, 1)),
+				coberturatest.Profile("example.com/m/calc/calc.go", "count", coberturatest.Block(3, 24, 4, 12, 1, 2)),
+			},
+			want: map[int]int64{3: 3, 4: 3},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage := coberturatest.Convert(t, fsys, "example.com/m", tt.profiles)
+			if got := lineHits(coverage); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got hits %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeProfilesCombinesDuplicates(t *testing.T) {
+	merged := cobertura.MergeProfiles([]*cover.Profile{
+		coberturatest.Profile("example.com/m/a.go", "set", coberturatest.Block(1, 1, 2, 2, 1, 1)),
+		coberturatest.Profile("example.com/m/b.go", "set", coberturatest.Block(1, 1, 2, 2, 1, 0)),
+		coberturatest.Profile("example.com/m/a.go", "count", coberturatest.Block(1, 1, 2, 2, 1, 4)),
+	})
+	want := []*cover.Profile{
+		coberturatest.Profile("example.com/m/a.go", "count", coberturatest.Block(1, 1, 2, 2, 1, 5)),
+		coberturatest.Profile("example.com/m/b.go", "count", coberturatest.Block(1, 1, 2, 2, 1, 0)),
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %v, want %v", merged, want)
+	}
+}
+
+func TestParseProfileRejectsMalformedBlocks(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		profile string
+		want    string
+	}{
+		{"empty", "", "empty profile"},
+		{"missing mode", "a.go:1.1,2.2 1 1\n", `line 1: expected a mode line, got "a.go:1.1,2.2 1 1"`},
+		{"mode mismatch", "mode: set\na.go:1.1,2.2 1 1\nmode: count\n", `line 3: mode "count" doesn't match "set"`},
+		{"missing file name", "mode: set\n1.1,2.2 1 1\n", `line 2: missing file name in "1.1,2.2 1 1"`},
+		{"missing fields", "mode: set\na.go:1.1,2.2 1\n", `line 2: expected "file:start,end statements count", got "a.go:1.1,2.2 1"`},
+		{"malformed range", "mode: set\na.go:1.1 1 1\n", `line 2: malformed range "1.1"`},
+		{"malformed position", "mode: set\na.go:1,2.2 1 1\n", `line 2: malformed position "1"`},
+		{"position out of range", "mode: set\na.go:0.1,2.2 1 1\n", `line 2: position "0.1" out of range`},
+		{"reversed range", "mode: set\na.go:3.1,2.2 1 1\n", `line 2: reversed range 3.1,2.2`},
+		{"negative statements", "mode: set\na.go:1.1,2.2 -1 1\n", `line 2: invalid statement count "-1"`},
+		{"negative count", "mode: count\na.go:1.1,2.2 1 -1\n", `line 2: invalid count "-1"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cobertura.ParseProfile(strings.NewReader(tt.profile))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProfileAcceptsUnusualBlocks(t *testing.T) {
+	profiles := coberturatest.ParseProfiles(t, "mode: atomic\r\nC:/src/a.go:1.1,1.1 0 99999999999999999999999\r\n\r\n")
+	want := "C:/src/a.go"
+	if len(profiles) != 1 || profiles[0].FileName != want {
+		t.Fatalf("got %v, want a profile of %s", profiles, want)
+	}
+	if got := profiles[0].Blocks[0].Count; got != int(^uint(0)>>1) {
+		t.Errorf("got count %d, want it saturated", got)
+	}
+}
+
+func TestParseProfileLenientSkipsMalformedLines(t *testing.T) {
+	profiles, warnings, err := cobertura.ParseProfileLenient(strings.NewReader(`mode: set
+a.go:1.1,2.2 1 1
+a.go:2.2,1.1 1 1
+mode: count
+a.go:3.1,4.2 1 x
+a.go:3.1,4.2 1 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*cover.Profile{
+		coberturatest.Profile("a.go", "set", coberturatest.Block(1, 1, 2, 2, 1, 1), coberturatest.Block(3, 1, 4, 2, 1, 0)),
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("got %v, want %v", profiles, want)
+	}
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.Error())
+	}
+	wantWarnings := []string{
+		"line 3: reversed range 2.2,1.1",
+		`line 4: mode "count" doesn't match "set"`,
+		`line 5: invalid count "x"`,
+	}
+	if !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", got, wantWarnings)
+	}
+}
+
+// lineHits returns the hits of every line of the report by number
+func lineHits(coverage *cobertura.Coverage) map[int]int64 {
+	hits := map[int]int64{}
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				hits[line.Number] = line.Hits
+			}
+		}
+	}
+	return hits
+}
@@ -0,0 +1,60 @@
+package cobertura
+
+import "sort"
+
+// Range is a run of consecutive lines of a file
+type Range struct {
+	Filename  string
+	StartLine int
+	EndLine   int
+}
+
+// UncoveredRanges returns the runs of consecutive uncovered lines of every
+// file, sorted by file and line. A line is covered when any class recording
+// it has hits for it.
+func (cov *Coverage) UncoveredRanges() []Range {
+	files := map[string]map[int]int64{}
+	var names []string
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			hits := files[class.Filename]
+			if hits == nil {
+				hits = map[int]int64{}
+				files[class.Filename] = hits
+				names = append(names, class.Filename)
+			}
+			for _, line := range class.Lines {
+				hits[line.Number] = addHits(hits[line.Number], line.Hits)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var ranges []Range
+	for _, name := range names {
+		ranges = append(ranges, UncoveredLineRanges(name, files[name])...)
+	}
+	return ranges
+}
+
+// UncoveredLineRanges merges the lines of hits without hits, hits mapping the
+// line numbers of filename to their hits, into runs of consecutive lines
+func UncoveredLineRanges(filename string, hits map[int]int64) []Range {
+	var uncovered []int
+	for number, h := range hits {
+		if h == 0 {
+			uncovered = append(uncovered, number)
+		}
+	}
+	sort.Ints(uncovered)
+
+	var ranges []Range
+	for _, number := range uncovered {
+		if n := len(ranges); n > 0 && ranges[n-1].EndLine == number-1 {
+			ranges[n-1].EndLine = number
+			continue
+		}
+		ranges = append(ranges, Range{Filename: filename, StartLine: number, EndLine: number})
+	}
+	return ranges
+}
@@ -0,0 +1,55 @@
+package cobertura
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// RawDecoder returns a decoder of the tokens of d leaving namespace prefixes
+// unresolved: prefixed names, such as x:tool and the xmlns:x attribute
+// declaring it, are kept as local names, so that the attributes and elements
+// unknown to gobertura are encoded back as they were read. Reports should be
+// decoded with it rather than with d or xml.Unmarshal, which resolve prefixes
+// into namespaces xml.Encoder can't restore.
+func RawDecoder(d *xml.Decoder) *xml.Decoder {
+	return xml.NewTokenDecoder(rawTokens{d})
+}
+
+// UnmarshalRaw decodes the report data into cov with RawDecoder
+func UnmarshalRaw(data []byte, cov *Coverage) error {
+	return RawDecoder(xml.NewDecoder(bytes.NewReader(data))).Decode(cov)
+}
+
+// rawTokens reads the raw tokens of a decoder, see RawDecoder
+type rawTokens struct {
+	d *xml.Decoder
+}
+
+func (r rawTokens) Token() (xml.Token, error) {
+	t, err := r.d.RawToken()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case xml.StartElement:
+		t = t.Copy()
+		t.Name = prefixedName(t.Name)
+		for i := range t.Attr {
+			t.Attr[i].Name = prefixedName(t.Attr[i].Name)
+		}
+		return t, nil
+	case xml.EndElement:
+		t.Name = prefixedName(t.Name)
+		return t, nil
+	}
+	return xml.CopyToken(t), nil
+}
+
+// prefixedName returns the raw name, whose Space is its prefix, as the local
+// name "prefix:local"
+func prefixedName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
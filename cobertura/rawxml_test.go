@@ -0,0 +1,86 @@
+package cobertura
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+const thirdPartyReport = `<?xml version="1.0"?>
+<coverage xmlns:x="http://example.com/x" x:tool="cov" line-rate="0.5" branch-rate="0" lines-covered="1" lines-valid="2" version="" timestamp="1">
+	<!-- root comment -->
+	<packages>
+		<package name="p" line-rate="0.5" branch-rate="0" complexity="0">
+			<classes>
+				<class name="C" filename="p/c.go" line-rate="0.5" branch-rate="0" complexity="0" x:owner="team">
+					<methods></methods>
+					<lines>
+						<line number="1" hits="1" branch="true" condition-coverage="50% (1/2)"><conditions><condition number="0" type="jump" coverage="50%"/><!-- c --><x:note a="b">t &amp; u</x:note></conditions></line>
+						<line number="2" hits="0"></line>
+					</lines>
+				</class>
+			</classes>
+		</package>
+	</packages>
+	<x:extra y="1"><x:inner/></x:extra>
+</coverage>`
+
+func TestRoundTripKeepsUnknownMarkup(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		report string
+		want   []string
+	}{
+		{
+			name:   "prefixed namespace",
+			report: thirdPartyReport,
+			want: []string{
+				`xmlns:x="http://example.com/x"`,
+				`x:tool="cov"`,
+				`x:owner="team"`,
+				`<!-- root comment -->`,
+				`<!-- c --><x:note a="b">t &amp; u</x:note>`,
+				`<x:extra y="1"><x:inner></x:inner></x:extra>`,
+			},
+		},
+		{
+			name:   "default namespace",
+			report: strings.Replace(thirdPartyReport, "<coverage ", `<coverage xmlns="http://example.com/d" `, 1),
+			want: []string{
+				`xmlns="http://example.com/d"`,
+				`xmlns:x="http://example.com/x"`,
+				`<x:extra y="1"><x:inner></x:inner></x:extra>`,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			first := roundTrip(t, tt.report)
+			for _, want := range tt.want {
+				if !strings.Contains(first, want) {
+					t.Errorf("missing %s in\n%s", want, first)
+				}
+			}
+			if strings.Contains(first, "_xmlns") {
+				t.Errorf("namespace declarations were mangled:\n%s", first)
+			}
+			if second := roundTrip(t, first); second != first {
+				t.Errorf("second round trip changed the report:\n%s\nwant\n%s", second, first)
+			}
+		})
+	}
+}
+
+// roundTrip decodes report, merges it alone and encodes the result
+func roundTrip(t *testing.T, report string) string {
+	t.Helper()
+	cov := &Coverage{}
+	err := UnmarshalRaw([]byte(report), cov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := xml.MarshalIndent(Merge(cov), "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,138 @@
+package cobertura
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+// Redact replaces the file paths and identifiers of the report, the names of
+// its sources, packages, classes, methods, tests and mocks, with hashes keyed
+// by key, so that it can be shared without leaking the source layout, along
+// with the files indexing Mismatches, ParseTimes and LineKinds. The
+// same name always gets the same hash and every segment of a path is hashed
+// on its own, keeping the structure, rates and line numbers of the report;
+// file extensions, the "-" classes and InitializerMethod are kept. Elements,
+// attributes and comments unknown to gobertura, the arguments of the
+// metadata and the reasons files were left unresolved, which may hold
+// anything, are dropped.
+func (cov *Coverage) Redact(key []byte) {
+	r := redactor{key: key, hashes: map[string]string{}}
+	for _, source := range cov.Sources {
+		source.Path = r.path(source.Path)
+	}
+	for _, pkg := range cov.Packages {
+		pkg.Name = r.path(pkg.Name)
+		pkg.Extra, pkg.Comment, pkg.Unknown = nil, "", nil
+		for _, class := range pkg.Classes {
+			class.Name = r.name(class.Name)
+			class.Filename = r.path(class.Filename)
+			class.Extra, class.Comment, class.Unknown = nil, "", nil
+			for _, method := range class.Methods {
+				method.Name = r.name(method.Name)
+				method.Signature = r.name(method.Signature)
+				for i, test := range method.Tests {
+					method.Tests[i] = r.name(test)
+				}
+				method.Extra, method.Comment, method.Unknown = nil, "", nil
+				redactLines(method.Lines)
+			}
+			redactLines(class.Lines)
+		}
+	}
+	for _, u := range cov.Unresolved {
+		u.Path, u.Reason = r.path(u.Path), ""
+	}
+	for _, mock := range cov.Mocks {
+		mock.Interface, mock.Type = r.name(mock.Interface), r.name(mock.Type)
+		mock.Filename = r.path(mock.Filename)
+		for _, method := range mock.Methods {
+			method.Name = r.name(method.Name)
+		}
+	}
+	for _, f := range cov.DeadCode {
+		f.Filename, f.Class, f.Name = r.path(f.Filename), r.name(f.Class), r.name(f.Name)
+	}
+	for _, f := range cov.Trivial {
+		f.Filename, f.Class, f.Name = r.path(f.Filename), r.name(f.Class), r.name(f.Name)
+	}
+	for _, pkg := range cov.TestPackages {
+		pkg.Name = r.path(pkg.Name)
+		for i, test := range pkg.FailedTests {
+			pkg.FailedTests[i] = r.name(test)
+		}
+	}
+	if cov.Metadata != nil {
+		cov.Metadata.Args = nil
+	}
+	cov.Extra, cov.Comment, cov.Unknown = nil, "", nil
+	cov.Mismatches = redactKeys(r, cov.Mismatches)
+	cov.ParseTimes = redactKeys(r, cov.ParseTimes)
+	cov.LineKinds = redactKeys(r, cov.LineKinds)
+}
+
+// redactKeys returns files, a result of the conversion indexed by file, with
+// the paths hashed by r
+func redactKeys[V any](r redactor, files map[string]V) map[string]V {
+	if files == nil {
+		return nil
+	}
+	redacted := make(map[string]V, len(files))
+	for file, v := range files {
+		redacted[r.path(file)] = v
+	}
+	return redacted
+}
+
+func redactLines(lines Lines) {
+	for _, line := range lines {
+		line.Extra, line.Comment, line.Unknown = nil, "", nil
+	}
+}
+
+// redactor hashes the names of a report, caching the hashes
+type redactor struct {
+	key    []byte
+	hashes map[string]string
+}
+
+// name returns the hash of the identifier name, keeping empty names, the
+// "-" class and InitializerMethod
+func (r redactor) name(name string) string {
+	if name == "" || name == "-" || name == InitializerMethod {
+		return name
+	}
+	if h, ok := r.hashes[name]; ok {
+		return h
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(name))
+	h := hex.EncodeToString(mac.Sum(nil))[:12]
+	r.hashes[name] = h
+	return h
+}
+
+// path returns the slash or backslash separated path p with every segment
+// hashed, keeping the extension of the last one and the root of absolute
+// paths
+func (r redactor) path(p string) string {
+	separator := "/"
+	if !strings.Contains(p, "/") && strings.Contains(p, `\`) {
+		separator = `\`
+	}
+	segments := strings.Split(p, separator)
+	for i, segment := range segments {
+		ext := ""
+		if i == len(segments)-1 {
+			ext = path.Ext(segment)
+		}
+		// Keep the volume of Windows paths, e.g. C:
+		if i == 0 && len(segment) == 2 && segment[1] == ':' || segment == "." || segment == ".." {
+			continue
+		}
+		segments[i] = r.name(strings.TrimSuffix(segment, ext)) + ext
+	}
+	return strings.Join(segments, separator)
+}
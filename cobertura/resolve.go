@@ -0,0 +1,188 @@
+package cobertura
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver finds the import path of the module holding a directory, used as
+// PackagePath when it isn't set
+type Resolver interface {
+	ModulePath(dir string) (string, error)
+}
+
+// GoResolver asks go list -m for the module, which accounts for GOFLAGS,
+// workspaces and vendoring, falling back to the module line of the closest
+// go.mod. When Hermetic is set, only go.mod is read.
+type GoResolver struct {
+	Hermetic bool
+	// Runner runs go list, GoCommand if nil
+	Runner GoRunner
+}
+
+// ModulePath implements Resolver
+func (r GoResolver) ModulePath(dir string) (string, error) {
+	if !r.Hermetic {
+		// Ignore failures, e.g. without a go command, and read go.mod instead
+		path, err := goListModule(goRunner(r.Runner), dir)
+		if err == nil {
+			return path, nil
+		}
+	}
+	root, err := moduleRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
+		}
+	}
+	return "", fmt.Errorf("%s: no module line", filepath.Join(root, "go.mod"))
+}
+
+// goListModule returns the path of the module of dir as reported by go list
+// -m. In workspace mode every module of the workspace is listed and the one
+// containing dir is picked.
+func goListModule(runner GoRunner, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	out, err := runner.RunGo(dir, "list", "-m", "-json")
+	if err != nil {
+		return "", err
+	}
+
+	path, moduleDir := "", ""
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for decoder.More() {
+		var module struct {
+			Path string
+			Dir  string
+		}
+		err = decoder.Decode(&module)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(module.Dir, dir)
+		if err == nil && !strings.HasPrefix(rel, "..") && len(module.Dir) > len(moduleDir) {
+			path, moduleDir = module.Path, module.Dir
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("no module contains %s", dir)
+	}
+	return path, nil
+}
+
+// moduleRoot returns the closest directory holding a go.mod, dir or one of
+// its parents
+func moduleRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no go.mod in %s or its parents", dir)
+		}
+	}
+}
+
+// CachingResolver caches the module paths resolved by another Resolver by
+// module root, for long-lived programs converting the profiles of many
+// repositories. An entry is dropped when the go.mod of its root changes or
+// Invalidate is called. It is safe for concurrent use.
+type CachingResolver struct {
+	Resolver Resolver
+
+	mu      sync.Mutex
+	entries map[string]resolved
+}
+
+// resolved is a cached module path, along with the state of go.mod it was
+// resolved with
+type resolved struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// NewCachingResolver returns a CachingResolver of r
+func NewCachingResolver(r Resolver) *CachingResolver {
+	return &CachingResolver{Resolver: r, entries: map[string]resolved{}}
+}
+
+// ModulePath implements Resolver. Directories outside of any module aren't
+// cached.
+func (r *CachingResolver) ModulePath(dir string) (string, error) {
+	root, err := moduleRoot(dir)
+	if err != nil {
+		return r.Resolver.ModulePath(dir)
+	}
+	info, err := os.Stat(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[root]
+	r.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.path, nil
+	}
+
+	// Resolve from the root so that every directory of the module shares it
+	path, err := r.Resolver.ModulePath(root)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = map[string]resolved{}
+	}
+	r.entries[root] = resolved{path: path, modTime: info.ModTime(), size: info.Size()}
+	r.mu.Unlock()
+	return path, nil
+}
+
+// Invalidate drops the cached module path of the module rooted at root, all
+// of them if root is empty
+func (r *CachingResolver) Invalidate(root string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if root == "" {
+		r.entries = map[string]resolved{}
+		return
+	}
+	abs, err := filepath.Abs(root)
+	if err == nil {
+		delete(r.entries, abs)
+	}
+}
+
+// ResolvePackagePath sets PackagePath to the path of the module holding dir
+// as found by r
+func (cov *Coverage) ResolvePackagePath(r Resolver, dir string) error {
+	path, err := r.ModulePath(dir)
+	if err != nil {
+		return err
+	}
+	cov.PackagePath = path + "/"
+	return nil
+}
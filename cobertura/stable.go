@@ -0,0 +1,48 @@
+package cobertura
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StabilizeIDs orders and names the elements of the report so that diffing
+// the reports of two builds only shows real changes: packages are sorted by
+// name, classes by filename and name, methods by position, and the lists of
+// unresolved files, mocks, dead and trivial functions by file. Methods of a
+// class sharing a name, such as the init functions of a file, are numbered by
+// position: the first keeps its name, the second is named init#2 and so on,
+// so that they are told apart, including by Merge.
+func (cov *Coverage) StabilizeIDs() {
+	sort.SliceStable(cov.Packages, func(i, j int) bool { return cov.Packages[i].Name < cov.Packages[j].Name })
+	for _, pkg := range cov.Packages {
+		sort.SliceStable(pkg.Classes, func(i, j int) bool {
+			a, b := pkg.Classes[i], pkg.Classes[j]
+			if a.Filename != b.Filename {
+				return a.Filename < b.Filename
+			}
+			return a.Name < b.Name
+		})
+		for _, class := range pkg.Classes {
+			class.sortByPosition()
+			seen := map[string]int{}
+			for _, method := range class.Methods {
+				key := method.Name + method.Signature
+				seen[key]++
+				if n := seen[key]; n > 1 {
+					method.Name = fmt.Sprintf("%s#%d", method.Name, n)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(cov.Unresolved, func(i, j int) bool { return cov.Unresolved[i].Path < cov.Unresolved[j].Path })
+	sort.SliceStable(cov.Mocks, func(i, j int) bool { return cov.Mocks[i].Filename < cov.Mocks[j].Filename })
+	sort.SliceStable(cov.DeadCode, func(i, j int) bool {
+		a, b := cov.DeadCode[i], cov.DeadCode[j]
+		return a.Filename < b.Filename || a.Filename == b.Filename && a.Line < b.Line
+	})
+	sort.SliceStable(cov.Trivial, func(i, j int) bool {
+		a, b := cov.Trivial[i], cov.Trivial[j]
+		return a.Filename < b.Filename || a.Filename == b.Filename && a.Line < b.Line
+	})
+}
@@ -0,0 +1,141 @@
+package cobertura
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestPackage is the outcome of the tests of a package in a go test -json
+// stream, recorded as an extension of reports converted from it
+type TestPackage struct {
+	Name string `xml:"name,attr"`
+	// Result is the package action: pass, fail or skip
+	Result string `xml:"result,attr"`
+	// Coverage is the percentage of statements printed by go test -cover, -1
+	// when it wasn't printed
+	Coverage float64 `xml:"coverage,attr"`
+	Elapsed  float64 `xml:"elapsed,attr,omitempty"`
+	Passed   int     `xml:"passed,attr"`
+	Failed   int     `xml:"failed,attr"`
+	Skipped  int     `xml:"skipped,attr"`
+	// FailedTests are the names of the failed tests, subtests included
+	FailedTests []string `xml:"failed-test"`
+}
+
+// testEvent is a line of go test -json, see go doc test2json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+var (
+	// coveragePercent matches the coverage printed by go test -cover
+	coveragePercent = regexp.MustCompile(`coverage: (\d+(?:\.\d+)?)% of statements`)
+	// profileFlag matches a -coverprofile flag, e.g. echoed by go test -x or
+	// a test binary run through go tool test2json
+	profileFlag = regexp.MustCompile(`-(?:test\.)?coverprofile[= ](\S+)`)
+)
+
+// ParseTestEvents reads a go test -json stream, returning the results of
+// every package in the order they appear and the paths of the coverage
+// profiles referenced by -coverprofile flags in the test output
+func ParseTestEvents(r io.Reader) ([]*TestPackage, []string, error) {
+	var packages []*TestPackage
+	byName := map[string]*TestPackage{}
+	var profiles []string
+	seen := map[string]bool{}
+	// pending holds the output of every package and test past its last
+	// newline, test2json splitting long or unterminated lines across events
+	pending := map[string]map[string]string{}
+
+	scan := func(pkg *TestPackage, output string) {
+		if m := coveragePercent.FindStringSubmatch(output); m != nil {
+			pkg.Coverage, _ = strconv.ParseFloat(m[1], 64)
+		}
+		for _, m := range profileFlag.FindAllStringSubmatch(output, -1) {
+			path := strings.Trim(m[1], `"'`)
+			if !seen[path] {
+				seen[path] = true
+				profiles = append(profiles, path)
+			}
+		}
+	}
+	flush := func(pkg *TestPackage) {
+		var tests []string
+		for test := range pending[pkg.Name] {
+			tests = append(tests, test)
+		}
+		sort.Strings(tests)
+		for _, test := range tests {
+			scan(pkg, pending[pkg.Name][test])
+		}
+		delete(pending, pkg.Name)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		// go test prints build failures as plain text between events
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var event testEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if event.Package == "" {
+			continue
+		}
+		pkg := byName[event.Package]
+		if pkg == nil {
+			pkg = &TestPackage{Name: event.Package, Coverage: -1}
+			byName[event.Package] = pkg
+			packages = append(packages, pkg)
+		}
+
+		switch event.Action {
+		case "output":
+			if pending[pkg.Name] == nil {
+				pending[pkg.Name] = map[string]string{}
+			}
+			output := pending[pkg.Name][event.Test] + event.Output
+			i := strings.LastIndexByte(output, '\n')
+			pending[pkg.Name][event.Test] = output[i+1:]
+			scan(pkg, output[:i+1])
+		case "pass", "fail", "skip":
+			if event.Test == "" {
+				flush(pkg)
+				pkg.Result = event.Action
+				pkg.Elapsed = event.Elapsed
+				continue
+			}
+			switch event.Action {
+			case "pass":
+				pkg.Passed++
+			case "fail":
+				pkg.Failed++
+				pkg.FailedTests = append(pkg.FailedTests, event.Test)
+			case "skip":
+				pkg.Skipped++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	for _, pkg := range packages {
+		flush(pkg)
+	}
+	return packages, profiles, nil
+}
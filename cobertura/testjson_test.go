@@ -0,0 +1,113 @@
+package cobertura_test
+
+import (
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTestEvents(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		stream   string
+		want     []*cobertura.TestPackage
+		profiles []string
+	}{
+		{
+			name: "interleaved packages",
+			stream: `{"Action":"start","Package":"example.com/m/a"}
+{"Action":"start","Package":"example.com/m/b"}
+{"Action":"run","Package":"example.com/m/a","Test":"TestA"}
+{"Action":"run","Package":"example.com/m/b","Test":"TestB"}
+{"Action":"output","Package":"example.com/m/b","Test":"TestB","Output":"--- FAIL: TestB (0.00s)\n"}
+{"Action":"fail","Package":"example.com/m/b","Test":"TestB","Elapsed":0}
+{"Action":"pass","Package":"example.com/m/a","Test":"TestA","Elapsed":0}
+{"Action":"skip","Package":"example.com/m/a","Test":"TestA/long","Elapsed":0}
+{"Action":"output","Package":"example.com/m/a","Output":"coverage: 75.0% of statements\n"}
+{"Action":"output","Package":"example.com/m/b","Output":"coverage: 12.5% of statements\n"}
+{"Action":"fail","Package":"example.com/m/b","Elapsed":0.2}
+{"Action":"pass","Package":"example.com/m/a","Elapsed":0.1}
+`,
+			want: []*cobertura.TestPackage{
+				{Name: "example.com/m/a", Result: "pass", Coverage: 75, Elapsed: 0.1, Passed: 1, Skipped: 1},
+				{Name: "example.com/m/b", Result: "fail", Coverage: 12.5, Elapsed: 0.2, Failed: 1, FailedTests: []string{"TestB"}},
+			},
+		},
+		{
+			name: "output split across events",
+			stream: `{"Action":"output","Package":"example.com/m/a","Output":"coverage: 7"}
+{"Action":"output","Package":"example.com/m/a","Test":"TestA","Output":"-test.coverprofile=/tmp/"}
+{"Action":"output","Package":"example.com/m/a","Output":"5.0% of statem"}
+{"Action":"output","Package":"example.com/m/a","Test":"TestA","Output":"a.out\n"}
+{"Action":"output","Package":"example.com/m/a","Output":"ents"}
+{"Action":"pass","Package":"example.com/m/a","Elapsed":0.1}
+`,
+			want: []*cobertura.TestPackage{
+				{Name: "example.com/m/a", Result: "pass", Coverage: 75, Elapsed: 0.1},
+			},
+			profiles: []string{"/tmp/a.out"},
+		},
+		{
+			name: "unterminated output of an unfinished package",
+			stream: `{"Action":"output","Package":"example.com/m/a","Output":"go test -coverprofile=\"c.out\""}
+`,
+			want: []*cobertura.TestPackage{
+				{Name: "example.com/m/a", Coverage: -1},
+			},
+			profiles: []string{"c.out"},
+		},
+		{
+			name: "non-JSON lines",
+			stream: `# example.com/m/b
+b/b.go:3:1: syntax error: non-declaration statement outside function body
+
+{"Action":"output","Package":"example.com/m/b","Output":"FAIL\texample.com/m/b [build failed]\n"}
+FAIL	example.com/m/b [build failed]
+{"Action":"fail","Package":"example.com/m/b","Elapsed":0}
+{"Action":"output","Output":"no package\n"}
+`,
+			want: []*cobertura.TestPackage{
+				{Name: "example.com/m/b", Result: "fail", Coverage: -1},
+			},
+		},
+		{
+			name:   "duplicate profiles",
+			stream: "{\"Action\":\"output\",\"Package\":\"p\",\"Output\":\"-coverprofile=c.out -coverprofile 'c.out'\\n\"}\n",
+			want: []*cobertura.TestPackage{
+				{Name: "p", Coverage: -1},
+			},
+			profiles: []string{"c.out"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, profiles, err := cobertura.ParseTestEvents(strings.NewReader(tt.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got packages %s, want %s", describePackages(got), describePackages(tt.want))
+			}
+			if !reflect.DeepEqual(profiles, tt.profiles) {
+				t.Errorf("got profiles %q, want %q", profiles, tt.profiles)
+			}
+		})
+	}
+}
+
+func TestParseTestEventsRejectsMalformedEvents(t *testing.T) {
+	_, _, err := cobertura.ParseTestEvents(strings.NewReader("{\"Action\":\"start\",\"Package\":\"p\"}\n{\"Action\":\n"))
+	if want := "line 2: unexpected end of JSON input"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+// describePackages formats packages for failure messages
+func describePackages(packages []*cobertura.TestPackage) string {
+	var s []string
+	for _, pkg := range packages {
+		s = append(s, fmt.Sprintf("%+v", *pkg))
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
@@ -0,0 +1,46 @@
+package cobertura
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// AddTests records in Tests of every method the tests covering any of its
+// lines, tests mapping file names, as reported in classes, to line numbers
+// to the names of the tests covering them. Subtests are named by their t.Run
+// path, e.g. TestDiv/zero, telling which scenarios exercise a method.
+func (cov *Coverage) AddTests(tests map[string]map[int][]string) {
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			lines := tests[filepath.ToSlash(class.Filename)]
+			if lines == nil {
+				continue
+			}
+			for _, method := range class.Methods {
+				var names []string
+				for _, line := range method.Lines {
+					if line.Hits > 0 {
+						names = append(names, lines[line.Number]...)
+					}
+				}
+				method.Tests = mergeTests(method.Tests, names)
+			}
+		}
+	}
+}
+
+// mergeTests returns the sorted union of the test names of dst and src
+func mergeTests(dst []string, src []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, names := range [][]string{dst, src} {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				merged = append(merged, name)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
@@ -0,0 +1,70 @@
+package cobertura
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// TrivialFunction is a function, or a method of Class when it isn't "-", left
+// out of the report when ExcludeTrivial is set
+type TrivialFunction struct {
+	Filename string `xml:"filename,attr"`
+	Class    string `xml:"class,attr"`
+	Name     string `xml:"name,attr"`
+	Line     int    `xml:"line,attr,omitempty"`
+}
+
+// maxTrivialLines is the number of lines up to which a function without
+// branches is trivial, such as getters and setters
+const maxTrivialLines = 2
+
+// isTrivial reports whether the function n, whose lines are those of method,
+// is a boilerplate accessor: no branches and at most maxTrivialLines lines
+func isTrivial(n *ast.FuncDecl, method *Method) bool {
+	return n.Body != nil && complexity(n.Body) == 1 && len(method.Lines) <= maxTrivialLines
+}
+
+// complexity returns the cyclomatic complexity of body, one plus the number
+// of its branches, not counting those of function literals
+func complexity(body *ast.BlockStmt) int {
+	branches := 0
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			branches++
+		case *ast.CaseClause:
+			if n.List != nil {
+				branches++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				branches++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				branches++
+			}
+		}
+		return true
+	})
+	return 1 + branches
+}
+
+// mergeTrivial adds the trivial functions of another report to those of cov,
+// skipping the ones already listed
+func (cov *Coverage) mergeTrivial(functions []*TrivialFunction) {
+	for _, f := range functions {
+		found := false
+		for _, known := range cov.Trivial {
+			if *known == *f {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cov.Trivial = append(cov.Trivial, f)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package covdebug exposes the coverage counters of a running binary built
+// with -cover, as supported since Go 1.20, so that gobertura can convert the
+// coverage of long-running processes, e.g. of integration environments,
+// without stopping them.
+package covdebug
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/coverage"
+)
+
+// Handler serves the coverage meta-data of the binary for ?part=meta and a
+// snapshot of its counters for ?part=counters, in the format written by
+// runtime/coverage, as read by gobertura -covdata-url. It fails with 500 when
+// the binary wasn't built with -cover.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		var err error
+		switch r.URL.Query().Get("part") {
+		case "meta":
+			err = coverage.WriteMeta(&buf)
+		case "counters":
+			err = coverage.WriteCounters(&buf)
+		default:
+			http.Error(w, "part must be meta or counters", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(buf.Bytes())
+	})
+}
+
+// FlushOnSignal writes the meta-data and counters of the binary to dir,
+// usually GOCOVERDIR, every time the process receives one of sigs, as sent by
+// gobertura -flush-pid. Errors, e.g. without -cover, are passed to onError
+// when it isn't nil.
+func FlushOnSignal(dir string, onError func(error), sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		for range c {
+			err := coverage.WriteMetaDir(dir)
+			if err == nil {
+				err = coverage.WriteCountersDir(dir)
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
@@ -1,5 +1,10 @@
 module github.com/nim4/gocover-cobertura
 
-go 1.15
+go 1.21
 
 require golang.org/x/tools v0.0.0-20201105220310-78b158585360
+
+require (
+	golang.org/x/mod v0.3.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
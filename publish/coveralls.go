@@ -0,0 +1,124 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Coveralls submits the line coverage of every file as a Coveralls job.
+// Empty fields are read from the environment variables of the Coveralls
+// uploaders.
+type Coveralls struct {
+	// Endpoint is COVERALLS_ENDPOINT or https://coveralls.io
+	Endpoint string
+	// Token is the repository token, COVERALLS_REPO_TOKEN
+	Token string
+	// Service names the CI system, COVERALLS_SERVICE_NAME or gobertura
+	Service string
+	// JobID identifies the CI job, COVERALLS_SERVICE_JOB_ID
+	JobID string
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// coverallsFile is a source file of a Coveralls job, whose coverage holds
+// the hits of every line of the file, null for non-code
+type coverallsFile struct {
+	Name     string   `json:"name"`
+	Digest   string   `json:"source_digest"`
+	Coverage []*int64 `json:"coverage"`
+}
+
+// Name implements Uploader
+func (c *Coveralls) Name() string {
+	return "coveralls"
+}
+
+// Upload implements Uploader. Sources are read from the first source folder
+// of coverage, Coveralls identifying them by their digest.
+func (c *Coveralls) Upload(ctx context.Context, coverage *cobertura.Coverage, artifacts []Artifact) error {
+	endpoint := setting(c.Endpoint, "COVERALLS_ENDPOINT", "https://coveralls.io")
+	token := setting(c.Token, "COVERALLS_REPO_TOKEN", "")
+	if token == "" {
+		return fmt.Errorf("coveralls: the repository token is required, see COVERALLS_REPO_TOKEN")
+	}
+	files, err := coverallsFiles(coverage)
+	if err != nil {
+		return err
+	}
+	job, err := json.Marshal(map[string]interface{}{
+		"repo_token":     token,
+		"service_name":   setting(c.Service, "COVERALLS_SERVICE_NAME", "gobertura"),
+		"service_job_id": setting(c.JobID, "COVERALLS_SERVICE_JOB_ID", ""),
+		"source_files":   files,
+	})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("json_file", "coverage.json")
+	if err == nil {
+		_, err = part.Write(job)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/api/v1/jobs", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return do(ctx, c.HTTPClient, req)
+}
+
+// coverallsFiles returns the files of coverage with the hits of their lines
+func coverallsFiles(coverage *cobertura.Coverage) ([]*coverallsFile, error) {
+	source := ""
+	if len(coverage.Sources) > 0 {
+		source = coverage.Sources[0].Path
+	}
+	byName := map[string]*coverallsFile{}
+	var files []*coverallsFile
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			name := filepath.ToSlash(class.Filename)
+			file := byName[name]
+			if file == nil {
+				data, err := ioutil.ReadFile(filepath.Join(source, class.Filename))
+				if err != nil {
+					return nil, fmt.Errorf("coveralls: %v", err)
+				}
+				digest := md5.Sum(data)
+				file = &coverallsFile{Name: name, Digest: hex.EncodeToString(digest[:]), Coverage: make([]*int64, bytes.Count(data, []byte("\n"))+1)}
+				byName[name] = file
+				files = append(files, file)
+			}
+			for _, line := range class.Lines {
+				if line.Number < 1 || line.Number > len(file.Coverage) {
+					continue
+				}
+				hits := line.Hits
+				if previous := file.Coverage[line.Number-1]; previous != nil {
+					hits += *previous
+				}
+				file.Coverage[line.Number-1] = &hits
+			}
+		}
+	}
+	return files, nil
+}
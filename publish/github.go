@@ -0,0 +1,65 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"net/http"
+	"strings"
+)
+
+// GitHub sets a commit status holding the line coverage, shown on pull
+// requests. Empty fields are read from the environment of GitHub Actions.
+type GitHub struct {
+	// API is the REST API URL, GITHUB_API_URL or https://api.github.com
+	API string
+	// Repository is owner/name, GITHUB_REPOSITORY
+	Repository string
+	// SHA is the commit, GITHUB_SHA
+	SHA string
+	// Token needs the statuses permission, GITHUB_TOKEN
+	Token string
+	// Context names the status, gobertura if empty
+	Context string
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Name implements Uploader
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+// Upload implements Uploader
+func (g *GitHub) Upload(ctx context.Context, coverage *cobertura.Coverage, artifacts []Artifact) error {
+	api := setting(g.API, "GITHUB_API_URL", "https://api.github.com")
+	repository := setting(g.Repository, "GITHUB_REPOSITORY", "")
+	sha := setting(g.SHA, "GITHUB_SHA", "")
+	token := setting(g.Token, "GITHUB_TOKEN", "")
+	if repository == "" || sha == "" || token == "" {
+		return fmt.Errorf("github: the repository, commit and token are required, see GITHUB_REPOSITORY, GITHUB_SHA and GITHUB_TOKEN")
+	}
+	name := g.Context
+	if name == "" {
+		name = "gobertura"
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"state":       "success",
+		"context":     name,
+		"description": fmt.Sprintf("%s%% of lines covered (%d/%d)", percent(coverage), coverage.LinesCovered, coverage.LinesValid),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(api, "/"), repository, sha), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	return do(ctx, g.HTTPClient, req)
+}
@@ -0,0 +1,63 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLab sets a commit status holding the line coverage, shown on merge
+// requests and pipelines. Empty fields are read from the environment of
+// GitLab CI jobs.
+type GitLab struct {
+	// API is the v4 API URL, CI_API_V4_URL or https://gitlab.com/api/v4
+	API string
+	// Project is the ID or path of the project, CI_PROJECT_ID
+	Project string
+	// SHA is the commit, CI_COMMIT_SHA
+	SHA string
+	// Token is a token of the api scope, GITLAB_TOKEN, as job tokens can't
+	// set statuses
+	Token string
+	// Context names the status, gobertura if empty
+	Context string
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Name implements Uploader
+func (g *GitLab) Name() string {
+	return "gitlab"
+}
+
+// Upload implements Uploader
+func (g *GitLab) Upload(ctx context.Context, coverage *cobertura.Coverage, artifacts []Artifact) error {
+	api := setting(g.API, "CI_API_V4_URL", "https://gitlab.com/api/v4")
+	project := setting(g.Project, "CI_PROJECT_ID", "")
+	sha := setting(g.SHA, "CI_COMMIT_SHA", "")
+	token := setting(g.Token, "GITLAB_TOKEN", "")
+	if project == "" || sha == "" || token == "" {
+		return fmt.Errorf("gitlab: the project, commit and token are required, see CI_PROJECT_ID, CI_COMMIT_SHA and GITLAB_TOKEN")
+	}
+	name := g.Context
+	if name == "" {
+		name = "gobertura"
+	}
+
+	form := url.Values{
+		"state":       {"success"},
+		"name":        {name},
+		"coverage":    {percent(coverage)},
+		"description": {fmt.Sprintf("%d/%d lines covered", coverage.LinesCovered, coverage.LinesValid)},
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/projects/%s/statuses/%s", strings.TrimSuffix(api, "/"), url.PathEscape(project), sha), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Private-Token", token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return do(ctx, g.HTTPClient, req)
+}
@@ -0,0 +1,109 @@
+// Package publish defines the Uploader interface publishing converted reports
+// to coverage services, along with a registry gobertura -upload picks them
+// from by name. Organizations can register their own uploaders from a Go
+// plugin loaded with gobertura -upload-plugin, without forking the CLI. The
+// GitHub, GitLab and Coveralls uploaders are built on top of it, gobertura
+// registers them.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"github.com/nim4/gocover-cobertura/cobertura"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Artifact is an output written by the conversion
+type Artifact struct {
+	// Name is the file name of the output, e.g. coverage.xml
+	Name string
+	Data []byte
+}
+
+// Uploader publishes the coverage of a conversion, along with the artifacts
+// written, to a service
+type Uploader interface {
+	// Name selects the uploader, e.g. with gobertura -upload
+	Name() string
+	Upload(ctx context.Context, coverage *cobertura.Coverage, artifacts []Artifact) error
+}
+
+var (
+	mu        sync.Mutex
+	uploaders = map[string]Uploader{}
+)
+
+// Register makes u available by its name. Like database/sql drivers,
+// uploaders usually register themselves from an init function. It panics if
+// an uploader of the same name is already registered.
+func Register(u Uploader) {
+	mu.Lock()
+	defer mu.Unlock()
+	if u == nil {
+		panic("publish: Register of a nil Uploader")
+	}
+	if _, ok := uploaders[u.Name()]; ok {
+		panic(fmt.Sprintf("publish: Register called twice for %s", u.Name()))
+	}
+	uploaders[u.Name()] = u
+}
+
+// Lookup returns the uploader registered as name
+func Lookup(name string) (Uploader, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := uploaders[name]
+	return u, ok
+}
+
+// Names returns the sorted names of the registered uploaders
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for name := range uploaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// do sends req with client, http.DefaultClient if nil, failing unless the
+// response is a 2xx. Responses of dry runs may have no body.
+func do(ctx context.Context, client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Redacted(), resp.Status, body)
+	}
+	return nil
+}
+
+// setting returns value, or if empty the environment variable env, or if
+// unset fallback
+func setting(value string, env string, fallback string) string {
+	if value != "" {
+		return value
+	}
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// percent formats the line rate of coverage as a percentage
+func percent(coverage *cobertura.Coverage) string {
+	return fmt.Sprintf("%.2f", coverage.LineRate*100)
+}
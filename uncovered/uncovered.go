@@ -0,0 +1,116 @@
+// Package uncovered defines an Analyzer reporting exported functions and
+// methods which aren't covered by tests, according to a coverage profile.
+package uncovered
+
+import (
+	"go/ast"
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/analysis"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const Doc = `report exported functions not covered by tests
+
+The uncovered analyzer reads the coverage profile given by -profile, as
+produced by "go test -coverprofile", and reports every exported function or
+method whose statements were all left unexecuted. Use an absolute path when
+running it through go vet -vettool.`
+
+var Analyzer = &analysis.Analyzer{
+	Name: "uncovered",
+	Doc:  Doc,
+	Run:  run,
+}
+
+var profilePath string
+
+func init() {
+	Analyzer.Flags.StringVar(&profilePath, "profile", "coverprofile.txt", "path of coverage profile")
+}
+
+var (
+	mu       sync.Mutex
+	profiles = map[string]map[string]*cover.Profile{}
+)
+
+// loadProfiles parses the profile at path once, indexing it by file name
+func loadProfiles(path string) (map[string]*cover.Profile, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if byName, ok := profiles[path]; ok {
+		return byName, nil
+	}
+
+	parsed, err := cover.ParseProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*cover.Profile{}
+	for _, profile := range parsed {
+		byName[profile.FileName] = profile
+	}
+	profiles[path] = byName
+	return byName, nil
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	byName, err := loadProfiles(profilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range pass.Files {
+		fileName := pass.Fset.Position(file.Pos()).Filename
+		if strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+		profile := byName[path.Join(pass.Pkg.Path(), filepath.Base(fileName))]
+		if profile == nil {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || !fn.Name.IsExported() {
+				continue
+			}
+			if notCovered(profile, pass.Fset.Position(fn.Pos()).Line, pass.Fset.Position(fn.End()).Line) {
+				pass.Reportf(fn.Name.Pos(), "%s is not covered by tests", funcName(fn))
+			}
+		}
+	}
+	return nil, nil
+}
+
+// notCovered reports whether profile has blocks between startLine and
+// endLine, none of which was executed
+func notCovered(profile *cover.Profile, startLine int, endLine int) bool {
+	found := false
+	for _, b := range profile.Blocks {
+		if b.StartLine < startLine || b.EndLine > endLine {
+			continue
+		}
+		if b.Count > 0 {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}